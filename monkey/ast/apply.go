@@ -0,0 +1,382 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE.x-tools file.
+//
+// Apply, Cursor and application are adapted from rewrite.go in
+// golang.org/x/tools/go/ast/astutil, to traverse this package's nodes.
+
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// An ApplyFunc is invoked by Apply for each node, before and/or after the
+// node's children, using a Cursor describing the current node and providing
+// operations on it.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a syntax tree recursively, starting with root, and calling
+// pre and post for each node as described below. Apply returns the syntax tree,
+// possibly modified.
+//
+// If pre is not nil, it is called for each node before the node's children are
+// traversed (pre-order). If pre returns false, no children are traversed, and
+// post is not called for that node.
+//
+// If post is not nil, and a prior call of pre didn't return false, post is
+// called for each node after its children are traversed (post-order). If post
+// returns false, traversal is terminated and Apply returns immediately.
+//
+// Only fields that refer to nodes are traversed, in the same order as Walk.
+// Nil fields are skipped. Unlike Modify, Apply changes the tree in place.
+//
+// If pre replaces the current node, the children of the new node are traversed
+// rather than those of the old one, but pre isn't called again for the new
+// node itself. If pre deletes the current node, post isn't called for it.
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	parent := &struct{ Node }{root}
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = parent.Node
+	}()
+	a := &application{pre: pre, post: post}
+	a.apply(parent, "Node", nil, root)
+	return
+}
+
+var abort = new(int) // singleton, to signal termination of Apply
+
+// A Cursor describes a node encountered during Apply. Information about the
+// node and its parent is available from the Node, Parent, Name and Index
+// methods.
+//
+// The methods Replace, Delete, InsertBefore and InsertAfter can be used to
+// change the AST without disrupting Apply. Replacing a node with one that
+// can't be stored in its field, like an expression in a list of statements,
+// panics.
+type Cursor struct {
+	parent Node
+	name   string
+	iter   *iterator // valid if non-nil
+	pair   int       // index into HashLiteral.Pairs, if name is Key or Value
+	node   Node
+}
+
+// Node returns the current Node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current Node. For the root, it's a wrapper
+// holding the root in its Node field.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent Node field that contains the current
+// Node. If the parent is a *HashLiteral, the field is Key or Value of the
+// pair at PairIndex.
+func (c *Cursor) Name() string { return c.name }
+
+// Index reports the index of the current Node in the slice of Nodes that
+// contains it, or a value < 0 if the current Node is not part of a slice. The
+// index of the current node changes if InsertBefore is called while processing
+// the current node.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// PairIndex reports the index of the hash pair that contains the current Node,
+// or a value < 0 if the current Node isn't the key or value of a hash pair.
+func (c *Cursor) PairIndex() int {
+	if c.isPair() {
+		return c.pair
+	}
+	return -1
+}
+
+func (c *Cursor) isPair() bool {
+	_, ok := c.parent.(*HashLiteral)
+	return ok && (c.name == "Key" || c.name == "Value")
+}
+
+// field returns the current node's parent field value.
+func (c *Cursor) field() reflect.Value {
+	v := reflect.Indirect(reflect.ValueOf(c.parent))
+	if c.isPair() {
+		return v.FieldByName("Pairs").Index(c.pair).FieldByName(c.name)
+	}
+	return v.FieldByName(c.name)
+}
+
+// Replace replaces the current Node with n. Replacing it with nil clears an
+// optional field.
+func (c *Cursor) Replace(n Node) {
+	v := c.field()
+	if i := c.Index(); i >= 0 {
+		v = v.Index(i)
+	}
+	if n == nil {
+		v.Set(reflect.Zero(v.Type()))
+	} else {
+		v.Set(reflect.ValueOf(n))
+	}
+	c.node = n
+}
+
+// Delete deletes the current Node from its containing slice. If the current
+// Node is not part of a slice, Delete panics.
+func (c *Cursor) Delete() {
+	i := c.Index()
+	if i < 0 {
+		panic("Delete node not contained in slice")
+	}
+	v := c.field()
+	l := v.Len()
+	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+	v.SetLen(l - 1)
+	c.iter.step--
+	c.node = nil
+}
+
+// InsertAfter inserts n after the current Node in its containing slice. If the
+// current Node is not part of a slice, InsertAfter panics. Apply doesn't walk
+// n.
+func (c *Cursor) InsertAfter(n Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("InsertAfter node not contained in slice")
+	}
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
+	v.Index(i + 1).Set(reflect.ValueOf(n))
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current Node in its containing slice. If
+// the current Node is not part of a slice, InsertBefore panics. Apply will not
+// walk n.
+func (c *Cursor) InsertBefore(n Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("InsertBefore node not contained in slice")
+	}
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+	v.Index(i).Set(reflect.ValueOf(n))
+	c.iter.index++
+}
+
+// application carries all the shared data so we can pass it around cheaply.
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+}
+
+// An iterator controls iteration over a slice of nodes.
+type iterator struct {
+	index, step int
+}
+
+func (a *application) apply(parent Node, name string, iter *iterator, n Node) {
+	// reuse a.cursor rather than allocating a new one for each node
+	saved := a.cursor
+	defer func() { a.cursor = saved }()
+	a.cursor.parent = parent
+	a.cursor.name = name
+	a.cursor.iter = iter
+	a.cursor.node = n
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		return
+	}
+	if a.cursor.node == nil {
+		return
+	}
+
+	switch n := a.cursor.node.(type) {
+	case *Program:
+		a.applyList(n, "Statements")
+	case *BlockStatement:
+		a.applyList(n, "Statements")
+	case *ExpressionStatement:
+		a.applyField(n, "Expression", n.Expression)
+	case *LetStatement:
+		a.applyIdentifier(n, "Name", n.Name)
+		a.applyField(n, "Pattern", n.Pattern)
+		a.applyField(n, "Value", n.Value)
+	case *ReturnStatement:
+		a.applyField(n, "Value", n.Value)
+	case *StructStatement:
+		a.applyIdentifier(n, "Name", n.Name)
+		a.applyList(n, "Fields")
+	case *StructField:
+		a.applyIdentifier(n, "Name", n.Name)
+		a.applyField(n, "Default", n.Default)
+	case *ClassStatement:
+		a.applyIdentifier(n, "Name", n.Name)
+		a.applyIdentifier(n, "SuperClass", n.SuperClass)
+		a.applyList(n, "Methods")
+	case *EnumStatement:
+		a.applyIdentifier(n, "Name", n.Name)
+		a.applyList(n, "Variants")
+	case *EnumVariant:
+		a.applyIdentifier(n, "Name", n.Name)
+		a.applyList(n, "Fields")
+	case *SelectStatement:
+		a.applyList(n, "Cases")
+		a.applyBlock(n, "Default", n.Default)
+	case *SelectCase:
+		a.applyIdentifier(n, "Name", n.Name)
+		if n.Operation != nil {
+			a.apply(n, "Operation", nil, n.Operation)
+		}
+		a.applyBlock(n, "Body", n.Body)
+
+	case *Identifier:
+		a.applyField(n, "Type", n.Type)
+	case *IntegerLiteral, *StringLiteral, *Boolean:
+		// no children
+	case *PrefixExpression:
+		a.applyField(n, "Right", n.Right)
+	case *InfixExpression:
+		a.applyField(n, "Left", n.Left)
+		a.applyField(n, "Right", n.Right)
+	case *IfExpression:
+		a.applyField(n, "Condition", n.Condition)
+		a.applyBlock(n, "Consequence", n.Consequence)
+		a.applyBlock(n, "Alternative", n.Alternative)
+	case *FunctionLiteral:
+		a.applyIdentifier(n, "Name", n.Name)
+		a.applyList(n, "Parameters")
+		a.applyField(n, "ReturnType", n.ReturnType)
+		a.applyBlock(n, "Body", n.Body)
+	case *MacroLiteral:
+		a.applyList(n, "Parameters")
+		a.applyBlock(n, "Body", n.Body)
+	case *CallExpression:
+		a.applyField(n, "Function", n.Function)
+		a.applyList(n, "Arguments")
+	case *ArrayLiteral:
+		a.applyList(n, "Elements")
+	case *HashLiteral:
+		a.applyPairs(n)
+	case *ArrayComprehension:
+		a.applyField(n, "Element", n.Element)
+		a.applyList(n, "Clauses")
+	case *HashComprehension:
+		a.applyField(n, "Key", n.Key)
+		a.applyField(n, "Value", n.Value)
+		a.applyList(n, "Clauses")
+	case *ComprehensionClause:
+		a.applyField(n, "Pattern", n.Pattern)
+		a.applyField(n, "Iterable", n.Iterable)
+		a.applyField(n, "Condition", n.Condition)
+	case *IndexExpression:
+		a.applyField(n, "Left", n.Left)
+		a.applyField(n, "Index", n.Index)
+	case *MemberExpression:
+		a.applyField(n, "Object", n.Object)
+		a.applyIdentifier(n, "Property", n.Property)
+	case *AssignExpression:
+		a.applyField(n, "Target", n.Target)
+		a.applyField(n, "Value", n.Value)
+	case *YieldExpression:
+		a.applyField(n, "Value", n.Value)
+	case *SpawnExpression:
+		a.applyField(n, "Call", n.Call)
+	case *RangeExpression:
+		a.applyField(n, "Start", n.Start)
+		a.applyField(n, "End", n.End)
+		a.applyField(n, "Step", n.Step)
+	case *SpreadElement:
+		a.applyField(n, "Value", n.Value)
+
+	case *NamedType:
+		// no children
+	case *ArrayType:
+		a.applyField(n, "Element", n.Element)
+	case *HashType:
+		a.applyField(n, "Key", n.Key)
+		a.applyField(n, "Value", n.Value)
+	case *FunctionType:
+		a.applyList(n, "Parameters")
+		a.applyField(n, "Return", n.Return)
+
+	default:
+		panic(fmt.Sprintf("ast.Apply: unexpected node type %T", n))
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+}
+
+// applyField applies to an optional child held in an interface field, which is
+// skipped if nil.
+func (a *application) applyField(parent Node, name string, n Node) {
+	if n != nil {
+		a.apply(parent, name, nil, n)
+	}
+}
+
+func (a *application) applyIdentifier(parent Node, name string, n *Identifier) {
+	if n != nil {
+		a.apply(parent, name, nil, n)
+	}
+}
+
+func (a *application) applyBlock(parent Node, name string, n *BlockStatement) {
+	if n != nil {
+		a.apply(parent, name, nil, n)
+	}
+}
+
+func (a *application) applyList(parent Node, name string) {
+	// reuse a.iter rather than allocating a new one for each list
+	saved := a.iter
+	a.iter.index = 0
+	for {
+		// reload the field each time, since the cursor may have changed it
+		v := reflect.Indirect(reflect.ValueOf(parent)).FieldByName(name)
+		if a.iter.index >= v.Len() {
+			break
+		}
+
+		a.iter.step = 1
+		if elem := v.Index(a.iter.index); !elem.IsNil() {
+			a.apply(parent, name, &a.iter, elem.Interface().(Node))
+		}
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
+
+func (a *application) applyPairs(n *HashLiteral) {
+	for idx := 0; idx < len(n.Pairs); idx++ {
+		for _, name := range []string{"Key", "Value"} {
+			pair := n.Pairs[idx]
+			child := pair.Key
+			if name == "Value" {
+				child = pair.Value
+			}
+			if child == nil {
+				continue
+			}
+
+			saved := a.cursor.pair
+			a.cursor.pair = idx
+			a.apply(n, name, nil, child)
+			a.cursor.pair = saved
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyVisitsAllChildren(t *testing.T) {
+	for _, node := range allNodes {
+		typ := reflect.TypeOf(node).Elem()
+		parent := reflect.New(typ)
+		children := fillChildren(parent.Elem())
+
+		visited := map[Node]bool{}
+		Apply(parent.Interface().(Node), func(c *Cursor) bool {
+			visited[c.Node()] = true
+			return true
+		}, nil)
+
+		for _, child := range children {
+			if !visited[child.node] {
+				t.Errorf("Apply didn't visit %s.%s", typ.Name(), child.field)
+			}
+		}
+	}
+}
+
+func TestApplyReplacesEveryChild(t *testing.T) {
+	for _, node := range allNodes {
+		typ := reflect.TypeOf(node).Elem()
+		parent := reflect.New(typ)
+		children := fillChildren(parent.Elem())
+
+		replaced := map[Node]Node{}
+		Apply(parent.Interface().(Node), nil, func(c *Cursor) bool {
+			if c.Parent() == parent.Interface() {
+				replacement := reflect.New(reflect.TypeOf(c.Node()).Elem()).Interface().(Node)
+				replaced[c.Node()] = replacement
+				c.Replace(replacement)
+			}
+			return true
+		})
+
+		after := map[Node]bool{}
+		Inspect(parent.Interface().(Node), func(n Node) bool {
+			after[n] = true
+			return true
+		})
+		for _, child := range children {
+			if !after[replaced[child.node]] {
+				t.Errorf("Apply didn't replace %s.%s", typ.Name(), child.field)
+			}
+		}
+	}
+}
+
+func intLit(value int64) *IntegerLiteral {
+	return &IntegerLiteral{Value: value}
+}
+
+func exprStmt(exp Expression) *ExpressionStatement {
+	return &ExpressionStatement{Expression: exp}
+}
+
+func TestApplyConstantFolding(t *testing.T) {
+	// (1 + 2) * (x + 4)
+	program := &Program{Statements: []Statement{
+		exprStmt(&InfixExpression{
+			Left:     &InfixExpression{Left: intLit(1), Operator: "+", Right: intLit(2)},
+			Operator: "*",
+			Right:    &InfixExpression{Left: &Identifier{Value: "x"}, Operator: "+", Right: intLit(4)},
+		}),
+		// [3 * 3, {5 - 1: 2 * 2}]
+		exprStmt(&ArrayLiteral{Elements: []Expression{
+			&InfixExpression{Left: intLit(3), Operator: "*", Right: intLit(3)},
+			&HashLiteral{Pairs: []HashPair{{
+				Key:   &InfixExpression{Left: intLit(5), Operator: "-", Right: intLit(1)},
+				Value: &InfixExpression{Left: intLit(2), Operator: "*", Right: intLit(2)},
+			}}},
+		}}),
+	}}
+
+	Apply(program, nil, func(c *Cursor) bool {
+		infix, ok := c.Node().(*InfixExpression)
+		if !ok {
+			return true
+		}
+		left, ok := infix.Left.(*IntegerLiteral)
+		if !ok {
+			return true
+		}
+		right, ok := infix.Right.(*IntegerLiteral)
+		if !ok {
+			return true
+		}
+
+		switch infix.Operator {
+		case "+":
+			c.Replace(intLit(left.Value + right.Value))
+		case "-":
+			c.Replace(intLit(left.Value - right.Value))
+		case "*":
+			c.Replace(intLit(left.Value * right.Value))
+		}
+		return true
+	})
+
+	folded := program.Statements[0].(*ExpressionStatement).Expression.(*InfixExpression)
+	if lit, ok := folded.Left.(*IntegerLiteral); !ok || lit.Value != 3 {
+		t.Errorf("left wasn't folded to 3. got=%#v", folded.Left)
+	}
+	if _, ok := folded.Right.(*InfixExpression); !ok {
+		t.Errorf("right shouldn't be folded. got=%#v", folded.Right)
+	}
+
+	array := program.Statements[1].(*ExpressionStatement).Expression.(*ArrayLiteral)
+	if lit, ok := array.Elements[0].(*IntegerLiteral); !ok || lit.Value != 9 {
+		t.Errorf("element wasn't folded to 9. got=%#v", array.Elements[0])
+	}
+	pair := array.Elements[1].(*HashLiteral).Pairs[0]
+	if lit, ok := pair.Key.(*IntegerLiteral); !ok || lit.Value != 4 {
+		t.Errorf("hash key wasn't folded to 4. got=%#v", pair.Key)
+	}
+	if lit, ok := pair.Value.(*IntegerLiteral); !ok || lit.Value != 4 {
+		t.Errorf("hash value wasn't folded to 4. got=%#v", pair.Value)
+	}
+}
+
+func TestApplyCursorInfo(t *testing.T) {
+	call := &CallExpression{
+		Function:  &Identifier{Value: "f"},
+		Arguments: []Expression{intLit(1), intLit(2)},
+	}
+	hash := &HashLiteral{Pairs: []HashPair{{Key: intLit(3), Value: intLit(4)}}}
+	program := &Program{Statements: []Statement{exprStmt(call), exprStmt(hash)}}
+
+	type info struct {
+		parent Node
+		name   string
+		index  int
+		pair   int
+	}
+	expected := map[Node]info{
+		program.Statements[0]: {program, "Statements", 0, -1},
+		program.Statements[1]: {program, "Statements", 1, -1},
+		call:                  {program.Statements[0], "Expression", -1, -1},
+		call.Function:         {call, "Function", -1, -1},
+		call.Arguments[0]:     {call, "Arguments", 0, -1},
+		call.Arguments[1]:     {call, "Arguments", 1, -1},
+		hash:                  {program.Statements[1], "Expression", -1, -1},
+		hash.Pairs[0].Key:     {hash, "Key", -1, 0},
+		hash.Pairs[0].Value:   {hash, "Value", -1, 0},
+	}
+
+	Apply(program, func(c *Cursor) bool {
+		if c.Node() == program {
+			return true
+		}
+		exp, ok := expected[c.Node()]
+		if !ok {
+			t.Errorf("unexpected node %T", c.Node())
+			return true
+		}
+		got := info{c.Parent(), c.Name(), c.Index(), c.PairIndex()}
+		if got != exp {
+			t.Errorf("wrong cursor for %s. expected=%+v, got=%+v", c.Node(), exp, got)
+		}
+		return true
+	}, nil)
+}
+
+func TestApplyListEdits(t *testing.T) {
+	// a; b; c; d
+	program := &Program{Statements: []Statement{
+		exprStmt(&Identifier{Value: "a"}),
+		exprStmt(&Identifier{Value: "b"}),
+		exprStmt(&Identifier{Value: "c"}),
+		exprStmt(&Identifier{Value: "d"}),
+	}}
+
+	visited := []string{}
+	Apply(program, func(c *Cursor) bool {
+		stmt, ok := c.Node().(*ExpressionStatement)
+		if !ok {
+			return true
+		}
+		name := stmt.Expression.(*Identifier).Value
+		visited = append(visited, name)
+
+		switch name {
+		case "a":
+			c.InsertBefore(exprStmt(&Identifier{Value: "before"}))
+		case "b":
+			c.Delete()
+		case "c":
+			c.InsertAfter(exprStmt(&Identifier{Value: "after"}))
+		}
+		return true
+	}, nil)
+
+	if !reflect.DeepEqual(visited, []string{"a", "b", "c", "d"}) {
+		t.Errorf("wrong statements visited. got=%v", visited)
+	}
+	expected := "before;a;c;after;d"
+	if program.String() != expected {
+		t.Errorf("wrong program. expected=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestApplyReplaceRoot(t *testing.T) {
+	result := Apply(intLit(1), func(c *Cursor) bool {
+		c.Replace(intLit(2))
+		return true
+	}, nil)
+
+	if lit, ok := result.(*IntegerLiteral); !ok || lit.Value != 2 {
+		t.Errorf("root wasn't replaced. got=%#v", result)
+	}
+}
+
+func TestApplyReplaceWalksNewNode(t *testing.T) {
+	// x  ->  -x
+	program := &Program{Statements: []Statement{exprStmt(&Identifier{Value: "x"})}}
+
+	idents := 0
+	Apply(program, func(c *Cursor) bool {
+		if ident, ok := c.Node().(*Identifier); ok {
+			idents++
+			if _, ok := c.Parent().(*ExpressionStatement); ok {
+				c.Replace(&PrefixExpression{Operator: "-", Right: ident})
+			}
+		}
+		return true
+	}, nil)
+
+	if program.String() != "(-x)" {
+		t.Errorf("wrong program. expected=%q, got=%q", "(-x)", program.String())
+	}
+	if idents != 2 {
+		t.Errorf("expected x to be visited twice. got=%d", idents)
+	}
+}
+
+func TestApplyPruneAndAbort(t *testing.T) {
+	// f(1); 2; 3
+	program := &Program{Statements: []Statement{
+		exprStmt(&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{intLit(1)}}),
+		exprStmt(intLit(2)),
+		exprStmt(intLit(3)),
+	}}
+
+	ints := []int64{}
+	result := Apply(program, func(c *Cursor) bool {
+		_, isCall := c.Node().(*CallExpression)
+		return !isCall
+	}, func(c *Cursor) bool {
+		if lit, ok := c.Node().(*IntegerLiteral); ok {
+			ints = append(ints, lit.Value)
+			return lit.Value != 2
+		}
+		return true
+	})
+
+	if result != program {
+		t.Errorf("aborted Apply should still return the root. got=%#v", result)
+	}
+	if !reflect.DeepEqual(ints, []int64{2}) {
+		t.Errorf("expected only 2 to be visited. got=%v", ints)
+	}
+}
+
+func TestApplyInvalidEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *Cursor)
+	}{
+		{"delete outside a slice", func(c *Cursor) { c.Delete() }},
+		{"insert outside a slice", func(c *Cursor) { c.InsertAfter(intLit(1)) }},
+		{"replace with the wrong kind of node", func(c *Cursor) { c.Replace(exprStmt(intLit(1))) }},
+	}
+
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected %s to panic", tt.name)
+				}
+			}()
+
+			program := &Program{Statements: []Statement{exprStmt(intLit(1))}}
+			Apply(program, func(c *Cursor) bool {
+				if _, ok := c.Node().(*IntegerLiteral); ok {
+					tt.edit(c)
+				}
+				return true
+			}, nil)
+		}()
+	}
+}
@@ -21,10 +21,17 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
-func (p *Program) String() string {
+func (p *Program) String() string { return joinStatements(p.Statements) }
+
+// joinStatements writes out stmts, separating expression statements from the
+// statement after them so that they're parsed back the same way.
+func joinStatements(stmts []Statement) string {
 	var out bytes.Buffer
-	for _, stmt := range p.Statements {
+	for idx, stmt := range stmts {
 		out.WriteString(stmt.String())
+		if _, ok := stmt.(*ExpressionStatement); ok && idx+1 < len(stmts) {
+			out.WriteString(";")
+		}
 	}
 	return out.String()
 }
@@ -0,0 +1,376 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+// The binary form of a node is compact, and only meant to be read back by a
+// build whose nodes have the same fields, which SchemaHash tells apart. Values
+// are written in the order of their fields, with no names:
+//
+//   - a node is its kind, or "" if it's nil, followed by its fields
+//   - a token is its type, literal, line and column
+//   - a slice is its length plus one, or 0 if it's nil, followed by its elements
+//   - any other pointer is a byte saying whether it's set, followed by its value
+//   - integers are varints, and bools a byte
+//   - a string is a number n: strings are numbered in the order they first
+//     appear, from 1, and 0 introduces a new one, written as its length and
+//     bytes
+//
+// Numbers that can't be negative are uvarints.
+
+var schemaHash = computeSchemaHash()
+
+// SchemaHash returns a hash of the fields of each kind of node, which changes
+// whenever the binary form of a node does.
+func SchemaHash() uint32 {
+	return schemaHash
+}
+
+func computeSchemaHash() uint32 {
+	kinds := []string{}
+	for kind := range nodeKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var buf bytes.Buffer
+	for _, kind := range kinds {
+		typ := nodeKinds[kind]
+		fmt.Fprintf(&buf, "%s{", kind)
+		for idx := 0; idx < typ.NumField(); idx++ {
+			fmt.Fprintf(&buf, "%s %s;", typ.Field(idx).Name, typ.Field(idx).Type)
+		}
+		buf.WriteString("}")
+	}
+	return crc32.ChecksumIEEE(buf.Bytes())
+}
+
+// MarshalBinary returns the binary form of node.
+func MarshalBinary(node Node) ([]byte, error) {
+	e := &binaryEncoder{strings: map[string]int{}}
+	if err := e.encodeValue(reflect.ValueOf(&node).Elem()); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary returns the node whose binary form is data.
+func UnmarshalBinary(data []byte) (Node, error) {
+	d := &binaryDecoder{r: bytes.NewReader(data)}
+	var node Node
+	if err := d.decodeValue(reflect.ValueOf(&node).Elem()); err != nil {
+		return nil, err
+	}
+	if d.r.Len() != 0 {
+		return nil, fmt.Errorf("%d bytes left over", d.r.Len())
+	}
+	return node, nil
+}
+
+func (p *Program) MarshalBinary() ([]byte, error) {
+	return MarshalBinary(p)
+}
+
+func (p *Program) UnmarshalBinary(data []byte) error {
+	node, err := UnmarshalBinary(data)
+	if err != nil {
+		return err
+	}
+	program, ok := node.(*Program)
+	if !ok {
+		return fmt.Errorf("expected a Program, got %s", describeNode(node))
+	}
+	*p = *program
+	return nil
+}
+
+func describeNode(node Node) string {
+	if node == nil {
+		return "nil"
+	}
+	return kindOf(node)
+}
+
+type binaryEncoder struct {
+	buf     bytes.Buffer
+	strings map[string]int // the number of each string written so far
+}
+
+func (e *binaryEncoder) writeUvarint(n uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	e.buf.Write(scratch[:binary.PutUvarint(scratch[:], n)])
+}
+
+func (e *binaryEncoder) writeVarint(n int64) {
+	var scratch [binary.MaxVarintLen64]byte
+	e.buf.Write(scratch[:binary.PutVarint(scratch[:], n)])
+}
+
+func (e *binaryEncoder) writeString(s string) {
+	if n, ok := e.strings[s]; ok {
+		e.writeUvarint(uint64(n))
+		return
+	}
+	e.strings[s] = len(e.strings) + 1
+	e.writeUvarint(0)
+	e.writeUvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *binaryEncoder) writeBool(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *binaryEncoder) encodeValue(v reflect.Value) error {
+	switch {
+	case v.Type().Implements(nodeInterface):
+		return e.encodeNode(v)
+	case v.Type() == tokenType:
+		tok := v.Interface().(token.Token)
+		e.writeString(string(tok.Type))
+		e.writeString(tok.Literal)
+		e.writeVarint(int64(tok.Line))
+		e.writeVarint(int64(tok.Column))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		e.writeBool(!v.IsNil())
+		if v.IsNil() {
+			return nil
+		}
+		return e.encodeValue(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.writeUvarint(0)
+			return nil
+		}
+		e.writeUvarint(uint64(v.Len()) + 1)
+		for idx := 0; idx < v.Len(); idx++ {
+			if err := e.encodeValue(v.Index(idx)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			if err := e.encodeValue(v.Field(idx)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		e.writeString(v.String())
+		return nil
+	case reflect.Bool:
+		e.writeBool(v.Bool())
+		return nil
+	case reflect.Int, reflect.Int64:
+		e.writeVarint(v.Int())
+		return nil
+	default:
+		return fmt.Errorf("can't encode %s", v.Type())
+	}
+}
+
+func (e *binaryEncoder) encodeNode(v reflect.Value) error {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.IsNil() {
+		e.writeString("")
+		return nil
+	}
+
+	kind := v.Elem().Type().Name()
+	if _, ok := nodeKinds[kind]; !ok {
+		return fmt.Errorf("can't encode %s as a node", v.Type())
+	}
+	e.writeString(kind)
+	return e.encodeValue(v.Elem())
+}
+
+type binaryDecoder struct {
+	r       *bytes.Reader
+	strings []string
+}
+
+func (d *binaryDecoder) readUvarint() (uint64, error) {
+	n, err := binary.ReadUvarint(d.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (d *binaryDecoder) readVarint() (int64, error) {
+	n, err := binary.ReadVarint(d.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readLength reads a length, less offset, of something whose elements each
+// take at least a byte, so a corrupt length can't make it allocate more than
+// is left. A length of -1 is one that was written as 0 with an offset of 1.
+func (d *binaryDecoder) readLength(offset uint64) (int, error) {
+	n, err := d.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n < offset {
+		return -1, nil
+	}
+	if n-offset > uint64(d.r.Len()) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(n - offset), nil
+}
+
+func (d *binaryDecoder) readString() (string, error) {
+	n, err := d.readUvarint()
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(len(d.strings)) {
+		return "", fmt.Errorf("unknown string %d", n)
+	}
+	if n > 0 {
+		return d.strings[n-1], nil
+	}
+
+	length, err := d.readLength(0)
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return "", err
+	}
+	d.strings = append(d.strings, string(data))
+	return string(data), nil
+}
+
+func (d *binaryDecoder) readBool() (bool, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return false, io.ErrUnexpectedEOF
+	}
+	if b > 1 {
+		return false, fmt.Errorf("invalid bool %d", b)
+	}
+	return b == 1, nil
+}
+
+// decodeValue decodes the value of v, which must be settable.
+func (d *binaryDecoder) decodeValue(v reflect.Value) error {
+	switch {
+	case v.Type().Implements(nodeInterface):
+		return d.decodeNode(v)
+	case v.Type() == tokenType:
+		return d.decodeToken(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		set, err := d.readBool()
+		if err != nil || !set {
+			return err
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		return d.decodeValue(v.Elem())
+	case reflect.Slice:
+		n, err := d.readLength(1)
+		if err != nil || n < 0 {
+			return err
+		}
+		slice := reflect.MakeSlice(v.Type(), n, n)
+		for idx := 0; idx < n; idx++ {
+			if err := d.decodeValue(slice.Index(idx)); err != nil {
+				return fmt.Errorf("[%d]: %w", idx, err)
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			if err := d.decodeValue(v.Field(idx)); err != nil {
+				return fmt.Errorf("%s: %w", jsonName(v.Type().Field(idx).Name), err)
+			}
+		}
+		return nil
+	case reflect.String:
+		s, err := d.readString()
+		v.SetString(s)
+		return err
+	case reflect.Bool:
+		b, err := d.readBool()
+		v.SetBool(b)
+		return err
+	case reflect.Int, reflect.Int64:
+		n, err := d.readVarint()
+		v.SetInt(n)
+		return err
+	default:
+		return fmt.Errorf("can't decode %s", v.Type())
+	}
+}
+
+func (d *binaryDecoder) decodeNode(v reflect.Value) error {
+	kind, err := d.readString()
+	if err != nil || kind == "" {
+		return err
+	}
+	typ, ok := nodeKinds[kind]
+	if !ok {
+		return fmt.Errorf("unknown node kind %q", kind)
+	}
+
+	node := reflect.New(typ)
+	if !node.Type().AssignableTo(v.Type()) {
+		return fmt.Errorf("expected %s, got %s", describeType(v.Type()), kind)
+	}
+	if err := d.decodeValue(node.Elem()); err != nil {
+		return fmt.Errorf("%s: %w", kind, err)
+	}
+	v.Set(node)
+	return nil
+}
+
+func (d *binaryDecoder) decodeToken(v reflect.Value) error {
+	var tok token.Token
+	tokenType, err := d.readString()
+	if err != nil {
+		return err
+	}
+	tok.Type = token.TokenType(tokenType)
+	if tok.Literal, err = d.readString(); err != nil {
+		return err
+	}
+	line, err := d.readVarint()
+	if err != nil {
+		return err
+	}
+	column, err := d.readVarint()
+	if err != nil {
+		return err
+	}
+	tok.Line, tok.Column = int(line), int(column)
+	v.Set(reflect.ValueOf(tok))
+	return nil
+}
@@ -0,0 +1,109 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+func TestBinaryRoundTripsAllNodes(t *testing.T) {
+	for _, node := range allNodes {
+		typ := reflect.TypeOf(node).Elem()
+		sample := reflect.New(typ)
+		fillChildren(sample.Elem())
+
+		data, err := MarshalBinary(sample.Interface().(Node))
+		if err != nil {
+			t.Errorf("MarshalBinary failed for %s: %s", typ.Name(), err)
+			continue
+		}
+		decoded, err := UnmarshalBinary(data)
+		if err != nil {
+			t.Errorf("UnmarshalBinary failed for %s: %s", typ.Name(), err)
+			continue
+		}
+
+		if !reflect.DeepEqual(decoded, sample.Interface()) {
+			t.Errorf("%s didn't round trip.\nexpected=%#v\ngot=     %#v", typ.Name(), sample.Interface(), decoded)
+		}
+	}
+}
+
+func TestBinaryKeepsTokensAndLocals(t *testing.T) {
+	// let x = -x
+	node := &Program{Statements: []Statement{
+		&LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let", Line: 3, Column: 1},
+			Name: &Identifier{
+				Token: token.Token{Type: token.IDENT, Literal: "x", Line: 3, Column: 5},
+				Value: "x",
+				Local: &Local{Slot: 1},
+			},
+			Value: &PrefixExpression{
+				Token:    token.Token{Type: token.MINUS, Literal: "-", Line: 3, Column: 9},
+				Operator: "-",
+				Right: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Line: 3, Column: 10},
+					Value: "x",
+					Local: &Local{Depth: 2, Slot: 1},
+				},
+			},
+		},
+	}}
+
+	data, err := node.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+
+	var decoded Program
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %s", err)
+	}
+	if !reflect.DeepEqual(&decoded, node) {
+		t.Errorf("wrong program decoded.\nexpected=%#v\ngot=     %#v", node, &decoded)
+	}
+}
+
+func TestUnmarshalBinaryErrors(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &StringLiteral{Value: "hello"}},
+	}}
+	data, err := MarshalBinary(program)
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+	literal, err := MarshalBinary(&IntegerLiteral{Value: 1})
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+
+	tests := []struct {
+		input       []byte
+		expectedErr string
+	}{
+		{data[:len(data)-1], "unexpected EOF"},
+		{append(append([]byte{}, data...), 0), "1 bytes left over"},
+		{[]byte{0, 4, 'N', 'o', 'p', 'e'}, `unknown node kind "Nope"`},
+		{[]byte{3}, "unknown string 3"},
+	}
+
+	for _, tt := range tests {
+		_, err := UnmarshalBinary(tt.input)
+		if err == nil {
+			t.Errorf("expected an error for %v", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expectedErr) {
+			t.Errorf("wrong error for %v. expected=%q, got=%q", tt.input, tt.expectedErr, err.Error())
+		}
+	}
+
+	var decoded Program
+	err = decoded.UnmarshalBinary(literal)
+	if err == nil || !strings.Contains(err.Error(), "expected a Program, got IntegerLiteral") {
+		t.Errorf("wrong error for a non-program. got=%v", err)
+	}
+}
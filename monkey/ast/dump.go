@@ -0,0 +1,190 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SExpr and Dot dump a tree for debugging. Like the JSON form, they're built
+// from the fields of the nodes, so they don't need updating for new nodes.
+// Tokens are left out, along with nil nodes, nil slices and false flags.
+//
+// The S-expression of `-x` is
+//
+//	(PrefixExpression :operator "-" :right (Identifier :value "x"))
+
+// dumpField is a field of a node other than its token.
+type dumpField struct {
+	name  string
+	value reflect.Value
+}
+
+// dumpFields returns the fields of the struct v to dump, named like in the JSON
+// form.
+func dumpFields(v reflect.Value) []dumpField {
+	fields := []dumpField{}
+	for idx := 0; idx < v.NumField(); idx++ {
+		field := v.Field(idx)
+		if field.Type() == tokenType || isEmpty(field) {
+			continue
+		}
+		fields = append(fields, dumpField{jsonName(v.Type().Field(idx).Name), field})
+	}
+	return fields
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Slice:
+		return v.IsNil()
+	case reflect.Bool:
+		return !v.Bool()
+	default:
+		return false
+	}
+}
+
+func formatScalar(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return strconv.Quote(v.String())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// SExpr returns node as an S-expression, with a list for each node that starts
+// with its kind and is followed by its fields as keyword arguments.
+func SExpr(node Node) string {
+	var buf bytes.Buffer
+	writeSExpr(&buf, reflect.ValueOf(node))
+	return buf.String()
+}
+
+func writeSExpr(buf *bytes.Buffer, v reflect.Value) {
+	if isEmpty(v) && v.Kind() != reflect.Bool {
+		buf.WriteString("nil")
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		writeSExpr(buf, v.Elem())
+	case reflect.Ptr:
+		buf.WriteString("(" + v.Elem().Type().Name())
+		writeSExprFields(buf, v.Elem(), true)
+		buf.WriteString(")")
+	case reflect.Slice:
+		buf.WriteString("[")
+		for idx := 0; idx < v.Len(); idx++ {
+			if idx > 0 {
+				buf.WriteString(" ")
+			}
+			writeSExpr(buf, v.Index(idx))
+		}
+		buf.WriteString("]")
+	case reflect.Struct:
+		buf.WriteString("(")
+		writeSExprFields(buf, v, false)
+		buf.WriteString(")")
+	default:
+		buf.WriteString(formatScalar(v))
+	}
+}
+
+// writeSExprFields writes the fields of the struct v, preceded by a space if
+// they follow something else in the list.
+func writeSExprFields(buf *bytes.Buffer, v reflect.Value, space bool) {
+	for _, field := range dumpFields(v) {
+		if space {
+			buf.WriteString(" ")
+		}
+		space = true
+
+		buf.WriteString(":" + field.name + " ")
+		writeSExpr(buf, field.value)
+	}
+}
+
+// Dot returns node as a Graphviz graph. Each node is a box labelled with its
+// kind and scalar fields, with edges to its children labelled with the fields
+// they're in.
+func Dot(node Node) string {
+	d := &dotWriter{}
+	d.buf.WriteString("digraph AST {\n")
+	d.buf.WriteString("\tnode [shape=box];\n")
+	d.node(reflect.ValueOf(node), d.newID())
+	d.buf.WriteString("}\n")
+	return d.buf.String()
+}
+
+type dotWriter struct {
+	buf   bytes.Buffer
+	count int
+}
+
+// dotChild is a child node and the path of the field it's in, like
+// "arguments[0]".
+type dotChild struct {
+	path  string
+	value reflect.Value
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+func (d *dotWriter) newID() string {
+	id := fmt.Sprintf("n%d", d.count)
+	d.count++
+	return id
+}
+
+// node writes out the node in v with the given id, followed by its children.
+func (d *dotWriter) node(v reflect.Value, id string) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	lines := []string{v.Elem().Type().Name()}
+	children := []dotChild{}
+	for _, field := range dumpFields(v.Elem()) {
+		d.collect(field.name, field.value, &lines, &children)
+	}
+	fmt.Fprintf(&d.buf, "\t%s [label=%s];\n", id, dotQuote(strings.Join(lines, "\n")))
+
+	for _, child := range children {
+		childID := d.newID()
+		fmt.Fprintf(&d.buf, "\t%s -> %s [label=%s];\n", id, childID, dotQuote(child.path))
+		d.node(child.value, childID)
+	}
+}
+
+// collect adds the value at path to the label lines if it's a scalar, or to
+// children if it holds nodes.
+func (d *dotWriter) collect(path string, v reflect.Value, lines *[]string, children *[]dotChild) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			*lines = append(*lines, path+": nil")
+			return
+		}
+		*children = append(*children, dotChild{path, v})
+	case reflect.Slice:
+		if v.Len() == 0 {
+			*lines = append(*lines, path+": []")
+		}
+		for idx := 0; idx < v.Len(); idx++ {
+			d.collect(fmt.Sprintf("%s[%d]", path, idx), v.Index(idx), lines, children)
+		}
+	case reflect.Struct:
+		for _, field := range dumpFields(v) {
+			d.collect(path+"."+field.name, field.value, lines, children)
+		}
+	default:
+		*lines = append(*lines, path+": "+formatScalar(v))
+	}
+}
@@ -0,0 +1,112 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+// dumpSample is `{"a": xs?.[-1], ...rest}`.
+func dumpSample() Node {
+	return &HashLiteral{
+		Token: token.Token{Type: token.LBRACE, Literal: "{"},
+		Pairs: []HashPair{
+			{
+				Key: &StringLiteral{Value: "a"},
+				Value: &IndexExpression{
+					Left:     &Identifier{Value: "xs"},
+					Index:    &PrefixExpression{Operator: "-", Right: &IntegerLiteral{Value: 1}},
+					Optional: true,
+				},
+			},
+			{Key: &SpreadElement{Value: &Identifier{Value: "rest"}}},
+		},
+	}
+}
+
+func TestSExpr(t *testing.T) {
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{&Identifier{Value: "x"}, `(Identifier :value "x")`},
+		{&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{}}, `(CallExpression :function (Identifier :value "f") :arguments [])`},
+		{&EnumVariant{Name: &Identifier{Value: "None"}}, `(EnumVariant :name (Identifier :value "None"))`},
+		{
+			dumpSample(),
+			`(HashLiteral :pairs [(:key (StringLiteral :value "a") :value (IndexExpression ` +
+				`:left (Identifier :value "xs") :index (PrefixExpression :operator "-" ` +
+				`:right (IntegerLiteral :value 1)) :optional true)) ` +
+				`(:key (SpreadElement :value (Identifier :value "rest")))])`,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := SExpr(tt.node); got != tt.expected {
+			t.Errorf("wrong S-expression.\nexpected=%s\ngot=     %s", tt.expected, got)
+		}
+	}
+}
+
+func TestDot(t *testing.T) {
+	expected := `digraph AST {
+	node [shape=box];
+	n0 [label="HashLiteral"];
+	n0 -> n1 [label="pairs[0].key"];
+	n1 [label="StringLiteral\nvalue: \"a\""];
+	n0 -> n2 [label="pairs[0].value"];
+	n2 [label="IndexExpression\noptional: true"];
+	n2 -> n3 [label="left"];
+	n3 [label="Identifier\nvalue: \"xs\""];
+	n2 -> n4 [label="index"];
+	n4 [label="PrefixExpression\noperator: \"-\""];
+	n4 -> n5 [label="right"];
+	n5 [label="IntegerLiteral\nvalue: 1"];
+	n0 -> n6 [label="pairs[1].key"];
+	n6 [label="SpreadElement"];
+	n6 -> n7 [label="value"];
+	n7 [label="Identifier\nvalue: \"rest\""];
+}
+`
+	if got := Dot(dumpSample()); got != expected {
+		t.Errorf("wrong graph.\nexpected=%s\ngot=     %s", expected, got)
+	}
+}
+
+func TestDumpAllNodes(t *testing.T) {
+	for _, node := range allNodes {
+		typ := reflect.TypeOf(node).Elem()
+		sample := reflect.New(typ)
+		fillChildren(sample.Elem())
+
+		nodes := 0
+		Inspect(sample.Interface().(Node), func(n Node) bool {
+			if n != nil {
+				nodes++
+			}
+			return true
+		})
+
+		sexpr := SExpr(sample.Interface().(Node))
+		if !strings.HasPrefix(sexpr, "("+typ.Name()) {
+			t.Errorf("S-expression of %s doesn't start with its kind. got=%s", typ.Name(), sexpr)
+		}
+		// struct fields like hash pairs are lists without a kind
+		if got := strings.Count(sexpr, "(") - strings.Count(sexpr, "(:"); got != nodes {
+			t.Errorf("wrong number of nodes in the S-expression of %s. expected=%d, got=%d: %s",
+				typ.Name(), nodes, got, sexpr)
+		}
+
+		dot := Dot(sample.Interface().(Node))
+		if got := strings.Count(dot, " [label=") - strings.Count(dot, " -> "); got != nodes {
+			t.Errorf("wrong number of nodes in the graph of %s. expected=%d, got=%d:\n%s",
+				typ.Name(), nodes, got, dot)
+		}
+		if got := strings.Count(dot, " -> "); got != nodes-1 {
+			t.Errorf("wrong number of edges in the graph of %s. expected=%d, got=%d:\n%s",
+				typ.Name(), nodes-1, got, dot)
+		}
+	}
+}
@@ -13,14 +13,31 @@ type Expression interface {
 	expressionNode()
 }
 
+// Identifier is a name. Type is only set for annotated let bindings and
+// function parameters. Local is set by the resolver if the name is a local
+// variable, and is nil for globals, which are looked up by name.
 type Identifier struct {
 	Token token.Token
 	Value string
+	Type  TypeNode
+	Local *Local
+}
+
+// Local is where a local variable is stored: in slot Slot of the scope Depth
+// scopes out from the one the identifier is in.
+type Local struct {
+	Depth int
+	Slot  int
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
-func (i *Identifier) String() string       { return i.Value }
+func (i *Identifier) String() string {
+	if i.Type != nil {
+		return i.Value + ": " + i.Type.String()
+	}
+	return i.Value
+}
 
 type IntegerLiteral struct {
 	Token token.Token
@@ -89,23 +106,26 @@ func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
-	out.WriteString(ie.TokenLiteral())
+	out.WriteString(ie.TokenLiteral() + " (")
 	out.WriteString(ie.Condition.String())
-	out.WriteString(" ")
-	out.WriteString(ie.Consequence.String())
+	out.WriteString(") ")
+	out.WriteString(ie.Consequence.braced())
 
 	if ie.Alternative != nil {
 		out.WriteString(" else ")
-		out.WriteString(ie.Alternative.String())
+		out.WriteString(ie.Alternative.braced())
 	}
 
 	return out.String()
 }
 
 type FunctionLiteral struct {
-	Token      token.Token
-	Parameters []*Identifier
-	Body       *BlockStatement
+	Token       token.Token
+	Name        *Identifier // set for class methods and named functions
+	IsGenerator bool
+	Parameters  []*Identifier
+	ReturnType  TypeNode
+	Body        *BlockStatement
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -119,10 +139,46 @@ func (fl *FunctionLiteral) String() string {
 	}
 
 	out.WriteString(fl.TokenLiteral())
+	if fl.IsGenerator {
+		out.WriteString("*")
+	}
+	if fl.Name != nil {
+		out.WriteString(" " + fl.Name.String())
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(")")
-	out.WriteString(fl.Body.String())
+	if fl.ReturnType != nil {
+		out.WriteString(" -> " + fl.ReturnType.String())
+	}
+	out.WriteString(" " + fl.Body.braced())
+
+	return out.String()
+}
+
+// MacroLiteral is only valid as the value of a top-level let, which defines the
+// macro before the program is evaluated.
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, param := range ml.Parameters {
+		params = append(params, param.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.braced())
 
 	return out.String()
 }
@@ -131,6 +187,7 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Optional  bool // f?.(x)
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -139,6 +196,9 @@ func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ce.Function.String())
+	if ce.Optional {
+		out.WriteString("?.")
+	}
 
 	args := []string{}
 	for _, arg := range ce.Arguments {
@@ -158,7 +218,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
-func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return `"` + sl.Value + `"` }
 
 type ArrayLiteral struct {
 	Token    token.Token
@@ -182,10 +242,83 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// ArrayComprehension evaluates Element for each binding of its clauses, like
+// [x * 2 for x in xs if x > 0].
+type ArrayComprehension struct {
+	Token   token.Token
+	Element Expression
+	Clauses []*ComprehensionClause
+}
+
+func (ac *ArrayComprehension) expressionNode()      {}
+func (ac *ArrayComprehension) TokenLiteral() string { return ac.Token.Literal }
+func (ac *ArrayComprehension) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("[")
+	out.WriteString(ac.Element.String())
+	for _, clause := range ac.Clauses {
+		out.WriteString(" " + clause.String())
+	}
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// HashComprehension evaluates Key and Value for each binding of its clauses,
+// like {k: v for [k, v] in pairs}.
+type HashComprehension struct {
+	Token   token.Token
+	Key     Expression
+	Value   Expression
+	Clauses []*ComprehensionClause
+}
+
+func (hc *HashComprehension) expressionNode()      {}
+func (hc *HashComprehension) TokenLiteral() string { return hc.Token.Literal }
+func (hc *HashComprehension) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("{")
+	out.WriteString(hc.Key.String() + ": " + hc.Value.String())
+	for _, clause := range hc.Clauses {
+		out.WriteString(" " + clause.String())
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// ComprehensionClause binds Pattern to each element of Iterable, skipping the
+// elements for which Condition is falsy. Condition is nil if there's no filter.
+type ComprehensionClause struct {
+	Token     token.Token
+	Pattern   Expression
+	Iterable  Expression
+	Condition Expression
+}
+
+func (cc *ComprehensionClause) TokenLiteral() string { return cc.Token.Literal }
+func (cc *ComprehensionClause) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cc.Token.Literal + " ")
+	out.WriteString(cc.Pattern.String())
+	out.WriteString(" in ")
+	out.WriteString(cc.Iterable.String())
+	if cc.Condition != nil {
+		out.WriteString(" if ")
+		out.WriteString(cc.Condition.String())
+	}
+
+	return out.String()
+}
+
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Optional bool // a?.[i]
 }
 
 func (ie *IndexExpression) expressionNode()      {}
@@ -195,6 +328,9 @@ func (ie *IndexExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
@@ -202,19 +338,141 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+type MemberExpression struct {
+	Token    token.Token
+	Object   Expression
+	Property *Identifier
+	Optional bool // a?.b
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	if me.Optional {
+		out.WriteString("?.")
+	} else {
+		out.WriteString(".")
+	}
+	out.WriteString(me.Property.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+type AssignExpression struct {
+	Token  token.Token
+	Target Expression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+type YieldExpression struct {
+	Token token.Token
+	Value Expression // nil for a bare yield
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string {
+	if ye.Value == nil {
+		return ye.TokenLiteral()
+	}
+	return "(" + ye.TokenLiteral() + " " + ye.Value.String() + ")"
+}
+
+// SpawnExpression runs a call on its own goroutine. Call is either a call
+// expression or a function that's called without arguments.
+type SpawnExpression struct {
+	Token token.Token
+	Call  Expression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string {
+	return "(" + se.TokenLiteral() + " " + se.Call.String() + ")"
+}
+
+// RangeExpression is a range of integers from Start to End, which is included
+// unless the range is Exclusive. Step is nil when it isn't given.
+type RangeExpression struct {
+	Token     token.Token
+	Start     Expression
+	End       Expression
+	Step      Expression
+	Exclusive bool
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RangeExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(re.Start.String())
+	out.WriteString(re.TokenLiteral())
+	out.WriteString(re.End.String())
+	if re.Step != nil {
+		out.WriteString(" step ")
+		out.WriteString(re.Step.String())
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// SpreadElement expands Value into the enclosing array literal, argument list
+// or hash literal.
+type SpreadElement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (se *SpreadElement) expressionNode()      {}
+func (se *SpreadElement) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadElement) String() string       { return se.TokenLiteral() + se.Value.String() }
+
+// HashPair is an entry of a hash literal. Spread entries have a *SpreadElement
+// Key and a nil Value.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
 type HashLiteral struct {
 	Token token.Token
-	Pairs map[Expression]Expression
+	Pairs []HashPair
 }
 
-func (hl *HashLiteral) expressionNode() {}
+func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", key.String(), value.String()))
+	for _, pair := range hl.Pairs {
+		if pair.Value == nil {
+			pairs = append(pairs, pair.Key.String())
+			continue
+		}
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.String(), pair.Value.String()))
 	}
 
 	out.WriteString("{")
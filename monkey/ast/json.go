@@ -0,0 +1,411 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"unicode"
+
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+// The JSON form of a node is an object with a "kind" naming its type, like
+// "InfixExpression", and its fields under their names in lower camel case.
+// Nodes with a token also have a "pos" with the token's line and column, and a
+// "token" with its type and literal:
+//
+//	{"kind": "PrefixExpression", "pos": {"line": 1, "column": 1},
+//	 "token": {"type": "-", "literal": "-"}, "operator": "-", "right": ...}
+//
+// Nil nodes and slices are null. Hash pairs are objects with a "key" and a
+// "value". When decoding, "pos" and "token" are optional, so programs can be
+// written by hand; a missing token is derived from the node.
+
+// nodeKinds maps the kind of each node type to the type.
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{}, &BlockStatement{}, &LetStatement{}, &ReturnStatement{},
+		&ExpressionStatement{}, &StructStatement{}, &StructField{},
+		&ClassStatement{}, &EnumStatement{}, &EnumVariant{},
+		&SelectStatement{}, &SelectCase{},
+		&Identifier{}, &IntegerLiteral{}, &StringLiteral{}, &Boolean{},
+		&PrefixExpression{}, &InfixExpression{}, &IfExpression{},
+		&FunctionLiteral{}, &MacroLiteral{}, &CallExpression{},
+		&ArrayLiteral{}, &HashLiteral{}, &ArrayComprehension{},
+		&HashComprehension{}, &ComprehensionClause{}, &IndexExpression{},
+		&MemberExpression{}, &AssignExpression{}, &YieldExpression{},
+		&SpawnExpression{}, &RangeExpression{}, &SpreadElement{},
+		&NamedType{}, &ArrayType{}, &HashType{}, &FunctionType{},
+	} {
+		typ := reflect.TypeOf(node).Elem()
+		nodeKinds[typ.Name()] = typ
+	}
+}
+
+var (
+	nodeInterface = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType     = reflect.TypeOf(token.Token{})
+)
+
+// MarshalJSON returns the JSON form of node.
+func MarshalJSON(node Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, reflect.ValueOf(node)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON returns the node whose JSON form is data.
+func UnmarshalJSON(data []byte) (Node, error) {
+	var node Node
+	if err := decodeNode(data, &node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return MarshalJSON(p)
+}
+
+func (p *Program) UnmarshalJSON(data []byte) error {
+	node, err := UnmarshalJSON(data)
+	if err != nil {
+		return err
+	}
+	program, ok := node.(*Program)
+	if !ok {
+		return fmt.Errorf("expected a Program, got %s", kindOf(node))
+	}
+	*p = *program
+	return nil
+}
+
+func kindOf(node Node) string {
+	return reflect.TypeOf(node).Elem().Name()
+}
+
+func jsonName(field string) string {
+	runes := []rune(field)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Kind() == reflect.Interface || !v.Type().Implements(nodeInterface) {
+			return encodeValue(buf, v.Elem())
+		}
+		return encodeNode(buf, v)
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		buf.WriteByte('[')
+		for idx := 0; idx < v.Len(); idx++ {
+			if idx > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeValue(buf, v.Index(idx)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case reflect.Struct:
+		buf.WriteByte('{')
+		if err := encodeFields(buf, v, false); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+		return nil
+	default:
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+}
+
+func encodeNode(buf *bytes.Buffer, v reflect.Value) error {
+	kind := v.Elem().Type().Name()
+	if _, ok := nodeKinds[kind]; !ok {
+		return fmt.Errorf("can't encode %s as a node", v.Type())
+	}
+
+	buf.WriteString(`{"kind":`)
+	writeJSONString(buf, kind)
+	if err := encodeFields(buf, v.Elem(), true); err != nil {
+		return err
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// writeJSONString writes s as a JSON string. Bytes that aren't valid UTF-8 are
+// written as U+FFFD, as encoding/json does.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	data, _ := json.Marshal(s)
+	buf.Write(data)
+}
+
+// encodeFields writes the fields of the struct v, preceded by a comma if they
+// follow other members.
+func encodeFields(buf *bytes.Buffer, v reflect.Value, comma bool) error {
+	for idx := 0; idx < v.NumField(); idx++ {
+		if comma {
+			buf.WriteByte(',')
+		}
+		comma = true
+
+		field := v.Field(idx)
+		if field.Type() == tokenType {
+			tok := field.Interface().(token.Token)
+			fmt.Fprintf(buf, `"pos":{"line":%d,"column":%d},`, tok.Line, tok.Column)
+			buf.WriteString(`"token":{"type":`)
+			writeJSONString(buf, string(tok.Type))
+			buf.WriteString(`,"literal":`)
+			writeJSONString(buf, tok.Literal)
+			buf.WriteByte('}')
+			continue
+		}
+
+		writeJSONString(buf, jsonName(v.Type().Field(idx).Name))
+		buf.WriteByte(':')
+		if err := encodeValue(buf, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+}
+
+// decodeNode decodes the node in data into target, which must be a pointer to
+// a field that can hold it.
+func decodeNode(data []byte, target interface{}) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	if members == nil {
+		return nil
+	}
+
+	var kind string
+	if err := json.Unmarshal(members["kind"], &kind); err != nil || kind == "" {
+		return fmt.Errorf("node without a kind: %s", data)
+	}
+	typ, ok := nodeKinds[kind]
+	if !ok {
+		return fmt.Errorf("unknown node kind %q", kind)
+	}
+	delete(members, "kind")
+
+	node := reflect.New(typ)
+	if err := decodeFields(node.Elem(), members); err != nil {
+		return fmt.Errorf("%s: %w", kind, err)
+	}
+
+	dest := reflect.ValueOf(target).Elem()
+	if !node.Type().AssignableTo(dest.Type()) {
+		return fmt.Errorf("expected %s, got %s", describeType(dest.Type()), kind)
+	}
+	dest.Set(node)
+	return nil
+}
+
+func describeType(typ reflect.Type) string {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem().Name()
+	}
+	return typ.Name()
+}
+
+// decodeFields decodes the fields of the struct v from members, which must not
+// include any other members.
+func decodeFields(v reflect.Value, members map[string]json.RawMessage) error {
+	hasToken := false
+	for idx := 0; idx < v.NumField(); idx++ {
+		field := v.Field(idx)
+		if field.Type() == tokenType {
+			hasToken = true
+			if err := decodeToken(field, members); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := jsonName(v.Type().Field(idx).Name)
+		data, ok := members[name]
+		delete(members, name)
+		if !ok {
+			continue
+		}
+		if err := decodeValue(data, field); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	for name := range members {
+		return fmt.Errorf("unknown field %q", name)
+	}
+
+	if field := v.FieldByName("Token"); hasToken && field.Interface().(token.Token).Type == "" {
+		pos := field.Interface().(token.Token)
+		tok := defaultToken(v.Addr().Interface().(Node))
+		tok.Line, tok.Column = pos.Line, pos.Column
+		field.Set(reflect.ValueOf(tok))
+	}
+	return nil
+}
+
+func decodeToken(field reflect.Value, members map[string]json.RawMessage) error {
+	var tok token.Token
+	if data, ok := members["pos"]; ok {
+		var pos jsonPos
+		if err := json.Unmarshal(data, &pos); err != nil {
+			return fmt.Errorf("pos: %w", err)
+		}
+		tok.Line, tok.Column = pos.Line, pos.Column
+	}
+	if data, ok := members["token"]; ok {
+		var jt jsonToken
+		if err := json.Unmarshal(data, &jt); err != nil {
+			return fmt.Errorf("token: %w", err)
+		}
+		tok.Type, tok.Literal = jt.Type, jt.Literal
+	}
+	delete(members, "pos")
+	delete(members, "token")
+	field.Set(reflect.ValueOf(tok))
+	return nil
+}
+
+func decodeValue(data []byte, v reflect.Value) error {
+	switch {
+	case v.Type().Implements(nodeInterface):
+		return decodeNode(data, v.Addr().Interface())
+	case v.Kind() == reflect.Slice:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return err
+		}
+		if elems == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		slice := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for idx, elem := range elems {
+			if err := decodeValue(elem, slice.Index(idx)); err != nil {
+				return fmt.Errorf("[%d]: %w", idx, err)
+			}
+		}
+		v.Set(slice)
+		return nil
+	case v.Kind() == reflect.Struct:
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(data, &members); err != nil {
+			return err
+		}
+		return decodeFields(v, members)
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+}
+
+// fixedTokens are the tokens of the nodes that always start with the same
+// token.
+var fixedTokens = map[string]token.Token{
+	"BlockStatement":      {Type: token.LBRACE, Literal: "{"},
+	"LetStatement":        {Type: token.LET, Literal: "let"},
+	"ReturnStatement":     {Type: token.RETURN, Literal: "return"},
+	"StructStatement":     {Type: token.STRUCT, Literal: "struct"},
+	"ClassStatement":      {Type: token.CLASS, Literal: "class"},
+	"EnumStatement":       {Type: token.ENUM, Literal: "enum"},
+	"SelectStatement":     {Type: token.SELECT, Literal: "select"},
+	"SelectCase":          {Type: token.CASE, Literal: "case"},
+	"IfExpression":        {Type: token.IF, Literal: "if"},
+	"FunctionLiteral":     {Type: token.FUNCTION, Literal: "fn"},
+	"MacroLiteral":        {Type: token.MACRO, Literal: "macro"},
+	"CallExpression":      {Type: token.LPAREN, Literal: "("},
+	"ArrayLiteral":        {Type: token.LBRACKET, Literal: "["},
+	"HashLiteral":         {Type: token.LBRACE, Literal: "{"},
+	"ArrayComprehension":  {Type: token.LBRACKET, Literal: "["},
+	"HashComprehension":   {Type: token.LBRACE, Literal: "{"},
+	"ComprehensionClause": {Type: token.FOR, Literal: "for"},
+	"IndexExpression":     {Type: token.LBRACKET, Literal: "["},
+	"MemberExpression":    {Type: token.DOT, Literal: "."},
+	"AssignExpression":    {Type: token.ASSIGN, Literal: "="},
+	"YieldExpression":     {Type: token.YIELD, Literal: "yield"},
+	"SpawnExpression":     {Type: token.SPAWN, Literal: "spawn"},
+	"SpreadElement":       {Type: token.ELLIPSIS, Literal: "..."},
+	"ArrayType":           {Type: token.LBRACKET, Literal: "["},
+	"HashType":            {Type: token.LBRACE, Literal: "{"},
+	"FunctionType":        {Type: token.FUNCTION, Literal: "fn"},
+}
+
+// defaultToken returns the token the parser would have given node.
+func defaultToken(node Node) token.Token {
+	switch node := node.(type) {
+	case *Identifier:
+		return token.Token{Type: token.IDENT, Literal: node.Value}
+	case *NamedType:
+		return token.Token{Type: token.IDENT, Literal: node.Name}
+	case *IntegerLiteral:
+		return token.Token{Type: token.INT, Literal: strconv.FormatInt(node.Value, 10)}
+	case *StringLiteral:
+		return token.Token{Type: token.STRING, Literal: node.Value}
+	case *Boolean:
+		if node.Value {
+			return token.Token{Type: token.TRUE, Literal: "true"}
+		}
+		return token.Token{Type: token.FALSE, Literal: "false"}
+	case *PrefixExpression:
+		return operatorToken(node.Operator)
+	case *InfixExpression:
+		return operatorToken(node.Operator)
+	case *RangeExpression:
+		if node.Exclusive {
+			return token.Token{Type: token.RANGE_EXC, Literal: "..<"}
+		}
+		return token.Token{Type: token.RANGE, Literal: ".."}
+	case *ExpressionStatement:
+		if node.Expression != nil {
+			return defaultToken(node.Expression)
+		}
+		return token.Token{}
+	default:
+		return fixedTokens[kindOf(node)]
+	}
+}
+
+// operatorToken returns the token of an operator, which is either a keyword like
+// `in` or a symbol whose token type is itself.
+func operatorToken(operator string) token.Token {
+	if tokenType := token.KeywordOrIdent(operator); tokenType != token.IDENT {
+		return token.Token{Type: tokenType, Literal: operator}
+	}
+	return token.Token{Type: token.TokenType(operator), Literal: operator}
+}
@@ -0,0 +1,202 @@
+package ast
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+func TestNodeKindsIsComplete(t *testing.T) {
+	for _, node := range allNodes {
+		kind := reflect.TypeOf(node).Elem().Name()
+		if _, ok := nodeKinds[kind]; !ok {
+			t.Errorf("nodeKinds is missing %s", kind)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	// -x
+	node := &PrefixExpression{
+		Token:    token.Token{Type: token.MINUS, Literal: "-", Line: 1, Column: 1},
+		Operator: "-",
+		Right: &Identifier{
+			Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 2},
+			Value: "x",
+			Local: &Local{Depth: 1, Slot: 2},
+		},
+	}
+
+	data, err := MarshalJSON(node)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+
+	expected := `{"kind":"PrefixExpression","pos":{"line":1,"column":1},` +
+		`"token":{"type":"-","literal":"-"},"operator":"-","right":` +
+		`{"kind":"Identifier","pos":{"line":1,"column":2},` +
+		`"token":{"type":"IDENT","literal":"x"},"value":"x","type":null,"local":{"depth":1,"slot":2}}}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nexpected=%s\ngot=     %s", expected, data)
+	}
+
+	decoded, err := UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON failed: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, node) {
+		t.Errorf("wrong node decoded from %s", data)
+	}
+}
+
+func TestJSONRoundTripsAllNodes(t *testing.T) {
+	for _, node := range allNodes {
+		typ := reflect.TypeOf(node).Elem()
+		sample := reflect.New(typ)
+		fillChildren(sample.Elem())
+
+		data, err := MarshalJSON(sample.Interface().(Node))
+		if err != nil {
+			t.Errorf("MarshalJSON failed for %s: %s", typ.Name(), err)
+			continue
+		}
+		decoded, err := UnmarshalJSON(data)
+		if err != nil {
+			t.Errorf("UnmarshalJSON failed for %s: %s", typ.Name(), err)
+			continue
+		}
+
+		// the samples have no tokens, so they get default ones when decoded
+		Inspect(sample.Interface().(Node), func(n Node) bool {
+			if n != nil {
+				if field := reflect.ValueOf(n).Elem().FieldByName("Token"); field.IsValid() {
+					field.Set(reflect.ValueOf(defaultToken(n)))
+				}
+			}
+			return true
+		})
+		if !reflect.DeepEqual(decoded, sample.Interface()) {
+			t.Errorf("%s didn't round trip.\nexpected=%#v\ngot=     %#v", typ.Name(), sample.Interface(), decoded)
+		}
+	}
+}
+
+func TestJSONRoundTripsStrings(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"a\x01b", "a\x01b"},
+		{"tab\tnewline\n\x00\x1f\x7f", "tab\tnewline\n\x00\x1f\x7f"},
+		{`"quoted" \ <b>&amp;`, `"quoted" \ <b>&amp;`},
+		{"\u2028\u2029 ünïcödé", "\u2028\u2029 ünïcödé"},
+		// JSON strings hold Unicode, so invalid UTF-8 can't survive the trip
+		{"a\x80b\xff", "a\uFFFDb\uFFFD"},
+	}
+
+	for _, tt := range tests {
+		node := &StringLiteral{
+			Token: token.Token{Type: token.STRING, Literal: tt.value, Line: 1, Column: 1},
+			Value: tt.value,
+		}
+
+		data, err := MarshalJSON(node)
+		if err != nil {
+			t.Errorf("MarshalJSON failed for %q: %s", tt.value, err)
+			continue
+		}
+		if !json.Valid(data) {
+			t.Errorf("invalid JSON for %q: %s", tt.value, data)
+			continue
+		}
+		decoded, err := UnmarshalJSON(data)
+		if err != nil {
+			t.Errorf("UnmarshalJSON failed for %q: %s", tt.value, err)
+			continue
+		}
+
+		str := decoded.(*StringLiteral)
+		if str.Value != tt.expected || str.Token.Literal != tt.expected {
+			t.Errorf("%q didn't round trip. expected=%q, got value=%q, literal=%q",
+				tt.value, tt.expected, str.Value, str.Token.Literal)
+		}
+	}
+}
+
+func TestUnmarshalHandWrittenJSON(t *testing.T) {
+	input := `{"kind": "Program", "statements": [
+		{"kind": "LetStatement",
+		 "name": {"kind": "Identifier", "value": "xs"},
+		 "value": {"kind": "ArrayLiteral", "elements": [
+			{"kind": "IntegerLiteral", "value": 1},
+			{"kind": "RangeExpression", "exclusive": true,
+			 "start": {"kind": "IntegerLiteral", "value": 2},
+			 "end": {"kind": "IntegerLiteral", "value": 5}}
+		 ]}},
+		{"kind": "ReturnStatement", "pos": {"line": 2, "column": 1},
+		 "value": {"kind": "InfixExpression", "operator": "in",
+			"left": {"kind": "Boolean", "value": true},
+			"right": {"kind": "Identifier", "value": "xs"}}}
+	]}`
+
+	var program Program
+	if err := json.Unmarshal([]byte(input), &program); err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+
+	expected := "let xs = [1, (2..<5)];return (true in xs);"
+	if program.String() != expected {
+		t.Errorf("wrong program. expected=%q, got=%q", expected, program.String())
+	}
+
+	ret := program.Statements[1].(*ReturnStatement)
+	if ret.Token.Line != 2 || ret.Token.Column != 1 {
+		t.Errorf("wrong position. got=%d:%d", ret.Token.Line, ret.Token.Column)
+	}
+	infix := ret.Value.(*InfixExpression)
+	if infix.Token.Type != token.IN {
+		t.Errorf("wrong token type for `in`. got=%q", infix.Token.Type)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedErr string
+	}{
+		{`[]`, "cannot unmarshal array"},
+		{`{"statements": []}`, "node without a kind"},
+		{`{"kind": "Nope"}`, `unknown node kind "Nope"`},
+		{`{"kind": "Program", "statement": []}`, `Program: unknown field "statement"`},
+		{
+			`{"kind": "Program", "statements": [{"kind": "IntegerLiteral", "value": 1}]}`,
+			"Program: statements: [0]: expected Statement, got IntegerLiteral",
+		},
+		{
+			`{"kind": "LetStatement", "name": {"kind": "StringLiteral", "value": "x"}}`,
+			"LetStatement: name: expected Identifier, got StringLiteral",
+		},
+		{`{"kind": "IntegerLiteral", "value": "one"}`, "IntegerLiteral: value: json: cannot unmarshal string"},
+		{`{"kind": "Identifier", "pos": 1}`, "Identifier: pos: json: cannot unmarshal number"},
+	}
+
+	for _, tt := range tests {
+		_, err := UnmarshalJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected an error for `%s`", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expectedErr) {
+			t.Errorf("wrong error for `%s`. expected=%q, got=%q", tt.input, tt.expectedErr, err.Error())
+		}
+	}
+
+	var program Program
+	err := json.Unmarshal([]byte(`{"kind": "IntegerLiteral", "value": 1}`), &program)
+	if err == nil || !strings.Contains(err.Error(), "expected a Program, got IntegerLiteral") {
+		t.Errorf("wrong error for a non-program. got=%v", err)
+	}
+}
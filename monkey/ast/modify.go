@@ -0,0 +1,302 @@
+package ast
+
+import "fmt"
+
+// ModifierFunc returns the node to put in place of node.
+type ModifierFunc func(node Node) Node
+
+// Modify returns a copy of node in which each node has been replaced by the
+// result of calling modifier on it, bottom-up, so modifier sees a node once its
+// children have been modified. node itself is left unchanged. A replacement of
+// the wrong kind for its position leaves nil there. Identifiers that name
+// something rather than refer to it, like parameters, are copied rather than
+// modified, though their type annotations are modified.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		n := *node
+		n.Statements = modifyStatements(n.Statements, modifier)
+		return modifier(&n)
+	case *BlockStatement:
+		n := *node
+		n.Statements = modifyStatements(n.Statements, modifier)
+		return modifier(&n)
+	case *ExpressionStatement:
+		n := *node
+		n.Expression = modifyExpression(n.Expression, modifier)
+		return modifier(&n)
+	case *LetStatement:
+		n := *node
+		n.Name = modifyName(n.Name, modifier)
+		n.Pattern = modifyExpression(n.Pattern, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+		return modifier(&n)
+	case *ReturnStatement:
+		n := *node
+		n.Value = modifyExpression(n.Value, modifier)
+		return modifier(&n)
+	case *StructStatement:
+		n := *node
+		n.Name = modifyName(n.Name, modifier)
+		n.Fields = make([]*StructField, len(node.Fields))
+		for idx, field := range node.Fields {
+			n.Fields[idx], _ = Modify(field, modifier).(*StructField)
+		}
+		return modifier(&n)
+	case *StructField:
+		n := *node
+		n.Name = modifyName(n.Name, modifier)
+		n.Default = modifyExpression(n.Default, modifier)
+		return modifier(&n)
+	case *ClassStatement:
+		n := *node
+		n.Name = modifyName(n.Name, modifier)
+		if node.SuperClass != nil {
+			n.SuperClass, _ = Modify(node.SuperClass, modifier).(*Identifier)
+		}
+		n.Methods = make([]*FunctionLiteral, len(node.Methods))
+		for idx, method := range node.Methods {
+			n.Methods[idx], _ = Modify(method, modifier).(*FunctionLiteral)
+		}
+		return modifier(&n)
+	case *EnumStatement:
+		n := *node
+		n.Name = modifyName(n.Name, modifier)
+		n.Variants = make([]*EnumVariant, len(node.Variants))
+		for idx, variant := range node.Variants {
+			n.Variants[idx], _ = Modify(variant, modifier).(*EnumVariant)
+		}
+		return modifier(&n)
+	case *EnumVariant:
+		n := *node
+		n.Name = modifyName(n.Name, modifier)
+		n.Fields = modifyNames(n.Fields, modifier)
+		return modifier(&n)
+	case *SelectStatement:
+		n := *node
+		n.Cases = make([]*SelectCase, len(node.Cases))
+		for idx, sc := range node.Cases {
+			n.Cases[idx], _ = Modify(sc, modifier).(*SelectCase)
+		}
+		n.Default = modifyBlock(n.Default, modifier)
+		return modifier(&n)
+	case *SelectCase:
+		n := *node
+		n.Name = modifyName(n.Name, modifier)
+		if node.Operation != nil {
+			n.Operation, _ = Modify(node.Operation, modifier).(*CallExpression)
+		}
+		n.Body = modifyBlock(n.Body, modifier)
+		return modifier(&n)
+	case *Identifier:
+		n := *node
+		n.Type = modifyType(n.Type, modifier)
+		return modifier(&n)
+	case *IntegerLiteral:
+		n := *node
+		return modifier(&n)
+	case *StringLiteral:
+		n := *node
+		return modifier(&n)
+	case *Boolean:
+		n := *node
+		return modifier(&n)
+	case *PrefixExpression:
+		n := *node
+		n.Right = modifyExpression(n.Right, modifier)
+		return modifier(&n)
+	case *InfixExpression:
+		n := *node
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+		return modifier(&n)
+	case *IfExpression:
+		n := *node
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyBlock(n.Consequence, modifier)
+		n.Alternative = modifyBlock(n.Alternative, modifier)
+		return modifier(&n)
+	case *FunctionLiteral:
+		n := *node
+		n.Name = modifyName(n.Name, modifier)
+		n.Parameters = modifyNames(n.Parameters, modifier)
+		n.ReturnType = modifyType(n.ReturnType, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+		return modifier(&n)
+	case *MacroLiteral:
+		n := *node
+		n.Parameters = modifyNames(n.Parameters, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+		return modifier(&n)
+	case *CallExpression:
+		n := *node
+		n.Function = modifyExpression(n.Function, modifier)
+		n.Arguments = modifyExpressions(n.Arguments, modifier)
+		return modifier(&n)
+	case *ArrayLiteral:
+		n := *node
+		n.Elements = modifyExpressions(n.Elements, modifier)
+		return modifier(&n)
+	case *HashLiteral:
+		n := *node
+		n.Pairs = make([]HashPair, len(node.Pairs))
+		for idx, pair := range node.Pairs {
+			n.Pairs[idx] = HashPair{
+				Key:   modifyExpression(pair.Key, modifier),
+				Value: modifyExpression(pair.Value, modifier),
+			}
+		}
+		return modifier(&n)
+	case *ArrayComprehension:
+		n := *node
+		n.Clauses = modifyClauses(n.Clauses, modifier)
+		n.Element = modifyExpression(n.Element, modifier)
+		return modifier(&n)
+	case *HashComprehension:
+		n := *node
+		n.Clauses = modifyClauses(n.Clauses, modifier)
+		n.Key = modifyExpression(n.Key, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+		return modifier(&n)
+	case *ComprehensionClause:
+		n := *node
+		n.Pattern = modifyExpression(n.Pattern, modifier)
+		n.Iterable = modifyExpression(n.Iterable, modifier)
+		n.Condition = modifyExpression(n.Condition, modifier)
+		return modifier(&n)
+	case *IndexExpression:
+		n := *node
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+		return modifier(&n)
+	case *MemberExpression:
+		n := *node
+		n.Object = modifyExpression(n.Object, modifier)
+		n.Property = modifyName(n.Property, modifier)
+		return modifier(&n)
+	case *AssignExpression:
+		n := *node
+		n.Target = modifyExpression(n.Target, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+		return modifier(&n)
+	case *YieldExpression:
+		n := *node
+		n.Value = modifyExpression(n.Value, modifier)
+		return modifier(&n)
+	case *SpawnExpression:
+		n := *node
+		n.Call = modifyExpression(n.Call, modifier)
+		return modifier(&n)
+	case *RangeExpression:
+		n := *node
+		n.Start = modifyExpression(n.Start, modifier)
+		n.End = modifyExpression(n.End, modifier)
+		n.Step = modifyExpression(n.Step, modifier)
+		return modifier(&n)
+	case *SpreadElement:
+		n := *node
+		n.Value = modifyExpression(n.Value, modifier)
+		return modifier(&n)
+	case *NamedType:
+		n := *node
+		return modifier(&n)
+	case *ArrayType:
+		n := *node
+		n.Element = modifyType(n.Element, modifier)
+		return modifier(&n)
+	case *HashType:
+		n := *node
+		n.Key = modifyType(n.Key, modifier)
+		n.Value = modifyType(n.Value, modifier)
+		return modifier(&n)
+	case *FunctionType:
+		n := *node
+		n.Parameters = make([]TypeNode, len(node.Parameters))
+		for idx, param := range node.Parameters {
+			n.Parameters[idx] = modifyType(param, modifier)
+		}
+		n.Return = modifyType(n.Return, modifier)
+		return modifier(&n)
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", node))
+	}
+}
+
+// modifyExpression modifies an optional expression, leaving nil alone.
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	if exp == nil {
+		return nil
+	}
+	modified, _ := Modify(exp, modifier).(Expression)
+	return modified
+}
+
+func modifyExpressions(exps []Expression, modifier ModifierFunc) []Expression {
+	if exps == nil {
+		return nil
+	}
+	modified := make([]Expression, len(exps))
+	for idx, exp := range exps {
+		modified[idx] = modifyExpression(exp, modifier)
+	}
+	return modified
+}
+
+func modifyStatements(stmts []Statement, modifier ModifierFunc) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	modified := make([]Statement, len(stmts))
+	for idx, stmt := range stmts {
+		modified[idx], _ = Modify(stmt, modifier).(Statement)
+	}
+	return modified
+}
+
+// modifyName copies an optional identifier that names something, modifying
+// only its type annotation, and leaves nil alone.
+func modifyName(ident *Identifier, modifier ModifierFunc) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	n := *ident
+	n.Type = modifyType(n.Type, modifier)
+	return &n
+}
+
+func modifyNames(idents []*Identifier, modifier ModifierFunc) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	modified := make([]*Identifier, len(idents))
+	for idx, ident := range idents {
+		modified[idx] = modifyName(ident, modifier)
+	}
+	return modified
+}
+
+// modifyType modifies an optional type annotation, leaving nil alone.
+func modifyType(typ TypeNode, modifier ModifierFunc) TypeNode {
+	if typ == nil {
+		return nil
+	}
+	modified, _ := Modify(typ, modifier).(TypeNode)
+	return modified
+}
+
+// modifyBlock modifies an optional block, leaving nil alone.
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	modified, _ := Modify(block, modifier).(*BlockStatement)
+	return modified
+}
+
+func modifyClauses(clauses []*ComprehensionClause, modifier ModifierFunc) []*ComprehensionClause {
+	modified := make([]*ComprehensionClause, len(clauses))
+	for idx, clause := range clauses {
+		modified[idx], _ = Modify(clause, modifier).(*ComprehensionClause)
+	}
+	return modified
+}
@@ -0,0 +1,279 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if integer.Value != 1 {
+			return node
+		}
+
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: two()}},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: two()}},
+				},
+			},
+		},
+		{&ReturnStatement{Value: one()}, &ReturnStatement{Value: two()}},
+		{&LetStatement{Value: one()}, &LetStatement{Value: two()}},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: one()}},
+				},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{&ExpressionStatement{Expression: two()}},
+				},
+			},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+		{
+			&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}, {Key: &SpreadElement{Value: one()}}}},
+			&HashLiteral{Pairs: []HashPair{{Key: two(), Value: two()}, {Key: &SpreadElement{Value: two()}}}},
+		},
+		{
+			&ArrayComprehension{
+				Element: one(),
+				Clauses: []*ComprehensionClause{{Pattern: &Identifier{Value: "x"}, Iterable: one(), Condition: one()}},
+			},
+			&ArrayComprehension{
+				Element: two(),
+				Clauses: []*ComprehensionClause{{Pattern: &Identifier{Value: "x"}, Iterable: two(), Condition: two()}},
+			},
+		},
+		{
+			&RangeExpression{Start: one(), End: one(), Step: one()},
+			&RangeExpression{Start: two(), End: two(), Step: two()},
+		},
+		{&RangeExpression{Start: one(), End: one()}, &RangeExpression{Start: two(), End: two()}},
+		{
+			&MemberExpression{Object: one(), Property: &Identifier{Value: "p"}},
+			&MemberExpression{Object: two(), Property: &Identifier{Value: "p"}},
+		},
+		{
+			&AssignExpression{Target: &Identifier{Value: "x"}, Value: one()},
+			&AssignExpression{Target: &Identifier{Value: "x"}, Value: two()},
+		},
+		{&YieldExpression{Value: one()}, &YieldExpression{Value: two()}},
+		{&YieldExpression{}, &YieldExpression{}},
+		{
+			&StructStatement{Fields: []*StructField{{Name: &Identifier{Value: "x"}, Default: one()}}},
+			&StructStatement{Fields: []*StructField{{Name: &Identifier{Value: "x"}, Default: two()}}},
+		},
+		{
+			&SelectStatement{
+				Cases: []*SelectCase{{
+					Operation: &CallExpression{Function: &Identifier{Value: "recv"}, Arguments: []Expression{one()}},
+					Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				}},
+				Default: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&SelectStatement{
+				Cases: []*SelectCase{{
+					Operation: &CallExpression{Function: &Identifier{Value: "recv"}, Arguments: []Expression{two()}},
+					Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				}},
+				Default: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		equal := reflect.DeepEqual(modified, tt.expected)
+		if !equal {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+}
+
+func TestModifyLeavesNodeUnchanged(t *testing.T) {
+	input := &InfixExpression{
+		Left:     &Identifier{Value: "x"},
+		Operator: "+",
+		Right:    &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{&Identifier{Value: "x"}}},
+	}
+	before := input.String()
+
+	modified := Modify(input, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok && ident.Value == "x" {
+			return &IntegerLiteral{Value: 1}
+		}
+		return node
+	})
+
+	if input.String() != before {
+		t.Errorf("input was modified. expected=%q, got=%q", before, input.String())
+	}
+	if modified.String() == before {
+		t.Errorf("modified wasn't changed. got=%q", modified.String())
+	}
+}
+
+func TestModifySkipsDeclaredNames(t *testing.T) {
+	fn := &FunctionLiteral{
+		Name:       &Identifier{Value: "x"},
+		Parameters: []*Identifier{{Value: "x"}},
+		Body: &BlockStatement{Statements: []Statement{
+			&LetStatement{Name: &Identifier{Value: "x"}, Value: &Identifier{Value: "x"}},
+		}},
+	}
+
+	modified := Modify(fn, func(node Node) Node {
+		if _, ok := node.(*Identifier); ok {
+			return &IntegerLiteral{Value: 1}
+		}
+		return node
+	}).(*FunctionLiteral)
+
+	if modified.Name == nil || modified.Name.Value != "x" {
+		t.Errorf("function name was modified. got=%#v", modified.Name)
+	}
+	if modified.Parameters[0] == nil || modified.Parameters[0].Value != "x" {
+		t.Errorf("parameter was modified. got=%#v", modified.Parameters[0])
+	}
+	let := modified.Body.Statements[0].(*LetStatement)
+	if let.Name == nil || let.Name.Value != "x" {
+		t.Errorf("let name was modified. got=%#v", let.Name)
+	}
+	if _, ok := let.Value.(*IntegerLiteral); !ok {
+		t.Errorf("let value wasn't modified. got=%T", let.Value)
+	}
+}
+
+// declaredNames are the children that name something, which Modify copies
+// rather than passing to the modifier.
+var declaredNames = map[string]bool{
+	"LetStatement.Name":             true,
+	"StructStatement.Name":          true,
+	"StructField.Name":              true,
+	"ClassStatement.Name":           true,
+	"EnumStatement.Name":            true,
+	"EnumVariant.Name":              true,
+	"EnumVariant.Fields[0]":         true,
+	"SelectCase.Name":               true,
+	"FunctionLiteral.Name":          true,
+	"FunctionLiteral.Parameters[0]": true,
+	"MacroLiteral.Parameters[0]":    true,
+	"MemberExpression.Property":     true,
+}
+
+func TestModifyReplacesEveryChild(t *testing.T) {
+	for _, node := range allNodes {
+		typ := reflect.TypeOf(node).Elem()
+		parent := reflect.New(typ)
+		children := fillChildren(parent.Elem())
+
+		// the modifier sees the copy of the parent last, once its children
+		// have been replaced
+		var copied Node
+		replacements := map[Node]bool{}
+		modified := Modify(parent.Interface().(Node), func(n Node) Node {
+			copied = n
+			replacement := reflect.New(reflect.TypeOf(n).Elem()).Interface().(Node)
+			replacements[replacement] = true
+			return replacement
+		})
+		if !replacements[modified] {
+			t.Errorf("Modify didn't replace %s", typ.Name())
+			continue
+		}
+
+		for _, child := range children {
+			got := childAt(reflect.ValueOf(copied).Elem(), child.field)
+			if got == child.node {
+				t.Errorf("Modify didn't copy %s.%s", typ.Name(), child.field)
+			}
+			if declaredNames[typ.Name()+"."+child.field] {
+				continue
+			}
+			if got == nil || !replacements[got] {
+				t.Errorf("Modify didn't replace %s.%s", typ.Name(), child.field)
+			}
+		}
+	}
+}
+
+// childAt returns the node in the field of the struct v at path, which is
+// named like the fields of the children fillChildren returns.
+func childAt(v reflect.Value, path string) Node {
+	name, rest, _ := strings.Cut(path, ".")
+	field := v.FieldByName(strings.TrimSuffix(name, "[0]"))
+	if field.Kind() == reflect.Slice {
+		if field.Len() == 0 {
+			return nil
+		}
+		field = field.Index(0)
+	}
+	if rest != "" {
+		return childAt(field, rest)
+	}
+	if field.IsNil() {
+		return nil
+	}
+	return field.Interface().(Node)
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"strings"
 
 	"github.com/jamestrew/go-interpreter/monkey/token"
 )
@@ -11,15 +12,20 @@ type Statement interface {
 	statementNode()
 }
 
+// BlockStatement is a list of statements between braces. Its String() only
+// writes out the statements, and the nodes containing it add the braces.
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
 }
 
+// LetStatement binds Value to Name, or destructures it with Pattern when the
+// left-hand side isn't a plain identifier.
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Expression
+	Value   Expression
 }
 
 type ReturnStatement struct {
@@ -32,16 +38,66 @@ type ExpressionStatement struct {
 	Expression Expression
 }
 
+type StructStatement struct {
+	Token  token.Token
+	Name   *Identifier
+	Fields []*StructField
+}
+
+type ClassStatement struct {
+	Token      token.Token
+	Name       *Identifier
+	SuperClass *Identifier
+	Methods    []*FunctionLiteral
+}
+
+type EnumStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Variants []*EnumVariant
+}
+
+// EnumVariant is a variant of an enum declaration. Fields is nil for variants
+// without a payload.
+type EnumVariant struct {
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+// SelectStatement runs the body of the first of its cases whose channel
+// operation can proceed, or Default if none can and it isn't nil.
+type SelectStatement struct {
+	Token   token.Token
+	Cases   []*SelectCase
+	Default *BlockStatement
+}
+
+// SelectCase is a case of a select statement. Operation is a call to `send` or
+// `recv`, and Name is the identifier a received value is bound to, if any.
+type SelectCase struct {
+	Token     token.Token
+	Name      *Identifier
+	Operation *CallExpression
+	Body      *BlockStatement
+}
+
+// StructField is a field of a struct declaration. Default is nil for fields
+// that must be given when constructing the struct.
+type StructField struct {
+	Name    *Identifier
+	Default Expression
+}
+
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
-func (bs *BlockStatement) String() string {
-	var out bytes.Buffer
+func (bs *BlockStatement) String() string       { return joinStatements(bs.Statements) }
 
-	for _, stmt := range bs.Statements {
-		out.WriteString(stmt.String())
+// braced writes out bs with its braces.
+func (bs *BlockStatement) braced() string {
+	if len(bs.Statements) == 0 {
+		return "{}"
 	}
-
-	return out.String()
+	return "{ " + bs.String() + " }"
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -50,7 +106,11 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -82,3 +142,135 @@ func (es *ExpressionStatement) String() string {
 	}
 	return ""
 }
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, field := range ss.Fields {
+		fields = append(fields, field.String())
+	}
+
+	out.WriteString(ss.TokenLiteral() + " ")
+	out.WriteString(ss.Name.String())
+	if len(fields) == 0 {
+		out.WriteString(" {}")
+	} else {
+		out.WriteString(" { ")
+		out.WriteString(strings.Join(fields, ", "))
+		out.WriteString(" }")
+	}
+
+	return out.String()
+}
+
+func (sf *StructField) TokenLiteral() string { return sf.Name.TokenLiteral() }
+func (sf *StructField) String() string {
+	if sf.Default != nil {
+		return sf.Name.String() + " = " + sf.Default.String()
+	}
+	return sf.Name.String()
+}
+
+func (cs *ClassStatement) statementNode()       {}
+func (cs *ClassStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ClassStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	if cs.SuperClass != nil {
+		out.WriteString(" extends ")
+		out.WriteString(cs.SuperClass.String())
+	}
+	out.WriteString(" {")
+
+	for _, method := range cs.Methods {
+		params := []string{}
+		for _, param := range method.Parameters {
+			params = append(params, param.String())
+		}
+
+		out.WriteString(" ")
+		out.WriteString(method.Name.String())
+		out.WriteString("(")
+		out.WriteString(strings.Join(params, ", "))
+		out.WriteString(")")
+		if method.ReturnType != nil {
+			out.WriteString(" -> " + method.ReturnType.String())
+		}
+		out.WriteString(" " + method.Body.braced())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) String() string {
+	var out bytes.Buffer
+
+	variants := []string{}
+	for _, variant := range es.Variants {
+		variants = append(variants, variant.String())
+	}
+
+	out.WriteString(es.TokenLiteral() + " ")
+	out.WriteString(es.Name.String())
+	if len(variants) == 0 {
+		out.WriteString(" {}")
+	} else {
+		out.WriteString(" { ")
+		out.WriteString(strings.Join(variants, ", "))
+		out.WriteString(" }")
+	}
+
+	return out.String()
+}
+
+func (ev *EnumVariant) TokenLiteral() string { return ev.Name.TokenLiteral() }
+func (ev *EnumVariant) String() string {
+	if ev.Fields == nil {
+		return ev.Name.String()
+	}
+
+	fields := []string{}
+	for _, field := range ev.Fields {
+		fields = append(fields, field.String())
+	}
+	return ev.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
+
+func (ss *SelectStatement) statementNode()       {}
+func (ss *SelectStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SelectStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ss.TokenLiteral() + " {")
+	for _, sc := range ss.Cases {
+		out.WriteString(" " + sc.String())
+	}
+	if ss.Default != nil {
+		out.WriteString(" default " + ss.Default.braced())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+func (sc *SelectCase) TokenLiteral() string { return sc.Token.Literal }
+func (sc *SelectCase) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(sc.Token.Literal + " ")
+	if sc.Name != nil {
+		out.WriteString("let " + sc.Name.String() + " = ")
+	}
+	out.WriteString(sc.Operation.String())
+	out.WriteString(" " + sc.Body.braced())
+
+	return out.String()
+}
@@ -0,0 +1,72 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+// TypeNode is an optional type annotation, such as the `int` in `let x: int = 1`.
+// Annotations are only used by the typecheck package and ignored at runtime.
+type TypeNode interface {
+	Node
+	typeNode()
+}
+
+type NamedType struct {
+	Token token.Token
+	Name  string
+}
+
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) String() string       { return nt.Name }
+
+type ArrayType struct {
+	Token   token.Token
+	Element TypeNode
+}
+
+func (at *ArrayType) typeNode()            {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Literal }
+func (at *ArrayType) String() string       { return "[" + at.Element.String() + "]" }
+
+type HashType struct {
+	Token token.Token
+	Key   TypeNode
+	Value TypeNode
+}
+
+func (ht *HashType) typeNode()            {}
+func (ht *HashType) TokenLiteral() string { return ht.Token.Literal }
+func (ht *HashType) String() string {
+	return "{" + ht.Key.String() + ": " + ht.Value.String() + "}"
+}
+
+type FunctionType struct {
+	Token      token.Token
+	Parameters []TypeNode
+	Return     TypeNode
+}
+
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, param := range ft.Parameters {
+		params = append(params, param.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	if ft.Return != nil {
+		out.WriteString(" -> ")
+		out.WriteString(ft.Return.String())
+	}
+
+	return out.String()
+}
@@ -0,0 +1,219 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called by Walk for each node it encounters. If
+// the visitor w it returns isn't nil, Walk visits each of the node's children
+// with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, visiting children in the order
+// they appear in the source. It starts by calling v.Visit(node), which must
+// not be nil. Every node is visited, including identifiers that name something
+// like parameters, and type annotations.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *LetStatement:
+		walkIdentifier(v, n.Name)
+		walkExpression(v, n.Pattern)
+		walkExpression(v, n.Value)
+	case *ReturnStatement:
+		walkExpression(v, n.Value)
+	case *StructStatement:
+		walkIdentifier(v, n.Name)
+		for _, field := range n.Fields {
+			Walk(v, field)
+		}
+	case *StructField:
+		walkIdentifier(v, n.Name)
+		walkExpression(v, n.Default)
+	case *ClassStatement:
+		walkIdentifier(v, n.Name)
+		walkIdentifier(v, n.SuperClass)
+		for _, method := range n.Methods {
+			Walk(v, method)
+		}
+	case *EnumStatement:
+		walkIdentifier(v, n.Name)
+		for _, variant := range n.Variants {
+			Walk(v, variant)
+		}
+	case *EnumVariant:
+		walkIdentifier(v, n.Name)
+		walkIdentifiers(v, n.Fields)
+	case *SelectStatement:
+		for _, sc := range n.Cases {
+			Walk(v, sc)
+		}
+		walkBlock(v, n.Default)
+	case *SelectCase:
+		walkIdentifier(v, n.Name)
+		if n.Operation != nil {
+			Walk(v, n.Operation)
+		}
+		walkBlock(v, n.Body)
+
+	case *Identifier:
+		walkType(v, n.Type)
+	case *IntegerLiteral, *StringLiteral, *Boolean:
+		// no children
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Consequence)
+		walkBlock(v, n.Alternative)
+	case *FunctionLiteral:
+		walkIdentifier(v, n.Name)
+		walkIdentifiers(v, n.Parameters)
+		walkType(v, n.ReturnType)
+		walkBlock(v, n.Body)
+	case *MacroLiteral:
+		walkIdentifiers(v, n.Parameters)
+		walkBlock(v, n.Body)
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walkExpression(v, pair.Key)
+			walkExpression(v, pair.Value)
+		}
+	case *ArrayComprehension:
+		walkExpression(v, n.Element)
+		walkClauses(v, n.Clauses)
+	case *HashComprehension:
+		walkExpression(v, n.Key)
+		walkExpression(v, n.Value)
+		walkClauses(v, n.Clauses)
+	case *ComprehensionClause:
+		walkExpression(v, n.Pattern)
+		walkExpression(v, n.Iterable)
+		walkExpression(v, n.Condition)
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+	case *MemberExpression:
+		walkExpression(v, n.Object)
+		walkIdentifier(v, n.Property)
+	case *AssignExpression:
+		walkExpression(v, n.Target)
+		walkExpression(v, n.Value)
+	case *YieldExpression:
+		walkExpression(v, n.Value)
+	case *SpawnExpression:
+		walkExpression(v, n.Call)
+	case *RangeExpression:
+		walkExpression(v, n.Start)
+		walkExpression(v, n.End)
+		walkExpression(v, n.Step)
+	case *SpreadElement:
+		walkExpression(v, n.Value)
+
+	case *NamedType:
+		// no children
+	case *ArrayType:
+		walkType(v, n.Element)
+	case *HashType:
+		walkType(v, n.Key)
+		walkType(v, n.Value)
+	case *FunctionType:
+		for _, param := range n.Parameters {
+			walkType(v, param)
+		}
+		walkType(v, n.Return)
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", node))
+	}
+
+	v.Visit(nil)
+}
+
+// The walk helpers skip optional children that are nil, so visitors are never
+// called with a nil node other than to signal the end of a node's children.
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, stmt := range stmts {
+		if stmt != nil {
+			Walk(v, stmt)
+		}
+	}
+}
+
+func walkExpression(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+func walkExpressions(v Visitor, exps []Expression) {
+	for _, exp := range exps {
+		walkExpression(v, exp)
+	}
+}
+
+func walkIdentifier(v Visitor, ident *Identifier) {
+	if ident != nil {
+		Walk(v, ident)
+	}
+}
+
+func walkIdentifiers(v Visitor, idents []*Identifier) {
+	for _, ident := range idents {
+		walkIdentifier(v, ident)
+	}
+}
+
+func walkBlock(v Visitor, block *BlockStatement) {
+	if block != nil {
+		Walk(v, block)
+	}
+}
+
+func walkClauses(v Visitor, clauses []*ComprehensionClause) {
+	for _, clause := range clauses {
+		if clause != nil {
+			Walk(v, clause)
+		}
+	}
+}
+
+func walkType(v Visitor, typ TypeNode) {
+	if typ != nil {
+		Walk(v, typ)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order like Walk, calling f(node) for
+// each node. If f returns true, Inspect calls f for each of the node's children,
+// followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,287 @@
+package ast
+
+import (
+	"fmt"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// allNodes has a value of every node type, so TestWalkVisitsAllChildren can
+// check Walk handles them. TestAllNodesIsComplete checks nothing is missing.
+var allNodes = []Node{
+	&Program{},
+	&BlockStatement{},
+	&LetStatement{},
+	&ReturnStatement{},
+	&ExpressionStatement{},
+	&StructStatement{},
+	&StructField{},
+	&ClassStatement{},
+	&EnumStatement{},
+	&EnumVariant{},
+	&SelectStatement{},
+	&SelectCase{},
+	&Identifier{},
+	&IntegerLiteral{},
+	&StringLiteral{},
+	&Boolean{},
+	&PrefixExpression{},
+	&InfixExpression{},
+	&IfExpression{},
+	&FunctionLiteral{},
+	&MacroLiteral{},
+	&CallExpression{},
+	&ArrayLiteral{},
+	&HashLiteral{},
+	&ArrayComprehension{},
+	&HashComprehension{},
+	&ComprehensionClause{},
+	&IndexExpression{},
+	&MemberExpression{},
+	&AssignExpression{},
+	&YieldExpression{},
+	&SpawnExpression{},
+	&RangeExpression{},
+	&SpreadElement{},
+	&NamedType{},
+	&ArrayType{},
+	&HashType{},
+	&FunctionType{},
+}
+
+func TestAllNodesIsComplete(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("failed to parse package: %s", err)
+	}
+
+	declared := []string{}
+	for _, file := range pkgs["ast"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+				continue
+			}
+			recv := fn.Recv.List[0].Type.(*goast.StarExpr).X.(*goast.Ident)
+			declared = append(declared, recv.Name)
+		}
+	}
+
+	listed := []string{}
+	for _, node := range allNodes {
+		listed = append(listed, reflect.TypeOf(node).Elem().Name())
+	}
+
+	sort.Strings(declared)
+	sort.Strings(listed)
+	if !reflect.DeepEqual(declared, listed) {
+		t.Errorf("allNodes is out of date.\ndeclared=%v\nlisted=  %v", declared, listed)
+	}
+}
+
+func TestWalkVisitsAllChildren(t *testing.T) {
+	for _, node := range allNodes {
+		typ := reflect.TypeOf(node).Elem()
+		parent := reflect.New(typ)
+		children := fillChildren(parent.Elem())
+
+		visited := map[Node]bool{}
+		Inspect(parent.Interface().(Node), func(n Node) bool {
+			if n != nil {
+				visited[n] = true
+			}
+			return true
+		})
+
+		for _, child := range children {
+			if !visited[child.node] {
+				t.Errorf("Walk didn't visit %s.%s", typ.Name(), child.field)
+			}
+		}
+	}
+}
+
+type sampleChild struct {
+	field string
+	node  Node
+}
+
+var (
+	nodeType       = reflect.TypeOf((*Node)(nil)).Elem()
+	expressionType = reflect.TypeOf((*Expression)(nil)).Elem()
+	statementType  = reflect.TypeOf((*Statement)(nil)).Elem()
+	typeNodeType   = reflect.TypeOf((*TypeNode)(nil)).Elem()
+)
+
+// fillChildren sets every field of the struct v that can hold a node to a new
+// node, or to a slice of one, returning the nodes it used.
+func fillChildren(v reflect.Value) []sampleChild {
+	children := []sampleChild{}
+	for idx := 0; idx < v.NumField(); idx++ {
+		field := v.Field(idx)
+		name := v.Type().Field(idx).Name
+
+		switch {
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			elem := reflect.New(field.Type().Elem()).Elem()
+			for _, child := range fillChildren(elem) {
+				child.field = name + "." + child.field
+				children = append(children, child)
+			}
+			field.Set(reflect.Append(field, elem))
+		case field.Kind() == reflect.Slice:
+			if child := sampleNode(field.Type().Elem()); child != nil {
+				field.Set(reflect.Append(field, reflect.ValueOf(child)))
+				children = append(children, sampleChild{name + "[0]", child})
+			}
+		default:
+			if child := sampleNode(field.Type()); child != nil {
+				field.Set(reflect.ValueOf(child))
+				children = append(children, sampleChild{name, child})
+			}
+		}
+	}
+	return children
+}
+
+// sampleNode returns a new node that can be stored in a field of type typ, or
+// nil if the field can't hold a node.
+func sampleNode(typ reflect.Type) Node {
+	switch typ {
+	case expressionType:
+		return &IntegerLiteral{}
+	case statementType:
+		return &ExpressionStatement{}
+	case typeNodeType:
+		return &NamedType{}
+	}
+	if typ.Kind() == reflect.Ptr && typ.Implements(nodeType) {
+		return reflect.New(typ.Elem()).Interface().(Node)
+	}
+	return nil
+}
+
+func TestInspectOrder(t *testing.T) {
+	// let add = fn(x: int) { x + 1 }; add(2)
+	program := &Program{Statements: []Statement{
+		&LetStatement{
+			Name: &Identifier{Value: "add"},
+			Value: &FunctionLiteral{
+				Parameters: []*Identifier{{Value: "x", Type: &NamedType{Name: "int"}}},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &InfixExpression{
+						Left:     &Identifier{Value: "x"},
+						Operator: "+",
+						Right:    &IntegerLiteral{Value: 1},
+					}},
+				}},
+			},
+		},
+		&ExpressionStatement{Expression: &CallExpression{
+			Function:  &Identifier{Value: "add"},
+			Arguments: []Expression{&IntegerLiteral{Value: 2}},
+		}},
+	}}
+
+	expected := []string{
+		"*ast.Program",
+		"*ast.LetStatement",
+		"*ast.Identifier add",
+		"*ast.FunctionLiteral",
+		"*ast.Identifier x",
+		"*ast.NamedType",
+		"*ast.BlockStatement",
+		"*ast.ExpressionStatement",
+		"*ast.InfixExpression",
+		"*ast.Identifier x",
+		"*ast.IntegerLiteral",
+		"*ast.ExpressionStatement",
+		"*ast.CallExpression",
+		"*ast.Identifier add",
+		"*ast.IntegerLiteral",
+	}
+
+	visited := []string{}
+	Inspect(program, func(node Node) bool {
+		if node == nil {
+			return false
+		}
+		desc := fmt.Sprintf("%T", node)
+		if ident, ok := node.(*Identifier); ok {
+			desc += " " + ident.Value
+		}
+		visited = append(visited, desc)
+		return true
+	})
+
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong visiting order.\nexpected=%v\ngot=     %v", expected, visited)
+	}
+}
+
+func TestInspectPrunes(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &FunctionLiteral{
+			Body: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &Identifier{Value: "inner"}},
+			}},
+		}},
+		&ExpressionStatement{Expression: &Identifier{Value: "outer"}},
+	}}
+
+	idents := []string{}
+	Inspect(program, func(node Node) bool {
+		switch node := node.(type) {
+		case *FunctionLiteral:
+			return false
+		case *Identifier:
+			idents = append(idents, node.Value)
+		}
+		return true
+	})
+
+	if len(idents) != 1 || idents[0] != "outer" {
+		t.Errorf("expected only outer to be visited. got=%v", idents)
+	}
+}
+
+type countingVisitor struct {
+	enters, exits *int
+}
+
+func (v countingVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*v.exits++
+	} else {
+		*v.enters++
+	}
+	return v
+}
+
+func TestWalkEndsEachNode(t *testing.T) {
+	// -(1 + 2)
+	node := &PrefixExpression{
+		Operator: "-",
+		Right: &InfixExpression{
+			Left:     &IntegerLiteral{Value: 1},
+			Operator: "+",
+			Right:    &IntegerLiteral{Value: 2},
+		},
+	}
+
+	enters, exits := 0, 0
+	Walk(countingVisitor{&enters, &exits}, node)
+
+	if enters != 4 || exits != 4 {
+		t.Errorf("expected 4 nodes entered and exited. got=%d entered, %d exited", enters, exits)
+	}
+}
@@ -0,0 +1,210 @@
+// Package cache keeps the program of a source file in a .mkyc file next to it,
+// once it's parsed, macro expanded, optimized and resolved, so running the file
+// again can go straight to evaluating it.
+//
+// A cache file holds, with integers in big endian:
+//
+//	magic     "MKYC"
+//	version   uint16, the version of this format
+//	schema    uint32, the ast.SchemaHash of the program that wrote it
+//	build     uint64, the BuildID of the program that wrote it
+//	options   uint8, 1 with legacy block scope and 0 without, then int64, the
+//	          maximum depth, or 0 for none
+//	source    the SHA-256 of the source it was made from
+//	program   the binary form of the program
+//	checksum  uint32, the CRC-32 of everything before it
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+)
+
+const (
+	magic         = "MKYC"
+	formatVersion = 4
+
+	// Extension is the extension of cache files.
+	Extension = ".mkyc"
+)
+
+var (
+	// ErrCorrupt is returned for a cache file that's damaged or isn't one.
+	ErrCorrupt = errors.New("corrupt cache")
+	// ErrStale is returned for a cache file that was made from another
+	// version of its source, with other options, or by another version of
+	// monkey.
+	ErrStale = errors.New("stale cache")
+)
+
+const headerSize = len(magic) + 2 + 4 + 8 + optionsSize + sha256.Size
+
+const optionsSize = 1 + 8
+
+// Options are the evaluator options a program was macro expanded with. The
+// bodies of macros run with them, so the same source can expand to another
+// program under other options.
+type Options struct {
+	LegacyBlockScope bool
+	MaxDepth         int
+}
+
+func (o Options) encode() []byte {
+	data := make([]byte, optionsSize)
+	if o.LegacyBlockScope {
+		data[0] = 1
+	}
+	// any depth of zero or less means there's no limit
+	depth := int64(o.MaxDepth)
+	if depth < 0 {
+		depth = 0
+	}
+	binary.BigEndian.PutUint64(data[1:], uint64(depth))
+	return data
+}
+
+var (
+	buildIDOnce sync.Once
+	buildID     uint64
+)
+
+// BuildID identifies the build of monkey that's running, so a cache written by
+// another build, whose macro expansion, optimizer or resolver may differ, is
+// stale even if the AST schema is the same. It covers the module version and
+// VCS revision the build was made from, and the size and modification time of
+// its executable, which change with every rebuild, even of modified sources.
+func BuildID() uint64 {
+	buildIDOnce.Do(func() {
+		h := fnv.New64a()
+		if info, ok := debug.ReadBuildInfo(); ok {
+			fmt.Fprintln(h, info.GoVersion, info.Main.Path, info.Main.Version)
+			for _, setting := range info.Settings {
+				fmt.Fprintln(h, setting.Key, setting.Value)
+			}
+		}
+		if exe, err := os.Executable(); err == nil {
+			if stat, err := os.Stat(exe); err == nil {
+				fmt.Fprintln(h, stat.Size(), stat.ModTime().UnixNano())
+			}
+		}
+		buildID = h.Sum64()
+	})
+	return buildID
+}
+
+// Path returns the path of the cache file of the source at path: its .mky
+// extension replaced by .mkyc, or .mkyc added if it has another one.
+func Path(path string) string {
+	return strings.TrimSuffix(path, ".mky") + Extension
+}
+
+// Load reads the program cached at path for source, expanded with opts. The error wraps
+// ErrCorrupt or ErrStale if the file can't be used, or is the one that stopped
+// it from being read, like one for which errors.Is(err, fs.ErrNotExist).
+func Load(path string, source []byte, opts Options) (*ast.Program, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data, source, opts)
+}
+
+// Write caches program, made from source with opts, at path. The file is replaced at
+// once, so a run that reads it at the same time sees either the old one or the
+// new one.
+func Write(path string, source []byte, opts Options, program *ast.Program) error {
+	data, err := Encode(source, opts, program)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp makes the file readable only by its owner, unlike a file
+	// made by os.WriteFile
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Encode returns the contents of the cache file of program, made from source
+// with opts.
+func Encode(source []byte, opts Options, program *ast.Program) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.BigEndian, uint16(formatVersion))
+	binary.Write(&buf, binary.BigEndian, ast.SchemaHash())
+	binary.Write(&buf, binary.BigEndian, BuildID())
+	buf.Write(opts.encode())
+	sum := sha256.Sum256(source)
+	buf.Write(sum[:])
+
+	data, err := program.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+// Decode returns the program in data, the contents of a cache file, if it was
+// made from source with opts.
+func Decode(data, source []byte, opts Options) (*ast.Program, error) {
+	if len(data) < headerSize+4 || string(data[:len(magic)]) != magic {
+		return nil, fmt.Errorf("%w: not a cache file", ErrCorrupt)
+	}
+	body, checksum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+
+	header := body[len(magic):headerSize]
+	if version := binary.BigEndian.Uint16(header); version != formatVersion {
+		return nil, fmt.Errorf("%w: format version %d, expected %d", ErrStale, version, formatVersion)
+	}
+	if binary.BigEndian.Uint32(header[2:]) != ast.SchemaHash() {
+		return nil, fmt.Errorf("%w: written by another version of monkey", ErrStale)
+	}
+	if binary.BigEndian.Uint64(header[6:]) != BuildID() {
+		return nil, fmt.Errorf("%w: written by another build of monkey", ErrStale)
+	}
+	if !bytes.Equal(header[14:14+optionsSize], opts.encode()) {
+		return nil, fmt.Errorf("%w: written with other options", ErrStale)
+	}
+	if sum := sha256.Sum256(source); !bytes.Equal(header[14+optionsSize:], sum[:]) {
+		return nil, fmt.Errorf("%w: source has changed", ErrStale)
+	}
+
+	program := &ast.Program{}
+	if err := program.UnmarshalBinary(body[headerSize:]); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	return program, nil
+}
@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/parser"
+)
+
+func parseProgram(t *testing.T, source []byte) *ast.Program {
+	t.Helper()
+
+	program, p := parser.ParseInput(string(source))
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func TestEncodeDecode(t *testing.T) {
+	source := []byte("let x = 1;\nlet f = fn(y) {\n  x + y\n};\nf(2)")
+	program := parseProgram(t, source)
+
+	data, err := Encode(source, Options{}, program)
+	if err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	decoded, err := Decode(data, source, Options{})
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if decoded.String() != program.String() {
+		t.Errorf("wrong program. want=%q, got=%q", program.String(), decoded.String())
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	source := []byte("1 + 2")
+	data, err := Encode(source, Options{}, parseProgram(t, source))
+	if err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+
+	// withChecksum returns data changed by change, with a checksum that
+	// matches, as if it had been written that way
+	withChecksum := func(change func(data []byte)) []byte {
+		changed := append([]byte{}, data...)
+		change(changed)
+		body := changed[:len(changed)-4]
+		binary.BigEndian.PutUint32(changed[len(changed)-4:], crc32.ChecksumIEEE(body))
+		return changed
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		source   []byte
+		expected error
+	}{
+		{"empty", []byte{}, source, ErrCorrupt},
+		{"truncated", data[:len(data)-1], source, ErrCorrupt},
+		{"flipped bit", withBitFlipped(data, len(data)-5), source, ErrCorrupt},
+		{"source changed", data, []byte("1 + 3"), ErrStale},
+		{
+			"old version",
+			withChecksum(func(data []byte) { binary.BigEndian.PutUint16(data[4:], formatVersion-1) }),
+			source, ErrStale,
+		},
+		{
+			"other schema",
+			withChecksum(func(data []byte) { data[6]++ }),
+			source, ErrStale,
+		},
+		{
+			"other build",
+			withChecksum(func(data []byte) { data[10]++ }),
+			source, ErrStale,
+		},
+		{
+			"bad program",
+			withChecksum(func(data []byte) { data[headerSize+2] = 0xff }),
+			source, ErrCorrupt,
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(tt.data, tt.source, Options{})
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: wrong error. want=%v, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func withBitFlipped(data []byte, idx int) []byte {
+	flipped := append([]byte{}, data...)
+	flipped[idx] ^= 1
+	return flipped
+}
+
+func TestWriteLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := Path(filepath.Join(dir, "script.mky"))
+	if path != filepath.Join(dir, "script.mkyc") {
+		t.Fatalf("wrong cache path. got=%q", path)
+	}
+
+	source := []byte("let x = 1")
+	if _, err := Load(path, source, Options{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a missing cache. got=%v", err)
+	}
+
+	if err := Write(path, source, Options{}, parseProgram(t, source)); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	program, err := Load(path, source, Options{})
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	if program.String() != "let x = 1;" {
+		t.Errorf("wrong program loaded. got=%q", program.String())
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %s", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Errorf("wrong cache file mode. want=%o, got=%o", 0o644, mode)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Write left files behind. got=%v", entries)
+	}
+}
+
+func TestLoadOtherOptions(t *testing.T) {
+	// the macro expands to quote(2) with legacy block scope, and quote(1)
+	// without
+	source := []byte("let m = macro() { let r = quote(1); if (true) { let r = quote(2) }; r }; m()")
+	program := parseProgram(t, source)
+
+	tests := []struct {
+		written Options
+		loaded  Options
+	}{
+		{Options{}, Options{LegacyBlockScope: true}},
+		{Options{LegacyBlockScope: true}, Options{}},
+		{Options{MaxDepth: 100}, Options{MaxDepth: 50}},
+		{Options{MaxDepth: 100}, Options{}},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "script.mkyc")
+		if err := Write(path, source, tt.written, program); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+		if _, err := Load(path, source, tt.written); err != nil {
+			t.Errorf("%+v: Load with the same options failed: %s", tt.written, err)
+		}
+		if _, err := Load(path, source, tt.loaded); !errors.Is(err, ErrStale) {
+			t.Errorf("%+v, loaded with %+v: expected a stale cache. got=%v", tt.written, tt.loaded, err)
+		}
+	}
+
+	// no limit is written the same way however it's asked for
+	path := filepath.Join(t.TempDir(), "script.mkyc")
+	if err := Write(path, source, Options{MaxDepth: -1}, program); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	if _, err := Load(path, source, Options{MaxDepth: 0}); err != nil {
+		t.Errorf("Load with no limit failed: %s", err)
+	}
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"script.mky", "script.mkyc"},
+		{"dir/script.mky", "dir/script.mkyc"},
+		{"script.txt", "script.txt.mkyc"},
+		{"script", "script.mkyc"},
+	}
+
+	for _, tt := range tests {
+		if got := Path(tt.input); got != tt.expected {
+			t.Errorf("wrong path for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Package code defines the bytecode instructions run by the vm.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), len(def.OperandWidths))
+	}
+
+	out := def.Name
+	for _, operand := range operands {
+		out += fmt.Sprintf(" %d", operand)
+	}
+	return out
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpDup
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpIn
+	OpMinus
+	OpBang
+
+	OpJump
+	OpJumpNotTruthy
+	OpJumpNull
+	OpJumpNotNull
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpClearLocal
+	OpGetFree
+	OpGetBuiltin
+	OpCaptureLocal
+	OpCaptureFree
+
+	OpClosure
+	OpCall
+	OpTailCall
+	OpApply
+	OpTailApply
+	OpReturnValue
+	OpReturn
+
+	OpArray
+	OpHash
+	OpSpread
+	OpConcat
+	OpSpreadHash
+	OpMerge
+	OpIndex
+	OpMember
+	OpSetMember
+	OpRange
+
+	OpIter
+	OpIterNext
+	OpCollect
+	OpCollectPair
+
+	OpDestructure
+	OpMatchConstructor
+	OpMatchValue
+
+	OpClass
+	OpMethod
+	OpStruct
+	OpEnum
+
+	OpYield
+	OpSpawn
+	OpSelectCase
+	OpSelect
+	OpJumpUnlessCase
+	OpQuote
+)
+
+// Definition describes an opcode: its name, for disassembly, and the width in
+// bytes of each of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	// OpConstant pushes the constant at its operand's index
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpNull:     {"OpNull", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+	OpIn:          {"OpIn", []int{}},
+	OpMinus:       {"OpMinus", []int{}},
+	OpBang:        {"OpBang", []int{}},
+
+	// jumps take four bytes, since deeply nested code can be long
+	OpJump: {"OpJump", []int{4}},
+	// OpJumpNotTruthy pops the condition it tests
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{4}},
+	// OpJumpNull jumps if the top of the stack is null, leaving it there, to
+	// skip the rest of an optional chain
+	OpJumpNull: {"OpJumpNull", []int{4}},
+	// OpJumpNotNull jumps if the top of the stack isn't null, leaving it
+	// there, and pops it otherwise, for the ?? operator
+	OpJumpNotNull: {"OpJumpNotNull", []int{4}},
+
+	// the set opcodes bind a variable, leaving the value on the stack
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	OpGetLocal:  {"OpGetLocal", []int{2}},
+	OpSetLocal:  {"OpSetLocal", []int{2}},
+	// OpClearLocal unsets a local at the end of its scope, so a closure
+	// that captured it keeps the binding while the next pass through the
+	// scope gets a new one
+	OpClearLocal: {"OpClearLocal", []int{2}},
+	OpGetFree:    {"OpGetFree", []int{2}},
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+	// the capture opcodes push the variable itself rather than its value,
+	// for OpClosure to close over
+	OpCaptureLocal: {"OpCaptureLocal", []int{2}},
+	OpCaptureFree:  {"OpCaptureFree", []int{2}},
+
+	// OpClosure makes a closure of the function at its first operand's index,
+	// over the number of captured variables given by the second
+	OpClosure: {"OpClosure", []int{2, 1}},
+	// OpCall calls a function with the number of arguments above it, and
+	// OpApply with the elements of the array above it
+	OpCall:        {"OpCall", []int{1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpApply:       {"OpApply", []int{}},
+	OpTailApply:   {"OpTailApply", []int{}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpArray: {"OpArray", []int{2}},
+	// OpHash's operand counts keys and values
+	OpHash: {"OpHash", []int{2}},
+	// OpSpread turns an iterable into an array of its elements, and OpConcat
+	// joins that many arrays
+	OpSpread: {"OpSpread", []int{}},
+	OpConcat: {"OpConcat", []int{2}},
+	// OpSpreadHash checks that a spread value is a hash, and OpMerge merges
+	// that many hashes
+	OpSpreadHash: {"OpSpreadHash", []int{}},
+	OpMerge:      {"OpMerge", []int{2}},
+	// OpIndex's operand is the constant holding the source of the index
+	// expression, for its error
+	OpIndex: {"OpIndex", []int{2}},
+	// OpMember and OpSetMember's operand is the constant holding the name
+	OpMember:    {"OpMember", []int{2}},
+	OpSetMember: {"OpSetMember", []int{2}},
+	// OpRange's operand has RangeExclusive and RangeStep set as needed
+	OpRange: {"OpRange", []int{1}},
+
+	// OpIterNext pushes the next value of the iterator on top of the stack,
+	// or pops the iterator and jumps once it's exhausted
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{4}},
+	// OpCollect and OpCollectPair add to the result of a comprehension, which
+	// is below the number of iterators given by their operand
+	OpCollect:     {"OpCollect", []int{1}},
+	OpCollectPair: {"OpCollectPair", []int{1}},
+
+	// the pattern opcodes take the number of values to destructure into, if
+	// any, and the constant holding the source of the pattern, for errors
+	OpDestructure:      {"OpDestructure", []int{2, 2}},
+	OpMatchConstructor: {"OpMatchConstructor", []int{2, 2}},
+	OpMatchValue:       {"OpMatchValue", []int{2}},
+
+	// OpClass takes the constant holding the class name and whether there's
+	// a superclass on the stack. OpMethod adds the closure on top of the
+	// stack to the class below it, named by a constant
+	OpClass:  {"OpClass", []int{2, 1}},
+	OpMethod: {"OpMethod", []int{2}},
+	// OpStruct and OpEnum copy the definition in a constant, the struct
+	// taking the functions computing its defaults from the stack
+	OpStruct: {"OpStruct", []int{2}},
+	OpEnum:   {"OpEnum", []int{2}},
+
+	OpYield: {"OpYield", []int{}},
+	// OpSpawn starts the function below an array of arguments as a task
+	OpSpawn: {"OpSpawn", []int{}},
+	// OpSelectCase turns an array of arguments into a channel operation,
+	// sending if its operand is set. OpSelect performs one of that many
+	// operations, or the default if its second operand is set, pushing the
+	// value received and the index of the chosen operation
+	OpSelectCase: {"OpSelectCase", []int{1}},
+	OpSelect:     {"OpSelect", []int{2, 1}},
+	// OpJumpUnlessCase jumps unless the index on top of the stack is its
+	// first operand, which it pops otherwise
+	OpJumpUnlessCase: {"OpJumpUnlessCase", []int{2, 4}},
+	// OpQuote quotes the node in a constant, replacing its calls to unquote
+	// with the number of values on the stack given by its second operand
+	OpQuote: {"OpQuote", []int{2, 1}},
+}
+
+// The flags of OpRange.
+const (
+	RangeExclusive = 1 << iota
+	RangeStep
+)
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction, returning an empty one for an unknown opcode.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction, returning them along
+// with the number of bytes they took.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
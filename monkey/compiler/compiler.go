@@ -0,0 +1,936 @@
+// Package compiler compiles programs to bytecode for the vm.
+//
+// Compiled programs behave as they do in the evaluator, down to their errors,
+// apart from some errors the evaluator only reports once it reaches them, like
+// a duplicate struct field, which stop the whole program from compiling.
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/code"
+	"github.com/jamestrew/go-interpreter/monkey/evaluator"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+type Compiler struct {
+	constants []object.Object
+	// literals is the index of the constant holding each integer and string
+	// already added, so they're only added once
+	literals map[interface{}]int
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	legacyBlockScope bool
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+// Option configures a Compiler.
+type Option func(*Compiler)
+
+// WithLegacyBlockScope compiles blocks into the scope that encloses them, like
+// evaluator.WithLegacyBlockScope.
+func WithLegacyBlockScope() Option {
+	return func(c *Compiler) {
+		c.legacyBlockScope = true
+	}
+}
+
+func New(opts ...Option) *Compiler {
+	symbolTable := NewSymbolTable()
+	for idx, name := range evaluator.BuiltinNames() {
+		symbolTable.DefineBuiltin(idx, name)
+	}
+	return NewWithState(symbolTable, []object.Object{}, opts...)
+}
+
+// NewWithState returns a compiler that carries on from the globals and
+// constants of an earlier one, for compiling the lines of a REPL.
+func NewWithState(s *SymbolTable, constants []object.Object, opts ...Option) *Compiler {
+	c := &Compiler{
+		constants:   constants,
+		literals:    map[interface{}]int{},
+		symbolTable: s,
+		scopes:      []CompilationScope{{}},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Bytecode is a compiled program. Its instructions are the body of the
+// program, which runs in a frame of its own, for the locals of its blocks.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	Globals      []string // the name of each global, by index
+	Locals       []string // the name of each local of the program's frame
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		Globals:      c.symbolTable.Globals(),
+		Locals:       c.symbolTable.Locals(),
+	}
+}
+
+// SymbolTable returns the global symbol table, for compiling the next line of
+// a REPL.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// Compile compiles a program, whose value is that of its last statement.
+func (c *Compiler) Compile(program *ast.Program) error {
+	c.declare(program.Statements)
+	if len(program.Statements) == 0 {
+		c.emit(code.OpReturn)
+		return nil
+	}
+	if err := c.compileStatements(program.Statements, plain); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	return c.checkLimits()
+}
+
+// maxOperand is the largest index the two-byte operands of constants and
+// variables can hold.
+const maxOperand = 1<<16 - 1
+
+func (c *Compiler) checkLimits() error {
+	switch {
+	case len(c.constants) > maxOperand:
+		return fmt.Errorf("too many constants: %d", len(c.constants))
+	case len(c.symbolTable.Globals()) > maxOperand:
+		return fmt.Errorf("too many globals: %d", len(c.symbolTable.Globals()))
+	}
+	return nil
+}
+
+// position is where the statements of a function body are, which decides the
+// calls that are tail calls, made in place of the function's own frame.
+type position int
+
+const (
+	plain  position = iota // not in a function body, so no call is
+	inBody                 // returned calls are
+	inTail                 // the call that's the value of the body is too
+)
+
+// compileStatements leaves the value of the last statement on the stack.
+func (c *Compiler) compileStatements(stmts []ast.Statement, pos position) error {
+	if len(stmts) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	for idx, stmt := range stmts {
+		if idx > 0 {
+			c.emit(code.OpPop)
+		}
+		stmtPos := pos
+		if pos == inTail && idx != len(stmts)-1 {
+			stmtPos = inBody
+		}
+		if err := c.compileStatement(stmt, stmtPos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileStatement(stmt ast.Statement, pos position) error {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		if pos == plain {
+			return c.compileExpression(stmt.Expression)
+		}
+		return c.compileTailExpression(stmt.Expression, pos == inTail)
+	case *ast.LetStatement:
+		return c.compileLetStatement(stmt)
+	case *ast.ReturnStatement:
+		var err error
+		if pos == plain {
+			err = c.compileExpression(stmt.Value)
+		} else {
+			err = c.compileTailExpression(stmt.Value, true)
+		}
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+		return nil
+	case *ast.BlockStatement:
+		return c.compileBlock(stmt, pos)
+	case *ast.StructStatement:
+		return c.compileStructStatement(stmt)
+	case *ast.ClassStatement:
+		return c.compileClassStatement(stmt)
+	case *ast.EnumStatement:
+		return c.compileEnumStatement(stmt)
+	case *ast.SelectStatement:
+		return c.compileSelectStatement(stmt)
+	default:
+		return fmt.Errorf("unknown statement: %T", stmt)
+	}
+}
+
+// compileTailExpression compiles an expression of a function body, looking
+// through if expressions for returned calls and, when tail is set, a call that
+// is the value of the expression.
+func (c *Compiler) compileTailExpression(exp ast.Expression, tail bool) error {
+	pos := inBody
+	if tail {
+		pos = inTail
+	}
+
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		return c.compileChain(exp, tail)
+	case *ast.IfExpression:
+		return c.compileIfExpression(exp, pos)
+	default:
+		return c.compileExpression(exp)
+	}
+}
+
+// compileBlock compiles a block in a scope of its own, unless blocks share the
+// scope that encloses them.
+func (c *Compiler) compileBlock(block *ast.BlockStatement, pos position) error {
+	if c.legacyBlockScope {
+		return c.compileStatements(block.Statements, pos)
+	}
+
+	c.enterBlock()
+	c.declare(block.Statements)
+	if err := c.compileStatements(block.Statements, pos); err != nil {
+		return err
+	}
+	c.leaveBlock()
+	return nil
+}
+
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+// leaveBlock leaves the scope of a block, clearing the locals that closures
+// captured, so the next pass through it binds them anew.
+func (c *Compiler) leaveBlock() {
+	for _, symbol := range c.symbolTable.Captured() {
+		c.emit(code.OpClearLocal, symbol.Index)
+	}
+	c.symbolTable = c.symbolTable.Outer
+}
+
+func (c *Compiler) compileLetStatement(ls *ast.LetStatement) error {
+	if err := c.compileExpression(ls.Value); err != nil {
+		return err
+	}
+
+	if ls.Pattern != nil {
+		c.emit(code.OpDup)
+		return c.compilePattern(ls.Pattern)
+	}
+	c.storeSymbol(c.symbolTable.Define(ls.Name.Value))
+	return nil
+}
+
+func (c *Compiler) compileExpression(exp ast.Expression) error {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: exp.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: exp.Value}))
+	case *ast.Boolean:
+		if exp.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		return c.compilePrefixExpression(exp)
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(exp)
+	case *ast.IfExpression:
+		return c.compileIfExpression(exp, plain)
+	case *ast.Identifier:
+		c.loadSymbol(c.resolve(exp.Value))
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(exp)
+	case *ast.CallExpression, *ast.IndexExpression, *ast.MemberExpression:
+		return c.compileChain(exp, false)
+	case *ast.ArrayLiteral:
+		return c.compileList(exp.Elements)
+	case *ast.HashLiteral:
+		return c.compileHashLiteral(exp)
+	case *ast.ArrayComprehension:
+		return c.compileArrayComprehension(exp)
+	case *ast.HashComprehension:
+		return c.compileHashComprehension(exp)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(exp)
+	case *ast.YieldExpression:
+		return c.compileYieldExpression(exp)
+	case *ast.SpawnExpression:
+		return c.compileSpawnExpression(exp)
+	case *ast.RangeExpression:
+		return c.compileRangeExpression(exp)
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macros can only be defined by a top-level let")
+	default:
+		return fmt.Errorf("unknown expression: %T", exp)
+	}
+	return nil
+}
+
+func (c *Compiler) compilePrefixExpression(pe *ast.PrefixExpression) error {
+	if err := c.compileExpression(pe.Right); err != nil {
+		return err
+	}
+
+	switch pe.Operator {
+	case "!":
+		c.emit(code.OpBang)
+	case "-":
+		c.emit(code.OpMinus)
+	default:
+		return fmt.Errorf("unknown operator %s", pe.Operator)
+	}
+	return nil
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"in": code.OpIn,
+}
+
+func (c *Compiler) compileInfixExpression(ie *ast.InfixExpression) error {
+	if err := c.compileExpression(ie.Left); err != nil {
+		return err
+	}
+
+	// the right side is only evaluated when it's needed
+	if ie.Operator == "??" {
+		jumpPos := c.emit(code.OpJumpNotNull, 9999)
+		if err := c.compileExpression(ie.Right); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	if err := c.compileExpression(ie.Right); err != nil {
+		return err
+	}
+	op, ok := infixOpcodes[ie.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", ie.Operator)
+	}
+	c.emit(op)
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(ie *ast.IfExpression, pos position) error {
+	if err := c.compileExpression(ie.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBlock(ie.Consequence, pos); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	if ie.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlock(ie.Alternative, pos); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileChain compiles a chain of member, index and call expressions, where an
+// optional link that finds null makes the whole chain null.
+func (c *Compiler) compileChain(exp ast.Expression, tail bool) error {
+	skips := []int{}
+	if err := c.compileLink(exp, tail, &skips); err != nil {
+		return err
+	}
+	for _, pos := range skips {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileLink(exp ast.Expression, tail bool, skips *[]int) error {
+	switch exp := exp.(type) {
+	case *ast.MemberExpression:
+		if err := c.compileLink(exp.Object, false, skips); err != nil {
+			return err
+		}
+		if exp.Optional {
+			*skips = append(*skips, c.emit(code.OpJumpNull, 9999))
+		}
+		c.emit(code.OpMember, c.addConstant(&object.String{Value: exp.Property.Value}))
+		return nil
+	case *ast.IndexExpression:
+		if err := c.compileLink(exp.Left, false, skips); err != nil {
+			return err
+		}
+		if exp.Optional {
+			*skips = append(*skips, c.emit(code.OpJumpNull, 9999))
+		}
+		if err := c.compileExpression(exp.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex, c.addConstant(&object.String{Value: exp.String()}))
+		return nil
+	case *ast.CallExpression:
+		return c.compileCall(exp, tail, skips)
+	default:
+		return c.compileExpression(exp)
+	}
+}
+
+// maxArgs is the most arguments OpCall takes. Calls with more are applied to
+// an array of them.
+const maxArgs = 255
+
+func (c *Compiler) compileCall(ce *ast.CallExpression, tail bool, skips *[]int) error {
+	if ident, ok := ce.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+		return c.compileQuote(ce)
+	}
+
+	if err := c.compileLink(ce.Function, false, skips); err != nil {
+		return err
+	}
+	if ce.Optional {
+		*skips = append(*skips, c.emit(code.OpJumpNull, 9999))
+	}
+
+	if !hasSpread(ce.Arguments) && len(ce.Arguments) <= maxArgs {
+		for _, arg := range ce.Arguments {
+			if err := c.compileExpression(arg); err != nil {
+				return err
+			}
+		}
+		if tail {
+			c.emit(code.OpTailCall, len(ce.Arguments))
+		} else {
+			c.emit(code.OpCall, len(ce.Arguments))
+		}
+		return nil
+	}
+
+	if err := c.compileList(ce.Arguments); err != nil {
+		return err
+	}
+	if tail {
+		c.emit(code.OpTailApply)
+	} else {
+		c.emit(code.OpApply)
+	}
+	return nil
+}
+
+func hasSpread(expressions []ast.Expression) bool {
+	for _, exp := range expressions {
+		if _, ok := exp.(*ast.SpreadElement); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileList leaves an array of the values of expressions on the stack. The
+// elements around spreads are collected into arrays of their own, which are
+// then concatenated with the spread ones.
+func (c *Compiler) compileList(expressions []ast.Expression) error {
+	segments, run := 0, 0
+	endRun := func() {
+		if run > 0 || segments == 0 {
+			c.emit(code.OpArray, run)
+			segments++
+			run = 0
+		}
+	}
+
+	for _, exp := range expressions {
+		spread, ok := exp.(*ast.SpreadElement)
+		if !ok {
+			if err := c.compileExpression(exp); err != nil {
+				return err
+			}
+			run++
+			continue
+		}
+
+		if run > 0 {
+			endRun()
+		}
+		if err := c.compileExpression(spread.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpSpread)
+		segments++
+	}
+	if run > 0 || segments == 0 {
+		endRun()
+	}
+
+	if segments > 1 || hasSpread(expressions) {
+		c.emit(code.OpConcat, segments)
+	}
+	return nil
+}
+
+func (c *Compiler) compileHashLiteral(hl *ast.HashLiteral) error {
+	// pairs are evaluated in order, so later keys override earlier ones
+	segments, run := 0, 0
+	spread := false
+	for _, pair := range hl.Pairs {
+		if s, ok := pair.Key.(*ast.SpreadElement); ok {
+			if run > 0 {
+				c.emit(code.OpHash, run*2)
+				segments++
+				run = 0
+			}
+			if err := c.compileExpression(s.Value); err != nil {
+				return err
+			}
+			c.emit(code.OpSpreadHash)
+			segments++
+			spread = true
+			continue
+		}
+
+		if err := c.compileExpression(pair.Key); err != nil {
+			return err
+		}
+		if err := c.compileExpression(pair.Value); err != nil {
+			return err
+		}
+		run++
+	}
+	if run > 0 || segments == 0 {
+		c.emit(code.OpHash, run*2)
+		segments++
+	}
+
+	if spread {
+		c.emit(code.OpMerge, segments)
+	}
+	return nil
+}
+
+func (c *Compiler) compileAssignExpression(ae *ast.AssignExpression) error {
+	target, ok := ae.Target.(*ast.MemberExpression)
+	if !ok {
+		return fmt.Errorf("invalid assignment target: %s", ae.Target.String())
+	}
+	if err := c.compileExpression(target.Object); err != nil {
+		return err
+	}
+	if err := c.compileExpression(ae.Value); err != nil {
+		return err
+	}
+	c.emit(code.OpSetMember, c.addConstant(&object.String{Value: target.Property.Value}))
+	return nil
+}
+
+func (c *Compiler) compileYieldExpression(ye *ast.YieldExpression) error {
+	if ye.Value == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileExpression(ye.Value); err != nil {
+		return err
+	}
+	c.emit(code.OpYield)
+	return nil
+}
+
+func (c *Compiler) compileSpawnExpression(se *ast.SpawnExpression) error {
+	// the arguments of a spawned call are evaluated before the task starts
+	if call, ok := se.Call.(*ast.CallExpression); ok {
+		if err := c.compileExpression(call.Function); err != nil {
+			return err
+		}
+		if err := c.compileList(call.Arguments); err != nil {
+			return err
+		}
+	} else {
+		if err := c.compileExpression(se.Call); err != nil {
+			return err
+		}
+		c.emit(code.OpArray, 0)
+	}
+	c.emit(code.OpSpawn)
+	return nil
+}
+
+func (c *Compiler) compileRangeExpression(re *ast.RangeExpression) error {
+	if err := c.compileExpression(re.Start); err != nil {
+		return err
+	}
+	if err := c.compileExpression(re.End); err != nil {
+		return err
+	}
+
+	flags := 0
+	if re.Exclusive {
+		flags |= code.RangeExclusive
+	}
+	if re.Step != nil {
+		if err := c.compileExpression(re.Step); err != nil {
+			return err
+		}
+		flags |= code.RangeStep
+	}
+	c.emit(code.OpRange, flags)
+	return nil
+}
+
+// compileQuote compiles the arguments of the calls to unquote in a quote, in
+// the order evaluator.Quote asks for their values.
+func (c *Compiler) compileQuote(ce *ast.CallExpression) error {
+	if len(ce.Arguments) != 1 {
+		return fmt.Errorf("wrong number of arguments. got=%d, want=1", len(ce.Arguments))
+	}
+
+	args := []ast.Expression{}
+	stopped := false
+	ast.Modify(ce.Arguments[0], func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || stopped || !isCallTo(call, "unquote") {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			stopped = true
+			return node
+		}
+		args = append(args, call.Arguments[0])
+		return node
+	})
+
+	for _, arg := range args {
+		if err := c.compileExpression(arg); err != nil {
+			return err
+		}
+	}
+	quote := &object.Quote{Node: ce.Arguments[0]}
+	c.emit(code.OpQuote, c.addConstant(quote), len(args))
+	return nil
+}
+
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	var literal interface{}
+	switch obj := obj.(type) {
+	case *object.Integer:
+		literal = obj.Value
+	case *object.String:
+		literal = obj.Value
+	}
+	if literal != nil {
+		if idx, ok := c.literals[literal]; ok {
+			return idx
+		}
+		c.literals[literal] = len(c.constants)
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// changeOperand changes the last operand of the instruction at opPos, which is
+// the jump target of the jumps that take more than one.
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	def, _ := code.Lookup(byte(op))
+	operands, _ := code.ReadOperands(def, c.currentInstructions()[opPos+1:])
+	operands[len(operands)-1] = operand
+
+	c.replaceInstruction(opPos, code.Make(op, operands...))
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+func (c *Compiler) globalTable() *SymbolTable {
+	s := c.symbolTable
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// resolve returns the symbol of name. Names that aren't declared anywhere are
+// globals, which may still be defined by the time they're used.
+func (c *Compiler) resolve(name string) Symbol {
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		return symbol
+	}
+	return c.globalTable().Define(name)
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+// storeSymbol binds a symbol that was just defined to the value on top of the
+// stack.
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) compileFunctionLiteral(fl *ast.FunctionLiteral) error {
+	if err := c.compileFunction(fl, nil); err != nil {
+		return err
+	}
+	if fl.Name != nil {
+		c.storeSymbol(c.symbolTable.Define(fl.Name.Value))
+	}
+	return nil
+}
+
+// compileFunction leaves a closure of fl on the stack. A method of class cs
+// takes self and super in its first two locals, super going unnamed when the
+// class has no superclass.
+func (c *Compiler) compileFunction(fl *ast.FunctionLiteral, cs *ast.ClassStatement) error {
+	c.enterScope()
+
+	if cs != nil {
+		c.symbolTable.Define("self")
+		if cs.SuperClass != nil {
+			c.symbolTable.Define("super")
+		} else {
+			c.symbolTable.Define("")
+		}
+	}
+	for _, param := range fl.Parameters {
+		c.symbolTable.Define(param.Value)
+	}
+	c.declare(fl.Body.Statements)
+
+	// a generator's body runs on its own, so it has no frame to make tail
+	// calls in place of
+	pos := inTail
+	if fl.IsGenerator {
+		pos = plain
+	}
+	if err := c.compileStatements(fl.Body.Statements, pos); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	c.closeFunction(fl, cs != nil)
+	return nil
+}
+
+// closeFunction leaves the scope of the function fl was compiled in, leaving a
+// closure of it on the stack.
+func (c *Compiler) closeFunction(fl *ast.FunctionLiteral, isMethod bool) {
+	freeSymbols := c.symbolTable.FreeSymbols
+	localNames := c.symbolTable.Locals()
+	instructions := c.leaveScope()
+
+	freeNames := []string{}
+	for _, s := range freeSymbols {
+		if s.Scope == LocalScope {
+			c.emit(code.OpCaptureLocal, s.Index)
+		} else {
+			c.emit(code.OpCaptureFree, s.Index)
+		}
+		freeNames = append(freeNames, s.Name)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     len(localNames),
+		NumParameters: len(fl.Parameters),
+		IsMethod:      isMethod,
+		Parameters:    fl.Parameters,
+		Body:          fl.Body,
+		IsGenerator:   fl.IsGenerator,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+}
+
+func (c *Compiler) compileClassStatement(cs *ast.ClassStatement) error {
+	hasSuper := 0
+	if cs.SuperClass != nil {
+		if err := c.compileExpression(cs.SuperClass); err != nil {
+			return err
+		}
+		hasSuper = 1
+	}
+	c.emit(code.OpClass, c.addConstant(&object.String{Value: cs.Name.Value}), hasSuper)
+
+	for _, method := range cs.Methods {
+		if err := c.compileFunction(method, cs); err != nil {
+			return err
+		}
+		c.emit(code.OpMethod, c.addConstant(&object.String{Value: method.Name.Value}))
+	}
+
+	c.storeSymbol(c.symbolTable.Define(cs.Name.Value))
+	return nil
+}
+
+// compileStructStatement compiles the default of each field to a function
+// that computes it, for OpStruct to make a definition from the prototype with.
+func (c *Compiler) compileStructStatement(ss *ast.StructStatement) error {
+	def := &object.StructType{
+		Name:     ss.Name.Value,
+		Fields:   []string{},
+		Defaults: map[string]ast.Expression{},
+	}
+	for _, field := range ss.Fields {
+		if def.HasField(field.Name.Value) {
+			return fmt.Errorf("duplicate field: %s.%s", def.Name, field.Name.Value)
+		}
+		def.Fields = append(def.Fields, field.Name.Value)
+		if field.Default != nil {
+			def.Defaults[field.Name.Value] = field.Default
+		}
+	}
+	prototype := c.addConstant(def)
+
+	for _, field := range ss.Fields {
+		if field.Default == nil {
+			continue
+		}
+		fl := &ast.FunctionLiteral{
+			Token: ss.Token,
+			Body:  &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: field.Default}}},
+		}
+		c.enterScope()
+		if err := c.compileExpression(field.Default); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+		c.closeFunction(fl, false)
+	}
+	c.emit(code.OpStruct, prototype)
+
+	c.storeSymbol(c.symbolTable.Define(ss.Name.Value))
+	return nil
+}
+
+func (c *Compiler) compileEnumStatement(es *ast.EnumStatement) error {
+	enum := &object.Enum{Name: es.Name.Value, Variants: map[string]*object.EnumVariant{}}
+
+	for _, v := range es.Variants {
+		if _, ok := enum.Variants[v.Name.Value]; ok {
+			return fmt.Errorf("duplicate variant: %s.%s", enum.Name, v.Name.Value)
+		}
+
+		variant := &object.EnumVariant{Enum: enum, Name: v.Name.Value}
+		if v.Fields == nil {
+			variant.Unit = &object.EnumValue{Variant: variant}
+		} else {
+			variant.Fields = []string{}
+			for _, field := range v.Fields {
+				variant.Fields = append(variant.Fields, field.Value)
+			}
+		}
+		enum.Variants[variant.Name] = variant
+	}
+	c.emit(code.OpEnum, c.addConstant(enum))
+
+	c.storeSymbol(c.symbolTable.Define(es.Name.Value))
+	return nil
+}
@@ -0,0 +1,113 @@
+package compiler
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/code"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+func (c *Compiler) compileArrayComprehension(ac *ast.ArrayComprehension) error {
+	c.emit(code.OpArray, 0)
+	return c.compileComprehension(ac.Clauses, func() error {
+		if err := c.compileExpression(ac.Element); err != nil {
+			return err
+		}
+		c.emit(code.OpCollect, len(ac.Clauses))
+		return nil
+	})
+}
+
+func (c *Compiler) compileHashComprehension(hc *ast.HashComprehension) error {
+	c.emit(code.OpHash, 0)
+	return c.compileComprehension(hc.Clauses, func() error {
+		if err := c.compileExpression(hc.Key); err != nil {
+			return err
+		}
+		if err := c.compileExpression(hc.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpCollectPair, len(hc.Clauses))
+		return nil
+	})
+}
+
+// compileComprehension compiles the loops of clauses, nested in order, around
+// emit, which collects into the array or hash under their iterators. The whole
+// comprehension is one scope, even with legacy block scope.
+func (c *Compiler) compileComprehension(clauses []*ast.ComprehensionClause, emit func() error) error {
+	c.enterBlock()
+
+	loops := []int{}
+	exits := []int{}
+	for _, clause := range clauses {
+		if err := c.compileExpression(clause.Iterable); err != nil {
+			return err
+		}
+		c.emit(code.OpIter)
+
+		loop := len(c.currentInstructions())
+		loops = append(loops, loop)
+		exits = append(exits, c.emit(code.OpIterNext, 9999))
+		if err := c.compilePattern(clause.Pattern); err != nil {
+			return err
+		}
+
+		if clause.Condition != nil {
+			if err := c.compileExpression(clause.Condition); err != nil {
+				return err
+			}
+			c.emit(code.OpJumpNotTruthy, loop)
+		}
+	}
+
+	if err := emit(); err != nil {
+		return err
+	}
+
+	for idx := len(clauses) - 1; idx >= 0; idx-- {
+		c.emit(code.OpJump, loops[idx])
+		c.changeOperand(exits[idx], len(c.currentInstructions()))
+	}
+
+	c.leaveBlock()
+	return nil
+}
+
+// compilePattern destructures the value on top of the stack into the
+// identifiers of pattern, consuming it.
+func (c *Compiler) compilePattern(pattern ast.Expression) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			c.storeSymbol(c.symbolTable.Define(pattern.Value))
+		}
+		c.emit(code.OpPop)
+		return nil
+	case *ast.ArrayLiteral:
+		source := c.addConstant(&object.String{Value: pattern.String()})
+		c.emit(code.OpDestructure, len(pattern.Elements), source)
+		return c.compilePatterns(pattern.Elements)
+	case *ast.CallExpression:
+		if err := c.compileExpression(pattern.Function); err != nil {
+			return err
+		}
+		source := c.addConstant(&object.String{Value: pattern.String()})
+		c.emit(code.OpMatchConstructor, len(pattern.Arguments), source)
+		return c.compilePatterns(pattern.Arguments)
+	default:
+		if err := c.compileExpression(pattern); err != nil {
+			return err
+		}
+		c.emit(code.OpMatchValue, c.addConstant(&object.String{Value: pattern.String()}))
+		return nil
+	}
+}
+
+func (c *Compiler) compilePatterns(patterns []ast.Expression) error {
+	for _, pattern := range patterns {
+		if err := c.compilePattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
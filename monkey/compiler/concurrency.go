@@ -0,0 +1,70 @@
+package compiler
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/code"
+)
+
+// compileSelectStatement compiles the channel operations of the cases, then a
+// branch to the body of each, which OpSelect picks between by leaving the value
+// received under the index of the case performed.
+func (c *Compiler) compileSelectStatement(ss *ast.SelectStatement) error {
+	for _, sc := range ss.Cases {
+		if err := c.compileList(sc.Operation.Arguments); err != nil {
+			return err
+		}
+		send := 0
+		if sc.Operation.Function.String() == "send" {
+			send = 1
+		}
+		c.emit(code.OpSelectCase, send)
+	}
+	hasDefault := 0
+	if ss.Default != nil {
+		hasDefault = 1
+	}
+	c.emit(code.OpSelect, len(ss.Cases), hasDefault)
+
+	ends := []int{}
+	for idx, sc := range ss.Cases {
+		next := c.emit(code.OpJumpUnlessCase, idx, 9999)
+		if err := c.compileSelectCase(sc); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(code.OpJump, 9999))
+		c.changeOperand(next, len(c.currentInstructions()))
+	}
+
+	c.emit(code.OpPop)
+	c.emit(code.OpPop)
+	if ss.Default == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlock(ss.Default, plain); err != nil {
+		return err
+	}
+
+	for _, end := range ends {
+		c.changeOperand(end, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileSelectCase compiles the body of a case with the value it received on
+// top of the stack. A case that receives into a name always has a scope of its
+// own to bind it in.
+func (c *Compiler) compileSelectCase(sc *ast.SelectCase) error {
+	if sc.Name == nil {
+		c.emit(code.OpPop)
+		return c.compileBlock(sc.Body, plain)
+	}
+
+	c.enterBlock()
+	c.storeSymbol(c.symbolTable.Define(sc.Name.Value))
+	c.emit(code.OpPop)
+	c.declare(sc.Body.Statements)
+	if err := c.compileStatements(sc.Body.Statements, plain); err != nil {
+		return err
+	}
+	c.leaveBlock()
+	return nil
+}
@@ -0,0 +1,92 @@
+package compiler
+
+import "github.com/jamestrew/go-interpreter/monkey/ast"
+
+// declare declares the names stmts define in the current scope ahead of their
+// definitions.
+func (c *Compiler) declare(stmts []ast.Statement) {
+	for _, name := range declarations(stmts, c.legacyBlockScope) {
+		c.symbolTable.Declare(name)
+	}
+}
+
+// declarations returns the names stmts define in the scope they're in: those
+// bound by lets, named functions and definitions, but not those of the scopes
+// nested in them, like functions and comprehensions. Blocks are only searched
+// when they share the scope that encloses them.
+func declarations(stmts []ast.Statement, legacyBlockScope bool) []string {
+	names := []string{}
+
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Pattern != nil {
+				names = append(names, patternNames(node.Pattern)...)
+			} else {
+				names = append(names, node.Name.Value)
+			}
+			ast.Inspect(node.Value, visit)
+		case *ast.BlockStatement:
+			return legacyBlockScope
+		case *ast.FunctionLiteral:
+			if node.Name != nil {
+				names = append(names, node.Name.Value)
+			}
+		case *ast.ClassStatement:
+			names = append(names, node.Name.Value)
+		case *ast.StructStatement:
+			names = append(names, node.Name.Value)
+		case *ast.EnumStatement:
+			names = append(names, node.Name.Value)
+		case *ast.SelectStatement:
+			for _, sc := range node.Cases {
+				for _, arg := range sc.Operation.Arguments {
+					ast.Inspect(arg, visit)
+				}
+				if sc.Name == nil {
+					ast.Inspect(sc.Body, visit)
+				}
+			}
+			if node.Default != nil {
+				ast.Inspect(node.Default, visit)
+			}
+		case *ast.CallExpression:
+			return !isCallTo(node, "quote")
+		case *ast.MacroLiteral, *ast.ArrayComprehension, *ast.HashComprehension:
+		default:
+			return true
+		}
+		return false
+	}
+
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, visit)
+	}
+	return names
+}
+
+// patternNames returns the names a destructuring pattern binds.
+func patternNames(pattern ast.Expression) []string {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value == "_" {
+			return nil
+		}
+		return []string{pattern.Value}
+	case *ast.ArrayLiteral:
+		names := []string{}
+		for _, elem := range pattern.Elements {
+			names = append(names, patternNames(elem)...)
+		}
+		return names
+	case *ast.CallExpression:
+		names := []string{}
+		for _, arg := range pattern.Arguments {
+			names = append(names, patternNames(arg)...)
+		}
+		return names
+	default:
+		return nil
+	}
+}
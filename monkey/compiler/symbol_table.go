@@ -0,0 +1,177 @@
+package compiler
+
+import "sort"
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable holds the names declared in a scope. The global table's names
+// are globals, and those of the other tables are locals of the frame of the
+// function they're in: a function's table is its own frame's, and a block's
+// is the frame of the function enclosing it.
+//
+// Names can be declared ahead of their definition, so the functions in a scope
+// can refer to the variables it defines after them. Code outside of those
+// functions only sees a name once it's defined, like the evaluator.
+type SymbolTable struct {
+	Outer *SymbolTable
+	// FreeSymbols are the variables of enclosing functions that a function
+	// captures, as they're known in the function enclosing it
+	FreeSymbols []Symbol
+
+	store    map[string]Symbol
+	declared map[string]bool // names that are declared but not defined yet
+	free     map[string]Symbol
+	block    bool
+
+	frame    *SymbolTable
+	locals   []string     // the name of each local, kept on the frame's table
+	captured map[int]bool // the locals captured by closures, on the frame's table
+	globals  []string     // the name of each global, kept on the global table
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := newSymbolTable(nil)
+	s.frame = s
+	return s
+}
+
+// NewEnclosedSymbolTable returns the table of a function nested in outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := newSymbolTable(outer)
+	s.frame = s
+	return s
+}
+
+// NewBlockSymbolTable returns the table of a block nested in outer, whose
+// locals are in the frame of outer.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := newSymbolTable(outer)
+	s.block = true
+	s.frame = outer.frame
+	return s
+}
+
+func newSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{
+		Outer:    outer,
+		store:    map[string]Symbol{},
+		declared: map[string]bool{},
+		free:     map[string]Symbol{},
+		captured: map[int]bool{},
+	}
+}
+
+func (s *SymbolTable) global() bool {
+	return s.Outer == nil
+}
+
+// Define binds name in s, reusing the symbol of an earlier declaration of it.
+func (s *SymbolTable) Define(name string) Symbol {
+	delete(s.declared, name)
+	if symbol, ok := s.store[name]; ok && symbol.Scope != BuiltinScope {
+		return symbol
+	}
+
+	var symbol Symbol
+	if s.global() {
+		symbol = Symbol{Name: name, Scope: GlobalScope, Index: len(s.globals)}
+		s.globals = append(s.globals, name)
+	} else {
+		symbol = Symbol{Name: name, Scope: LocalScope, Index: len(s.frame.locals)}
+		s.frame.locals = append(s.frame.locals, name)
+	}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Declare binds name in s ahead of its definition, where only functions can see
+// it. Globals are looked up when they're used, so they're simply defined.
+func (s *SymbolTable) Declare(name string) {
+	if _, ok := s.store[name]; ok && !s.global() {
+		return
+	}
+	s.Define(name)
+	if !s.global() {
+		s.declared[name] = true
+	}
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve returns the symbol name refers to, or false if it's not declared.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	return s.resolve(name, false)
+}
+
+// resolve looks name up from s, which is in another function than where the
+// lookup started if nested is set.
+func (s *SymbolTable) resolve(name string, nested bool) (Symbol, bool) {
+	if symbol, ok := s.store[name]; ok && (nested || !s.declared[name]) {
+		return symbol, true
+	}
+	if symbol, ok := s.free[name]; ok {
+		return symbol, true
+	}
+	if s.Outer == nil {
+		return Symbol{}, false
+	}
+
+	symbol, ok := s.Outer.resolve(name, nested || !s.block)
+	if !ok || s.block || symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+	if symbol.Scope == LocalScope {
+		s.Outer.frame.captured[symbol.Index] = true
+	}
+	return s.defineFree(symbol), true
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.free[original.Name] = symbol
+	return symbol
+}
+
+// Captured returns the locals defined in s that closures captured, in order.
+func (s *SymbolTable) Captured() []Symbol {
+	captured := []Symbol{}
+	for _, symbol := range s.store {
+		if symbol.Scope == LocalScope && s.frame.captured[symbol.Index] {
+			captured = append(captured, symbol)
+		}
+	}
+	sort.Slice(captured, func(i, j int) bool { return captured[i].Index < captured[j].Index })
+	return captured
+}
+
+// Locals returns the names of the locals of the frame of s, by index.
+func (s *SymbolTable) Locals() []string {
+	return s.frame.locals
+}
+
+// Globals returns the names of the globals, by index.
+func (s *SymbolTable) Globals() []string {
+	for !s.global() {
+		s = s.Outer
+	}
+	return s.globals
+}
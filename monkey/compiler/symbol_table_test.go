@@ -0,0 +1,86 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	global := NewSymbolTable()
+	if a := global.Define("a"); a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong symbol for a. got=%+v", a)
+	}
+	if b := global.Define("b"); b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("wrong symbol for b. got=%+v", b)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	if c := local.Define("c"); c != (Symbol{Name: "c", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong symbol for c. got=%+v", c)
+	}
+
+	// a block's locals are in the frame of the function enclosing it
+	block := NewBlockSymbolTable(local)
+	if d := block.Define("d"); d != (Symbol{Name: "d", Scope: LocalScope, Index: 1}) {
+		t.Errorf("wrong symbol for d. got=%+v", d)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	outer := NewEnclosedSymbolTable(global)
+	outer.Define("b")
+
+	inner := NewEnclosedSymbolTable(NewBlockSymbolTable(outer))
+	inner.Define("c")
+
+	expected := map[string]Symbol{
+		"a":   {Name: "a", Scope: GlobalScope, Index: 0},
+		"len": {Name: "len", Scope: BuiltinScope, Index: 0},
+		"b":   {Name: "b", Scope: FreeScope, Index: 0},
+		"c":   {Name: "c", Scope: LocalScope, Index: 0},
+	}
+	for name, want := range expected {
+		got, ok := inner.Resolve(name)
+		if !ok {
+			t.Errorf("name %s not resolvable", name)
+			continue
+		}
+		if got != want {
+			t.Errorf("wrong symbol for %s. want=%+v, got=%+v", name, want, got)
+		}
+	}
+
+	if _, ok := inner.Resolve("d"); ok {
+		t.Errorf("d resolved but was never defined")
+	}
+
+	if len(inner.FreeSymbols) != 1 || inner.FreeSymbols[0] != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong free symbols. got=%+v", inner.FreeSymbols)
+	}
+	if captured := outer.Captured(); len(captured) != 1 || captured[0].Name != "b" {
+		t.Errorf("wrong captured locals. got=%+v", captured)
+	}
+}
+
+func TestDeclare(t *testing.T) {
+	global := NewSymbolTable()
+	outer := NewEnclosedSymbolTable(global)
+	outer.Declare("f")
+
+	if _, ok := outer.Resolve("f"); ok {
+		t.Errorf("f resolved in its own scope before its definition")
+	}
+
+	inner := NewEnclosedSymbolTable(outer)
+	if f, ok := inner.Resolve("f"); !ok || f.Scope != FreeScope {
+		t.Errorf("f not visible to a nested function. got=%+v", f)
+	}
+
+	if f := outer.Define("f"); f.Index != 0 {
+		t.Errorf("definition of f didn't reuse its declaration. got=%+v", f)
+	}
+	if _, ok := outer.Resolve("f"); !ok {
+		t.Errorf("f not resolvable after its definition")
+	}
+}
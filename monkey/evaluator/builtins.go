@@ -2,16 +2,71 @@ package evaluator
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/jamestrew/go-interpreter/monkey/object"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len":   {Fn: __len},
-	"print": {Fn: __print},
-	"first": {Fn: __first},
-	"last": {Fn: __last},
-	"arrayPush": {Fn: __arrayPush},
+// builtins is populated in init for the same reason as methods.
+var builtins map[string]*object.Builtin
+
+// callbackBuiltin is a builtin that calls back into Monkey code. Like a method,
+// it's bound to the Caller of the engine that looked it up.
+type callbackBuiltin func(c Caller, args ...object.Object) object.Object
+
+var callbackBuiltins map[string]callbackBuiltin
+
+func init() {
+	builtins = map[string]*object.Builtin{
+		"len":       {Fn: __len},
+		"print":     {Fn: __print},
+		"first":     {Fn: __first},
+		"last":      {Fn: __last},
+		"arrayPush": {Fn: __arrayPush},
+		"type":      {Fn: __type},
+		"take":      {Fn: __take},
+		"zip":       {Fn: __zip},
+		"collect":   {Fn: __collect},
+		"channel":   {Fn: __channel},
+		"send":      {Fn: __send},
+		"recv":      {Fn: __recv},
+		"close":     {Fn: __close},
+	}
+	callbackBuiltins = map[string]callbackBuiltin{
+		"map_lazy": __mapLazy,
+	}
+}
+
+// BuiltinNames returns the names of the builtin functions, sorted.
+func BuiltinNames() []string {
+	names := []string{}
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range callbackBuiltins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBuiltin returns the builtin function called name, bound to c if it
+// calls back into Monkey code.
+func LookupBuiltin(c Caller, name string) (*object.Builtin, bool) {
+	if builtin, ok := builtins[name]; ok {
+		return builtin, true
+	}
+	if fn, ok := callbackBuiltins[name]; ok {
+		return bindBuiltin(c, fn), true
+	}
+	return nil, false
+}
+
+// bindBuiltin binds fn to c.
+func bindBuiltin(c Caller, fn callbackBuiltin) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return fn(c, args...)
+	}}
 }
 
 func __len(args ...object.Object) object.Object {
@@ -23,7 +78,11 @@ func __len(args ...object.Object) object.Object {
 	case *object.String:
 		return &object.Integer{Value: int64(len(argObj.Value))}
 	case *object.Array:
-		return &object.Integer{Value: int64(len(argObj.Elements))}
+		return &object.Integer{Value: int64(argObj.Len())}
+	case *object.Hash:
+		return &object.Integer{Value: int64(argObj.Len())}
+	case *object.Range:
+		return &object.Integer{Value: argObj.Len()}
 	default:
 		return newError("argument to `len` not supported, got %s", args[0].Type())
 	}
@@ -45,9 +104,15 @@ func __first(args ...object.Object) object.Object {
 
 	switch argObj := args[0].(type) {
 	case *object.String:
+		if len(argObj.Value) == 0 {
+			return NULL
+		}
 		return &object.String{Value: string(argObj.Value[0])}
 	case *object.Array:
-		return argObj.Elements[0]
+		if first, ok := argObj.Get(0); ok {
+			return first
+		}
+		return NULL
 	default:
 		return newError("argument to `first` not supported, got %s", args[0].Type())
 	}
@@ -60,9 +125,15 @@ func __last(args ...object.Object) object.Object {
 
 	switch argObj := args[0].(type) {
 	case *object.String:
+		if len(argObj.Value) == 0 {
+			return NULL
+		}
 		return &object.String{Value: string(argObj.Value[len(argObj.Value)-1])}
 	case *object.Array:
-		return argObj.Elements[len(argObj.Elements)-1]
+		if last, ok := argObj.Get(-1); ok {
+			return last
+		}
+		return NULL
 	default:
 		return newError("argument to `last` not supported, got %s", args[0].Type())
 	}
@@ -77,6 +148,167 @@ func __arrayPush(args ...object.Object) object.Object {
 	if !ok {
 		return newError("argument to `arrayPush` not supported, got=%T", args[0])
 	}
-	arrObj.Elements = append(arrObj.Elements, args[1])
+	arrObj.Append(args[1])
 	return arrObj
 }
+
+func __type(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+
+	switch argObj := args[0].(type) {
+	case *object.Instance:
+		return &object.String{Value: argObj.Class.Name}
+	case *object.Struct:
+		return &object.String{Value: argObj.Def.Name}
+	case *object.EnumValue:
+		return &object.String{Value: argObj.Variant.Enum.Name}
+	default:
+		return &object.String{Value: string(argObj.Type())}
+	}
+}
+
+func __take(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return wrongArgCountError(2, len(args))
+	}
+	it, err := Iterate(args[0])
+	if err != nil {
+		return err
+	}
+	n, ok := args[1].(*object.Integer)
+	if !ok {
+		return newError("argument to `take` must be INTEGER, got %s", args[1].Type())
+	}
+
+	remaining := n.Value
+	return &object.Iterator{Name: "iterator", Next: func() (object.Object, bool) {
+		if remaining <= 0 {
+			return nil, false
+		}
+		remaining--
+		return it.Next()
+	}}
+}
+
+func __mapLazy(c Caller, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return wrongArgCountError(2, len(args))
+	}
+	it, err := Iterate(args[0])
+	if err != nil {
+		return err
+	}
+
+	fn := args[1]
+	return &object.Iterator{Name: "iterator", Next: func() (object.Object, bool) {
+		value, ok := it.Next()
+		if !ok || isError(value) {
+			return value, ok
+		}
+		return c.Callback(fn, value), true
+	}}
+}
+
+func __zip(args ...object.Object) object.Object {
+	if len(args) < 2 {
+		return wrongArgCountError(2, len(args))
+	}
+
+	its := []*object.Iterator{}
+	for _, arg := range args {
+		it, err := Iterate(arg)
+		if err != nil {
+			return err
+		}
+		its = append(its, it)
+	}
+
+	return &object.Iterator{Name: "iterator", Next: func() (object.Object, bool) {
+		elements := []object.Object{}
+		for _, it := range its {
+			value, ok := it.Next()
+			if !ok || isError(value) {
+				return value, ok
+			}
+			elements = append(elements, value)
+		}
+		return &object.Array{Elements: elements}, true
+	}}
+}
+
+func __collect(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+	it, err := Iterate(args[0])
+	if err != nil {
+		return err
+	}
+	return Collect(it)
+}
+
+func __channel(args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return wrongArgCountError(1, len(args))
+	}
+
+	var capacity int64
+	if len(args) == 1 {
+		n, ok := args[0].(*object.Integer)
+		if !ok {
+			return newError("argument to `channel` must be INTEGER, got %s", args[0].Type())
+		}
+		if n.Value < 0 {
+			return newError("invalid channel capacity: %d", n.Value)
+		}
+		capacity = n.Value
+	}
+	return &object.Channel{Ch: make(chan object.Object, capacity)}
+}
+
+func __send(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return wrongArgCountError(2, len(args))
+	}
+	ch, err := toChannel("send", args[0])
+	if err != nil {
+		return err
+	}
+	if err := sendValue(ch, args[1]); err != nil {
+		return err
+	}
+	return NULL
+}
+
+// __recv returns the next value sent on the channel, or null once it's closed
+// and drained.
+func __recv(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+	ch, err := toChannel("recv", args[0])
+	if err != nil {
+		return err
+	}
+	value, ok := <-ch.Ch
+	if !ok {
+		return NULL
+	}
+	return value
+}
+
+func __close(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+	ch, err := toChannel("close", args[0])
+	if err != nil {
+		return err
+	}
+	if !ch.Close() {
+		return newError("close of closed channel")
+	}
+	return NULL
+}
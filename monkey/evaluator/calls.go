@@ -0,0 +1,157 @@
+package evaluator
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// functionFrame runs the body of a function called by caller, whose value is in
+// tail position.
+type functionFrame struct {
+	e      *Evaluator
+	caller *Evaluator
+	body   []ast.Statement
+	idx    int
+}
+
+func (f *functionFrame) returnTarget() {}
+
+func (f *functionFrame) step(m *machine, result object.Object) {
+	if rv, ok := result.(*object.ReturnValue); ok {
+		m.ret(rv.Value)
+		return
+	}
+	if f.idx == len(f.body) {
+		m.ret(result)
+		return
+	}
+
+	f.idx++
+	pos := plain
+	if f.idx == len(f.body) {
+		pos = tail
+	}
+	m.push(f.e, f.body[f.idx-1], pos)
+}
+
+// instanceFrame returns the instance that init was called on, once it's done.
+type instanceFrame struct {
+	inst *object.Instance
+}
+
+func (f *instanceFrame) step(m *machine, _ object.Object) {
+	m.ret(f.inst)
+}
+
+// call makes a call by e in place of the frame on top. A call in tail position
+// replaces the frame of the function making it as well, and is made at its
+// depth.
+func (m *machine) call(e *Evaluator, fn object.Object, args []object.Object, isTail bool) {
+	m.pop()
+	caller := e
+	if idx := m.innermostFunction(); isTail && idx >= 0 {
+		caller = m.frames[idx].(*functionFrame).caller
+		for len(m.frames) > idx {
+			m.pop()
+		}
+	}
+	m.apply(caller, fn, args)
+}
+
+// apply calls fn, pushing the frame that runs it if it's a function the
+// evaluator runs itself.
+func (m *machine) apply(e *Evaluator, fn object.Object, args []object.Object) {
+	switch fn := fn.(type) {
+	case *object.Function:
+		m.applyFunction(e, fn, object.NewEnclosedEnvironment(fn.Env), args)
+	case *object.BoundMethod:
+		var super object.Object = NULL
+		if fn.Class.Super != nil {
+			super = &object.Super{Receiver: fn.Receiver, Class: fn.Class.Super}
+		}
+		method, ok := fn.Method.(*object.Function)
+		if !ok {
+			m.deliver(Call(e, fn.Method, append([]object.Object{fn.Receiver, super}, args...)...))
+			return
+		}
+
+		env := object.NewEnclosedEnvironment(method.Env)
+		env.Set("self", fn.Receiver)
+		if super != NULL {
+			env.Set("super", super)
+		}
+		m.applyFunction(e, method, env, args)
+	case *object.Class:
+		m.instantiate(e, fn, args)
+	default:
+		m.deliver(Call(e, fn, args...))
+	}
+}
+
+func (m *machine) applyFunction(e *Evaluator, fn *object.Function, env *object.Environment, args []object.Object) {
+	if len(args) != len(fn.Parameters) {
+		m.deliver(wrongArgCountError(len(fn.Parameters), len(args)))
+		return
+	}
+	callee, err := e.nested(env)
+	if err != nil {
+		m.deliver(err)
+		return
+	}
+
+	for paramIdx, param := range fn.Parameters {
+		callee.bind(param, args[paramIdx])
+	}
+	if fn.IsGenerator {
+		m.deliver(callee.newGenerator(fn))
+		return
+	}
+	// the body runs directly in env, which is already the function's own scope.
+	// A yield in a function called from a generator suspends the generator
+	m.pushFrame(&functionFrame{e: callee, caller: e, body: fn.Body.Statements})
+}
+
+func (m *machine) instantiate(e *Evaluator, class *object.Class, args []object.Object) {
+	inst := &object.Instance{Class: class, Fields: map[string]object.Object{}}
+
+	init, owner := class.FindMethod("init")
+	if init == nil {
+		if len(args) != 0 {
+			m.deliver(wrongArgCountError(0, len(args)))
+			return
+		}
+		m.deliver(inst)
+		return
+	}
+
+	// the instance is returned once init is done, so calls init makes in tail
+	// position still nest
+	ctor, err := e.nested(e.env)
+	if err != nil {
+		m.deliver(err)
+		return
+	}
+	m.pushFrame(&instanceFrame{inst: inst})
+	bound := &object.BoundMethod{Receiver: inst, Class: owner, Name: "init", Method: init}
+	m.apply(ctor, bound, args)
+}
+
+// Callback calls obj outside of any generator, for methods that call back into
+// the evaluator.
+func (e *Evaluator) Callback(obj object.Object, args ...object.Object) object.Object {
+	return e.child(e.env, nil).callFunction(obj, args...)
+}
+
+// builtinCaller returns the Caller for a builtin that e looks up and that calls
+// back into Monkey code. Its callbacks can run long after the lookup, from
+// wherever its result ends up, so they run outside of any generator.
+func (e *Evaluator) builtinCaller() Caller {
+	return e.child(e.env, nil)
+}
+
+// callFunction calls obj on a machine of its own.
+func (e *Evaluator) callFunction(obj object.Object, args ...object.Object) object.Object {
+	m := &machine{}
+	m.apply(e, obj, args)
+	return m.run()
+}
@@ -0,0 +1,143 @@
+package evaluator
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// comprehensionFrame evaluates a comprehension, running through the bindings
+// of its clauses in order with an iterator for each clause entered, and
+// evaluating its element, or key and value, for each.
+type comprehensionFrame struct {
+	scope   *Evaluator
+	clauses []*ast.ComprehensionClause
+	its     []*object.Iterator
+	stage   comprehensionStage
+
+	emit   []ast.Expression
+	values []object.Object
+	// collect adds the values emitted for a binding to the result
+	collect func(values []object.Object)
+	result  object.Object
+}
+
+type comprehensionStage int
+
+const (
+	comprehensionIterable comprehensionStage = iota
+	comprehensionCondition
+	comprehensionEmit
+)
+
+func newArrayComprehension(e *Evaluator, ac *ast.ArrayComprehension) frame {
+	arr := &object.Array{Elements: []object.Object{}}
+	return &comprehensionFrame{
+		scope:   e.comprehensionScope(),
+		clauses: ac.Clauses,
+		emit:    []ast.Expression{ac.Element},
+		collect: func(values []object.Object) {
+			arr.Elements = append(arr.Elements, values[0])
+		},
+		result: arr,
+	}
+}
+
+func newHashComprehension(e *Evaluator, hc *ast.HashComprehension) frame {
+	hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	return &comprehensionFrame{
+		scope:   e.comprehensionScope(),
+		clauses: hc.Clauses,
+		emit:    []ast.Expression{hc.Key, hc.Value},
+		collect: func(values []object.Object) {
+			hashKey, _ := object.HashKeyOf(values[0])
+			hash.Pairs[hashKey] = object.HashPair{Key: values[0], Value: values[1]}
+		},
+		result: hash,
+	}
+}
+
+// comprehensionScope returns an evaluator for the body of a comprehension, so
+// its variables don't leak into the enclosing environment.
+func (e *Evaluator) comprehensionScope() *Evaluator {
+	return e.child(object.NewEnclosedEnvironment(e.env), e.gen)
+}
+
+func (f *comprehensionFrame) step(m *machine, result object.Object) {
+	if result == nil {
+		f.enter(m)
+		return
+	}
+
+	switch f.stage {
+	case comprehensionIterable:
+		it, err := Iterate(result)
+		if err != nil {
+			m.ret(err)
+			return
+		}
+		f.its = append(f.its, it)
+	case comprehensionCondition:
+		if isObjTruthy(result) {
+			f.enter(m)
+			return
+		}
+	case comprehensionEmit:
+		f.values = append(f.values, result)
+		// a key that can't be hashed is reported before the value is evaluated
+		if len(f.values) == 1 && len(f.emit) == 2 {
+			if _, ok := object.HashKeyOf(result); !ok {
+				m.ret(hashKeyError(result))
+				return
+			}
+		}
+		if len(f.values) < len(f.emit) {
+			m.push(f.scope, f.emit[len(f.values)], plain)
+			return
+		}
+		f.collect(f.values)
+		f.values = nil
+	}
+	f.advance(m)
+}
+
+// enter pushes the iterable of the clause after those entered, or the first
+// expression to emit once they've all been entered.
+func (f *comprehensionFrame) enter(m *machine) {
+	if len(f.its) == len(f.clauses) {
+		f.stage = comprehensionEmit
+		m.push(f.scope, f.emit[0], plain)
+		return
+	}
+	f.stage = comprehensionIterable
+	m.push(f.scope, f.clauses[len(f.its)].Iterable, plain)
+}
+
+// advance binds the next value of the innermost clause that has one left,
+// returning the result once none do.
+func (f *comprehensionFrame) advance(m *machine) {
+	for len(f.its) > 0 {
+		clause := f.clauses[len(f.its)-1]
+		value, ok := f.its[len(f.its)-1].Next()
+		if !ok {
+			f.its = f.its[:len(f.its)-1]
+			continue
+		}
+		if isError(value) {
+			m.ret(value)
+			return
+		}
+		if err := f.scope.bindPattern(clause.Pattern, value); err != nil {
+			m.ret(err)
+			return
+		}
+
+		if clause.Condition != nil {
+			f.stage = comprehensionCondition
+			m.push(f.scope, clause.Condition, plain)
+			return
+		}
+		f.enter(m)
+		return
+	}
+	m.ret(f.result)
+}
@@ -0,0 +1,172 @@
+package evaluator
+
+import (
+	"reflect"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// spawnFrame evaluates the function and arguments of a spawned call, then
+// starts the task. The arguments are evaluated before the task starts.
+type spawnFrame struct {
+	e    *Evaluator
+	node *ast.SpawnExpression
+	fn   object.Object
+	args expressions
+}
+
+func (f *spawnFrame) step(m *machine, result object.Object) {
+	call, isCall := f.node.Call.(*ast.CallExpression)
+	if f.fn == nil {
+		switch {
+		case result != nil:
+			f.fn = result
+			result = nil
+		case isCall:
+			m.push(f.e, call.Function, plain)
+			return
+		default:
+			m.push(f.e, f.node.Call, plain)
+			return
+		}
+	}
+	if isCall {
+		f.args.list = call.Arguments
+		if f.args.next(m, f.e, result) {
+			return
+		}
+	}
+
+	task := &object.Task{Done: make(chan struct{})}
+	runner := f.e.child(f.e.env, nil)
+	fn, args := f.fn, f.args.values
+	go func() {
+		defer close(task.Done)
+		task.Result = runner.callFunction(fn, args...)
+	}()
+	m.ret(task)
+}
+
+// selectFrame evaluates the channel operations of a select statement's cases,
+// without performing them, then performs one and hands its place to the body
+// of the case chosen.
+type selectFrame struct {
+	e     *Evaluator
+	node  *ast.SelectStatement
+	cases []reflect.SelectCase
+	args  *expressions
+}
+
+func (f *selectFrame) step(m *machine, result object.Object) {
+	for len(f.cases) < len(f.node.Cases) {
+		op := f.node.Cases[len(f.cases)].Operation
+		if f.args == nil {
+			f.args = &expressions{list: op.Arguments}
+		}
+		if f.args.next(m, f.e, result) {
+			return
+		}
+		selectCase, err := SelectCase(op.Function.String(), f.args.values)
+		if err != nil {
+			m.ret(err)
+			return
+		}
+		f.cases = append(f.cases, selectCase)
+		f.args = nil
+		result = nil
+	}
+
+	cases := f.cases
+	if f.node.Default != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+	chosen, received, err := Select(cases)
+	if err != nil {
+		m.ret(err)
+		return
+	}
+	if chosen == len(f.node.Cases) {
+		m.replace(f.e, f.node.Default, plain)
+		return
+	}
+
+	sc := f.node.Cases[chosen]
+	if sc.Name == nil {
+		m.replace(f.e, sc.Body, plain)
+		return
+	}
+
+	body := f.e.child(object.NewEnclosedEnvironment(f.e.env), f.e.gen)
+	body.bind(sc.Name, received)
+	m.pop()
+	m.pushFrame(&blockFrame{e: body, statements: sc.Body.Statements})
+}
+
+// SelectCase returns the channel operation of a select case calling name, send
+// or recv, with args.
+func SelectCase(name string, args []object.Object) (reflect.SelectCase, *object.Error) {
+	want := 1
+	if name == "send" {
+		want = 2
+	}
+	if len(args) != want {
+		return reflect.SelectCase{}, wrongArgCountError(want, len(args))
+	}
+	ch, err := toChannel(name, args[0])
+	if err != nil {
+		return reflect.SelectCase{}, err
+	}
+
+	if name == "send" {
+		return reflect.SelectCase{
+			Dir:  reflect.SelectSend,
+			Chan: reflect.ValueOf(ch.Ch),
+			Send: reflect.ValueOf(args[1]),
+		}, nil
+	}
+	return reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.Ch)}, nil
+}
+
+// Select performs one of cases, returning which along with the value received,
+// or null if it didn't receive one.
+func Select(cases []reflect.SelectCase) (int, object.Object, *object.Error) {
+	chosen, value, ok, err := selectChannels(cases)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var received object.Object = NULL
+	if ok {
+		received = value.Interface().(object.Object)
+	}
+	return chosen, received, nil
+}
+
+func selectChannels(cases []reflect.SelectCase) (chosen int, value reflect.Value, ok bool, err *object.Error) {
+	defer func() {
+		if recover() != nil {
+			err = newError("send on closed channel")
+		}
+	}()
+	chosen, value, ok = reflect.Select(cases)
+	return chosen, value, ok, nil
+}
+
+func sendValue(ch *object.Channel, value object.Object) (err *object.Error) {
+	defer func() {
+		if recover() != nil {
+			err = newError("send on closed channel")
+		}
+	}()
+	ch.Ch <- value
+	return nil
+}
+
+func toChannel(name string, obj object.Object) (*object.Channel, *object.Error) {
+	ch, ok := obj.(*object.Channel)
+	if !ok {
+		return nil, newError("argument to `%s` must be CHANNEL, got %s", name, obj.Type())
+	}
+	return ch, nil
+}
@@ -0,0 +1,59 @@
+package evaluator
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// Engine runs programs like an Evaluator does, so the tests of the evaluator
+// can be run against other engines as well.
+type Engine interface {
+	Eval(node ast.Node) object.Object
+}
+
+type engineFactory func(legacyBlockScope bool, maxDepth int) Engine
+
+type registeredEngine struct {
+	name    string
+	factory engineFactory
+}
+
+var (
+	engines []registeredEngine
+	// engine is the engine the tests are running against, or nil while
+	// they're running against the evaluator
+	engine engineFactory
+)
+
+// RegisterEngine adds an engine for the tests to run against once they've run
+// against the evaluator. It's called from the init of an external test file,
+// since engines depend on the evaluator.
+func RegisterEngine(name string, factory func(legacyBlockScope bool, maxDepth int) Engine) {
+	engines = append(engines, registeredEngine{name: name, factory: factory})
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	for _, e := range engines {
+		if code != 0 {
+			break
+		}
+		fmt.Printf("running tests against the %s engine\n", e.name)
+		engine = e.factory
+		code = m.Run()
+	}
+	os.Exit(code)
+}
+
+// newTestEngine returns the engine the tests are running against, with opts.
+func newTestEngine(opts ...Option) Engine {
+	e := New(object.NewEnvironment(), opts...)
+	if engine == nil {
+		return e
+	}
+	return engine(e.legacyBlockScope, e.maxDepth)
+}
@@ -3,6 +3,7 @@ package evaluator
 import (
 	"fmt"
 
+	"github.com/jamestrew/go-interpreter/monkey/ast"
 	"github.com/jamestrew/go-interpreter/monkey/object"
 )
 
@@ -28,3 +29,26 @@ func wrongArgCountError(want, got int) *object.Error {
 func hashKeyError(key object.Object) *object.Error {
 	return newError("unable to hash key: %s", key.Type())
 }
+
+func memberNotFoundError(obj object.Object, name string) *object.Error {
+	return newError("member not found: %s.%s", obj.Type(), name)
+}
+
+// PayloadArityError is the error for giving variant, or a pattern of it, got
+// values rather than as many as it has fields.
+func PayloadArityError(variant *object.EnumVariant, got int) *object.Error {
+	return newError(
+		"wrong payload arity for %s. got=%d, want=%d",
+		variant.Inspect(),
+		got,
+		len(variant.Fields),
+	)
+}
+
+func unitPayloadError(variant *object.EnumVariant) *object.Error {
+	return newError("%s takes no payload", variant.Inspect())
+}
+
+func patternMismatchError(pattern ast.Expression, value object.Object) *object.Error {
+	return newError("pattern mismatch: %s does not match %s", pattern.String(), value.Inspect())
+}
@@ -1,23 +1,35 @@
 package evaluator
 
 import (
+	"fmt"
+
 	"github.com/jamestrew/go-interpreter/monkey/ast"
 	"github.com/jamestrew/go-interpreter/monkey/object"
 )
 
-func (e *Evaluator) evalProgram(statements []ast.Statement) object.Object {
-	var result object.Object
+// programFrame evaluates the statements of a program. A value returned from
+// the top level ends it.
+type programFrame struct {
+	e          *Evaluator
+	statements []ast.Statement
+	idx        int
+}
+
+func (f *programFrame) returnTarget() {}
 
-	for _, stmt := range statements {
-		result = e.Eval(stmt)
-		switch result := result.(type) {
-		case *object.ReturnValue:
-			return result.Value
-		case *object.Error:
-			return result
-		}
+func (f *programFrame) step(m *machine, result object.Object) {
+	if rv, ok := result.(*object.ReturnValue); ok {
+		m.ret(rv.Value)
+		return
 	}
-	return result
+	if f.idx == len(f.statements) {
+		// an empty program has no value, rather than null
+		m.pop()
+		m.result = result
+		return
+	}
+	f.idx++
+	m.push(f.e, f.statements[f.idx-1], plain)
 }
 
 func evalBangOperator(right object.Object) object.Object {
@@ -31,26 +43,32 @@ func evalMinusPrefixOperator(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
 		return newError("unknown operator: -%s", right.Type())
 	}
-	intObj := right.(*object.Integer)
-	value := intObj.Value
-	intObj.Value = -value
-	return intObj
+	value := right.(*object.Integer).Value
+	return &object.Integer{Value: -value}
 }
 
-func (e *Evaluator) evalPrefixExpression(pe *ast.PrefixExpression) object.Object {
-	right := e.Eval(pe.Right)
+type prefixFrame struct {
+	e    *Evaluator
+	node *ast.PrefixExpression
+}
 
-	if isError(right) {
-		return right
+func (f *prefixFrame) step(m *machine, right object.Object) {
+	if right == nil {
+		m.push(f.e, f.node.Right, plain)
+		return
 	}
+	m.ret(Prefix(f.node.Operator, right))
+}
 
-	switch pe.Operator {
+// Prefix applies a prefix operator to right.
+func Prefix(operator string, right object.Object) object.Object {
+	switch operator {
 	case "!":
 		return evalBangOperator(right)
 	case "-":
 		return evalMinusPrefixOperator(right)
 	default:
-		return newError("unknown operator: %s%s", pe.Operator, right.Type())
+		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -65,6 +83,9 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftValue * rightValue}
 	case "/":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftValue / rightValue}
 	case ">":
 		return nativeBoolToBooleanObject(leftValue > rightValue)
@@ -80,91 +101,241 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 }
 
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	if operator != "+" {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+	switch operator {
+	case "+":
+		return &object.String{Value: leftValue + rightValue}
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
 		return infixOperatorError(left, right, operator)
 	}
-	return &object.String{Value: left.(*object.String).Value + right.(*object.String).Value}
 }
 
-func (e *Evaluator) evalInfixExpression(ie *ast.InfixExpression) object.Object {
-	left := e.Eval(ie.Left)
-	if isError(left) {
-		return left
+func objectsEqual(left, right object.Object) bool {
+	switch left := left.(type) {
+	case *object.Integer:
+		right, ok := right.(*object.Integer)
+		return ok && left.Value == right.Value
+	case *object.String:
+		right, ok := right.(*object.String)
+		return ok && left.Value == right.Value
+	case *object.EnumValue:
+		right, ok := right.(*object.EnumValue)
+		if !ok || left.Variant != right.Variant {
+			return false
+		}
+		for idx := range left.Payload {
+			if !objectsEqual(left.Payload[idx], right.Payload[idx]) {
+				return false
+			}
+		}
+		return true
+	case *object.Struct:
+		right, ok := right.(*object.Struct)
+		if !ok || left.Def != right.Def {
+			return false
+		}
+		for _, field := range left.Def.Fields {
+			l, _ := left.Get(field)
+			r, _ := right.Get(field)
+			if !objectsEqual(l, r) {
+				return false
+			}
+		}
+		return true
+	case *object.Range:
+		right, ok := right.(*object.Range)
+		return ok && rangesEqual(left, right)
+	default:
+		return left == right
+	}
+}
+
+type infixFrame struct {
+	e    *Evaluator
+	node *ast.InfixExpression
+	left object.Object
+}
+
+func (f *infixFrame) step(m *machine, result object.Object) {
+	switch {
+	case result == nil:
+		m.push(f.e, f.node.Left, plain)
+	case f.left != nil:
+		m.ret(Infix(f.node.Operator, f.left, result))
+	case f.node.Operator == "??":
+		// the right side is only evaluated when it's needed
+		if result != NULL {
+			m.ret(result)
+			return
+		}
+		m.pop()
+		m.push(f.e, f.node.Right, plain)
+	default:
+		f.left = result
+		m.push(f.e, f.node.Right, plain)
 	}
+}
 
-	right := e.Eval(ie.Right)
-	if isError(right) {
-		return right
+// Infix applies an infix operator to its operands, other than ??, which only
+// evaluates its right side when it's needed.
+func Infix(operator string, left, right object.Object) object.Object {
+	if operator == "in" {
+		return evalInExpression(left, right)
 	}
 
 	leftType := left.Type()
 	rightType := right.Type()
 	switch {
 	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(ie.Operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
-		return evalStringInfixExpression(ie.Operator, left, right)
-	case ie.Operator == "==":
-		return nativeBoolToBooleanObject(left == right)
-	case ie.Operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return evalStringInfixExpression(operator, left, right)
+	case operator == "==":
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 	case leftType != rightType:
-		return newError("type mismatch: %s %s %s", leftType, ie.Operator, rightType)
+		return newError("type mismatch: %s %s %s", leftType, operator, rightType)
 	default:
-		return infixOperatorError(left, right, ie.Operator)
+		return infixOperatorError(left, right, operator)
 	}
 }
 
-func (e *Evaluator) evalIfExpression(ie *ast.IfExpression) object.Object {
-	condition := e.Eval(ie.Condition)
-	if isError(condition) {
-		return condition
+// ifFrame evaluates an if expression, handing its place to the branch taken,
+// which is in tail position when the if is.
+type ifFrame struct {
+	e    *Evaluator
+	node *ast.IfExpression
+	pos  position
+}
+
+func (f *ifFrame) step(m *machine, condition object.Object) {
+	if condition == nil {
+		m.push(f.e, f.node.Condition, plain)
+		return
 	}
 	if isObjTruthy(condition) {
-		return e.Eval(ie.Consequence)
-	} else if ie.Alternative != nil {
-		return e.Eval(ie.Alternative)
+		m.replace(f.e, f.node.Consequence, f.pos)
+	} else if f.node.Alternative != nil {
+		m.replace(f.e, f.node.Alternative, f.pos)
 	} else {
-		return NULL
+		m.ret(NULL)
 	}
 }
 
-func (e *Evaluator) evalBlockStatement(statements []ast.Statement) object.Object {
-	var result object.Object
+// replace pops the frame on top, and pushes node in its place.
+func (m *machine) replace(e *Evaluator, node ast.Node, pos position) {
+	m.pop()
+	m.push(e, node, pos)
+}
 
-	for _, stmt := range statements {
-		result = e.Eval(stmt)
-		switch result := result.(type) {
-		case *object.ReturnValue:
-			return result
-		case *object.Error:
-			return result
-		}
+// blockScope returns the evaluator for the statements of a nested block.
+func (e *Evaluator) blockScope() *Evaluator {
+	if e.legacyBlockScope {
+		return e
 	}
+	return e.child(object.NewEnclosedEnvironment(e.env), e.gen)
+}
 
-	return result
+// blockFrame evaluates the statements of a block, which is null when it's
+// empty. The last one takes the block's place, and is in tail position when
+// the block is.
+type blockFrame struct {
+	e          *Evaluator
+	statements []ast.Statement
+	idx        int
+	tail       bool
 }
 
-func (e *Evaluator) evalReturnStatement(rs *ast.ReturnStatement) object.Object {
-	value := e.Eval(rs.Value)
-	if isError(value) {
-		return value
+func (f *blockFrame) step(m *machine, _ object.Object) {
+	if len(f.statements) == 0 {
+		m.ret(NULL)
+		return
 	}
-	ret := &object.ReturnValue{Value: value}
-	return ret
+	stmt := f.statements[f.idx]
+	f.idx++
+	if f.idx < len(f.statements) {
+		m.push(f.e, stmt, plain)
+		return
+	}
+	pos := plain
+	if f.tail {
+		pos = tail
+	}
+	m.replace(f.e, stmt, pos)
 }
 
-func (e *Evaluator) evalLetStatement(ls *ast.LetStatement) object.Object {
-	val := e.Eval(ls.Value)
-	if isError(val) {
-		return val
+// returnFrame evaluates a return statement. The returned value is always in
+// tail position.
+type returnFrame struct {
+	e    *Evaluator
+	node *ast.ReturnStatement
+}
+
+func (f *returnFrame) step(m *machine, value object.Object) {
+	if value == nil {
+		m.push(f.e, f.node.Value, tail)
+		return
 	}
+	m.ret(&object.ReturnValue{Value: value})
+}
 
-	e.env.Set(ls.Name.Value, val)
-	return val
+type letFrame struct {
+	e    *Evaluator
+	node *ast.LetStatement
+}
+
+func (f *letFrame) step(m *machine, val object.Object) {
+	if val == nil {
+		m.push(f.e, f.node.Value, plain)
+		return
+	}
+
+	if f.node.Pattern != nil {
+		if err := f.e.bindPattern(f.node.Pattern, val); err != nil {
+			m.ret(err)
+			return
+		}
+		m.ret(val)
+		return
+	}
+
+	f.e.bind(f.node.Name, val)
+	m.ret(val)
+}
+
+// local returns where the resolver stored i, or nil if it's looked up by name.
+// Annotations are ignored with legacy block scope, which doesn't have the
+// scopes the resolver saw.
+func (e *Evaluator) local(i *ast.Identifier) *ast.Local {
+	if e.legacyBlockScope {
+		return nil
+	}
+	return i.Local
+}
+
+// bind binds i to val in the current scope.
+func (e *Evaluator) bind(i *ast.Identifier, val object.Object) {
+	if local := e.local(i); local != nil {
+		e.env.SetLocal(local.Slot, val)
+		return
+	}
+	e.env.Set(i.Value, val)
 }
 
 func (e *Evaluator) evalIdentifier(i *ast.Identifier) object.Object {
+	// a slot that isn't set yet belongs to a later declaration, which a
+	// function body can call on before it's made
+	if local := e.local(i); local != nil {
+		if val, ok := e.env.GetLocal(local.Depth, local.Slot); ok {
+			return val
+		}
+	}
 	if val, ok := e.env.Get(i.Value); ok {
 		return val
 	}
@@ -172,59 +343,114 @@ func (e *Evaluator) evalIdentifier(i *ast.Identifier) object.Object {
 	if builtin, ok := builtins[i.Value]; ok {
 		return builtin
 	}
+	if fn, ok := callbackBuiltins[i.Value]; ok {
+		return bindBuiltin(e.builtinCaller(), fn)
+	}
 	return newError("identifier not found: %s", i.Value)
 }
 
 func (e *Evaluator) evalFunctionLiteral(fl *ast.FunctionLiteral) object.Object {
 	params := fl.Parameters
 	body := fl.Body
-	return &object.Function{Parameters: params, Body: body, Env: e.env}
+	fn := &object.Function{Parameters: params, Body: body, Env: e.env, IsGenerator: fl.IsGenerator}
+	if fl.Name != nil {
+		e.bind(fl.Name, fn)
+	}
+	return fn
+}
+
+type yieldFrame struct {
+	e    *Evaluator
+	node *ast.YieldExpression
 }
 
-func (e *Evaluator) evalCallExpression(ce *ast.CallExpression) object.Object {
-	function := e.Eval(ce.Function)
-	if isError(function) {
-		return function
+func (f *yieldFrame) step(m *machine, value object.Object) {
+	if f.e.gen == nil {
+		m.ret(newError("yield outside of a generator"))
+		return
 	}
+	if value == nil && f.node.Value != nil {
+		m.push(f.e, f.node.Value, plain)
+		return
+	}
+	if value == nil {
+		value = NULL
+	}
+	m.ret(f.e.gen.yield(value))
+}
 
-	args := e.evalExpressions(ce.Arguments)
-	if len(args) == 1 && isError(args[0]) {
-		return args[0]
+// callFrame evaluates a call expression, then makes the call in its place. Its
+// function is a link of a chain, like the object of a member expression.
+type callFrame struct {
+	e    *Evaluator
+	node *ast.CallExpression
+	pos  position
+	fn   object.Object
+	args expressions
+}
+
+func (m *machine) pushCall(e *Evaluator, ce *ast.CallExpression, pos position) {
+	if ident, ok := ce.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+		if len(ce.Arguments) != 1 {
+			m.deliver(wrongArgCountError(1, len(ce.Arguments)))
+			return
+		}
+		m.deliver(e.quote(ce.Arguments[0]))
+		return
+	}
+	m.pushFrame(&callFrame{e: e, node: ce, pos: pos, args: expressions{list: ce.Arguments}})
+}
+
+func (f *callFrame) step(m *machine, result object.Object) {
+	if f.fn == nil {
+		if result == nil {
+			m.push(f.e, f.node.Function, link)
+			return
+		}
+		if result == skipped || (f.node.Optional && result == NULL) {
+			m.skip(f.pos)
+			return
+		}
+		f.fn = result
+		result = nil
 	}
 
-	return execFunction(function, args...)
+	if f.args.next(m, f.e, result) {
+		return
+	}
+	m.call(f.e, f.fn, f.args.values, f.pos == tail)
+}
+
+type arrayFrame struct {
+	e        *Evaluator
+	elements expressions
 }
 
-func (e *Evaluator) evalArrayLiteral(al *ast.ArrayLiteral) object.Object {
-	elements := e.evalExpressions(al.Elements)
-	if len(elements) == 1 && isError(elements[0]) {
-		return elements[0]
+func (f *arrayFrame) step(m *machine, result object.Object) {
+	if f.elements.next(m, f.e, result) {
+		return
 	}
-	return &object.Array{Elements: elements}
+	m.ret(&object.Array{Elements: f.elements.values})
 }
 
 func evalArrayIndex(array, index object.Object) object.Object {
 	arr := array.(*object.Array)
 	idx := index.(*object.Integer)
 
-	maxIdx := len(arr.Elements)
-
-	if idx.Value >= 0 && idx.Value < int64(maxIdx) {
-		return arr.Elements[idx.Value]
-	} else if idx.Value < 0 && -idx.Value <= int64(maxIdx) {
-		return arr.Elements[maxIdx+int(idx.Value)]
+	if elem, ok := arr.Get(idx.Value); ok {
+		return elem
 	}
 	return NULL
 }
 
 func evalHashIndex(hashObj, keyObj object.Object) object.Object {
 	hash := hashObj.(*object.Hash)
-	key, ok := keyObj.(object.Hashable)
+	key, ok := object.HashKeyOf(keyObj)
 	if !ok {
 		return hashKeyError(keyObj)
 	}
 
-	ret, ok := hash.Pairs[key.HashKey()]
+	ret, ok := hash.Get(key)
 	if !ok {
 		return NULL
 	}
@@ -232,78 +458,539 @@ func evalHashIndex(hashObj, keyObj object.Object) object.Object {
 	return ret.Value
 }
 
-func (e *Evaluator) evalIndexExpression(ie *ast.IndexExpression) object.Object {
-	left := e.Eval(ie.Left)
-	if isError(left) {
-		return left
-	}
-	index := e.Eval(ie.Index)
-	if isError(index) {
-		return index
+type indexFrame struct {
+	e    *Evaluator
+	node *ast.IndexExpression
+	pos  position
+	left object.Object
+}
+
+func (f *indexFrame) step(m *machine, result object.Object) {
+	switch {
+	case result == nil:
+		m.push(f.e, f.node.Left, link)
+	case f.left != nil:
+		m.ret(Index(f.left, result, f.node))
+	case result == skipped || (f.node.Optional && result == NULL):
+		m.skip(f.pos)
+	default:
+		f.left = result
+		m.push(f.e, f.node.Index, plain)
 	}
+}
 
+// Index returns left[index]. expr is the index expression, for the error when
+// left can't be indexed by index.
+func Index(left, index object.Object, expr fmt.Stringer) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndex(left, index)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalRangeIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndex(left, index)
+	case left.Type() == object.STRUCT_OBJ && index.Type() == object.STRING_OBJ:
+		return getStructField(left.(*object.Struct), index.(*object.String).Value)
 	default:
-		return newError("index operator not supported: %s", ie.String())
+		return newError("index operator not supported: %s", expr.String())
 	}
 }
 
-func (e *Evaluator) evalHashLiteral(hl *ast.HashLiteral) object.Object {
-	pairs := map[object.HashKey]object.HashPair{}
+// hashFrame evaluates the pairs of a hash literal in order, so later keys
+// override earlier ones.
+type hashFrame struct {
+	e     *Evaluator
+	node  *ast.HashLiteral
+	idx   int
+	pairs map[object.HashKey]object.HashPair
+	key   object.Object
+}
 
-	for keyNode, valueNode := range hl.Pairs {
-		key := e.Eval(keyNode)
-		if isError(key) {
-			return key
+func (f *hashFrame) step(m *machine, result object.Object) {
+	if result != nil {
+		if !f.took(m, result) {
+			return
 		}
-		hashKey, ok := key.(object.Hashable)
+	}
+	if f.idx == len(f.node.Pairs) {
+		m.ret(&object.Hash{Pairs: f.pairs})
+		return
+	}
+
+	pair := f.node.Pairs[f.idx]
+	switch {
+	case f.key != nil:
+		m.push(f.e, pair.Value, plain)
+	case isSpread(pair.Key):
+		m.push(f.e, pair.Key.(*ast.SpreadElement).Value, plain)
+	default:
+		m.push(f.e, pair.Key, plain)
+	}
+}
+
+// took takes the result of the part of the pair being evaluated, reporting
+// false if it's returned an error instead.
+func (f *hashFrame) took(m *machine, result object.Object) bool {
+	pair := f.node.Pairs[f.idx]
+	switch {
+	case f.key != nil:
+		hashKey, _ := object.HashKeyOf(f.key)
+		f.pairs[hashKey] = object.HashPair{Key: f.key, Value: result}
+		f.key = nil
+		f.idx++
+	case isSpread(pair.Key):
+		hash, ok := result.(*object.Hash)
 		if !ok {
-			return hashKeyError(key)
+			m.ret(newError("spread of non-hash: %s", result.Type()))
+			return false
 		}
+		for hashKey, pair := range hash.Snapshot() {
+			f.pairs[hashKey] = pair
+		}
+		f.idx++
+	default:
+		if _, ok := object.HashKeyOf(result); !ok {
+			m.ret(hashKeyError(result))
+			return false
+		}
+		f.key = result
+	}
+	return true
+}
+
+func isSpread(exp ast.Expression) bool {
+	_, ok := exp.(*ast.SpreadElement)
+	return ok
+}
+
+type memberFrame struct {
+	e    *Evaluator
+	node *ast.MemberExpression
+	pos  position
+}
+
+func (f *memberFrame) step(m *machine, obj object.Object) {
+	switch {
+	case obj == nil:
+		m.push(f.e, f.node.Object, link)
+	case obj == skipped || (f.node.Optional && obj == NULL):
+		m.skip(f.pos)
+	default:
+		m.ret(f.e.getMember(obj, f.node.Property.Value))
+	}
+}
+
+// getMember binds methods to a copy of e, since they can be called after e has
+// moved on, or from another task.
+func (e *Evaluator) getMember(obj object.Object, name string) object.Object {
+	member, fn := lookupMember(obj, name)
+	if fn != nil {
+		return bindMethod(e.child(e.env, e.gen), obj, fn)
+	}
+	return member
+}
+
+// GetMember returns the member name of obj, binding a method of its type to c.
+func GetMember(c Caller, obj object.Object, name string) object.Object {
+	member, fn := lookupMember(obj, name)
+	if fn != nil {
+		return bindMethod(c, obj, fn)
+	}
+	return member
+}
+
+// lookupMember returns the member name of obj, or the method of its type that
+// it names.
+func lookupMember(obj object.Object, name string) (object.Object, method) {
+	if hash, ok := obj.(*object.Hash); ok {
+		key := &object.String{Value: name}
+		if pair, ok := hash.Get(key.HashKey()); ok {
+			return pair.Value, nil
+		}
+	}
 
-		value := e.Eval(valueNode)
+	switch obj := obj.(type) {
+	case *object.Struct:
+		return getStructField(obj, name), nil
+	case *object.Instance:
+		return getInstanceMember(obj, name), nil
+	case *object.Super:
+		return getSuperMethod(obj, name), nil
+	case *object.Enum:
+		return getEnumVariant(obj, name), nil
+	case *object.EnumValue:
+		return getEnumPayloadField(obj, name), nil
+	}
+
+	if fn, ok := methods[obj.Type()][name]; ok {
+		return nil, fn
+	}
+
+	if obj.Type() == object.HASH_OBJ {
+		return NULL, nil
+	}
+	return memberNotFoundError(obj, name), nil
+}
+
+func getStructField(s *object.Struct, name string) object.Object {
+	if val, ok := s.Get(name); ok {
+		return val
+	}
+	return newError("unknown field: %s.%s", s.Def.Name, name)
+}
+
+func getInstanceMember(inst *object.Instance, name string) object.Object {
+	if val, ok := inst.Get(name); ok {
+		return val
+	}
+	if method, class := inst.Class.FindMethod(name); method != nil {
+		return &object.BoundMethod{Receiver: inst, Class: class, Name: name, Method: method}
+	}
+	return newError("unknown field: %s.%s", inst.Class.Name, name)
+}
+
+func getSuperMethod(super *object.Super, name string) object.Object {
+	if method, class := super.Class.FindMethod(name); method != nil {
+		return &object.BoundMethod{Receiver: super.Receiver, Class: class, Name: name, Method: method}
+	}
+	return newError("unknown method: %s.%s", super.Class.Name, name)
+}
+
+// SetMember sets the member name of obj to value.
+func SetMember(obj object.Object, name string, value object.Object) object.Object {
+	switch obj := obj.(type) {
+	case *object.Hash:
+		key := &object.String{Value: name}
+		obj.Set(key.HashKey(), object.HashPair{Key: key, Value: value})
+	case *object.Struct:
+		if !obj.Def.HasField(name) {
+			return newError("unknown field: %s.%s", obj.Def.Name, name)
+		}
+		obj.Set(name, value)
+	case *object.Instance:
+		obj.Set(name, value)
+	default:
+		return newError("member assignment not supported: %s", obj.Type())
+	}
+	return value
+}
+
+type assignFrame struct {
+	e    *Evaluator
+	node *ast.AssignExpression
+	obj  object.Object
+}
+
+func (f *assignFrame) step(m *machine, result object.Object) {
+	target, ok := f.node.Target.(*ast.MemberExpression)
+	switch {
+	case !ok:
+		m.ret(newError("invalid assignment target: %s", f.node.Target.String()))
+	case result == nil:
+		m.push(f.e, target.Object, plain)
+	case f.obj == nil:
+		f.obj = result
+		m.push(f.e, f.node.Value, plain)
+	default:
+		m.ret(SetMember(f.obj, target.Property.Value, result))
+	}
+}
+
+type classFrame struct {
+	e    *Evaluator
+	node *ast.ClassStatement
+}
+
+func (f *classFrame) step(m *machine, super object.Object) {
+	if super == nil && f.node.SuperClass != nil {
+		m.push(f.e, f.node.SuperClass, plain)
+		return
+	}
+	m.ret(f.e.defineClass(f.node, super))
+}
+
+// defineClass defines the class cs, whose superclass evaluated to super.
+func (e *Evaluator) defineClass(cs *ast.ClassStatement, super object.Object) object.Object {
+	class := &object.Class{Name: cs.Name.Value, Methods: map[string]object.Object{}}
+
+	if cs.SuperClass != nil {
+		superClass, ok := super.(*object.Class)
+		if !ok {
+			return newError("superclass must be a CLASS, got %s", super.Type())
+		}
+		class.Super = superClass
+	}
+
+	for _, method := range cs.Methods {
+		class.Methods[method.Name.Value] = &object.Function{
+			Parameters: method.Parameters,
+			Body:       method.Body,
+			Env:        e.env,
+		}
+	}
+
+	e.bind(cs.Name, class)
+	return class
+}
+
+func (e *Evaluator) evalEnumStatement(es *ast.EnumStatement) object.Object {
+	enum := &object.Enum{Name: es.Name.Value, Variants: map[string]*object.EnumVariant{}}
+
+	for _, v := range es.Variants {
+		if _, ok := enum.Variants[v.Name.Value]; ok {
+			return newError("duplicate variant: %s.%s", enum.Name, v.Name.Value)
+		}
+
+		variant := &object.EnumVariant{Enum: enum, Name: v.Name.Value}
+		if v.Fields == nil {
+			variant.Unit = &object.EnumValue{Variant: variant}
+		} else {
+			variant.Fields = []string{}
+			for _, field := range v.Fields {
+				variant.Fields = append(variant.Fields, field.Value)
+			}
+		}
+		enum.Variants[variant.Name] = variant
+	}
+
+	e.bind(es.Name, enum)
+	return enum
+}
+
+func getEnumVariant(enum *object.Enum, name string) object.Object {
+	variant, ok := enum.Variants[name]
+	if !ok {
+		return newError("unknown variant: %s.%s", enum.Name, name)
+	}
+	if variant.Unit != nil {
+		return variant.Unit
+	}
+	return variant
+}
+
+func getEnumPayloadField(value *object.EnumValue, name string) object.Object {
+	for idx, field := range value.Variant.Fields {
+		if field == name {
+			return value.Payload[idx]
+		}
+	}
+	return newError("unknown field: %s.%s", value.Variant.Inspect(), name)
+}
+
+func constructEnumValue(variant *object.EnumVariant, args ...object.Object) object.Object {
+	if len(args) != len(variant.Fields) {
+		return PayloadArityError(variant, len(args))
+	}
+	return &object.EnumValue{Variant: variant, Payload: args}
+}
+
+// bindPattern destructures value into the identifiers of pattern, returning an
+// error if value doesn't have the pattern's shape.
+func (e *Evaluator) bindPattern(pattern ast.Expression, value object.Object) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			e.bind(pattern, value)
+		}
+		return nil
+	case *ast.ArrayLiteral:
+		arr, ok := value.(*object.Array)
+		if !ok {
+			return patternMismatchError(pattern, value)
+		}
+		elements := arr.Snapshot()
+		if len(elements) != len(pattern.Elements) {
+			return patternMismatchError(pattern, value)
+		}
+		return e.bindPatterns(pattern.Elements, elements)
+	case *ast.CallExpression:
+		return e.bindConstructorPattern(pattern, value)
+	default:
+		expected := e.Eval(pattern)
+		if isError(expected) {
+			return expected.(*object.Error)
+		}
+		if !objectsEqual(expected, value) {
+			return patternMismatchError(pattern, value)
+		}
+		return nil
+	}
+}
+
+func (e *Evaluator) bindPatterns(patterns []ast.Expression, values []object.Object) *object.Error {
+	for idx, pattern := range patterns {
+		if err := e.bindPattern(pattern, values[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Evaluator) bindConstructorPattern(pattern *ast.CallExpression, value object.Object) *object.Error {
+	constructor := e.Eval(pattern.Function)
+	if isError(constructor) {
+		return constructor.(*object.Error)
+	}
+
+	switch constructor := constructor.(type) {
+	case *object.EnumVariant:
+		if len(pattern.Arguments) != len(constructor.Fields) {
+			return PayloadArityError(constructor, len(pattern.Arguments))
+		}
+		enumValue, ok := value.(*object.EnumValue)
+		if !ok || enumValue.Variant != constructor {
+			return patternMismatchError(pattern, value)
+		}
+		return e.bindPatterns(pattern.Arguments, enumValue.Payload)
+	case *object.StructType:
+		if len(pattern.Arguments) != len(constructor.Fields) {
+			return wrongArgCountError(len(constructor.Fields), len(pattern.Arguments))
+		}
+		structValue, ok := value.(*object.Struct)
+		if !ok || structValue.Def != constructor {
+			return patternMismatchError(pattern, value)
+		}
+		values := []object.Object{}
+		for _, field := range constructor.Fields {
+			value, _ := structValue.Get(field)
+			values = append(values, value)
+		}
+		return e.bindPatterns(pattern.Arguments, values)
+	default:
+		return newError("not a constructor: %s", constructor.Type())
+	}
+}
+
+func (e *Evaluator) evalStructStatement(ss *ast.StructStatement) object.Object {
+	def := &object.StructType{
+		Name:     ss.Name.Value,
+		Fields:   []string{},
+		Defaults: map[string]ast.Expression{},
+		Env:      e.env,
+	}
+	for _, field := range ss.Fields {
+		if def.HasField(field.Name.Value) {
+			return newError("duplicate field: %s.%s", def.Name, field.Name.Value)
+		}
+		def.Fields = append(def.Fields, field.Name.Value)
+		if field.Default != nil {
+			def.Defaults[field.Name.Value] = field.Default
+		}
+	}
+
+	e.bind(ss.Name, def)
+	return def
+}
+
+// constructStruct makes the calls that compute defaults through c, so they run
+// with the options and at the depth of the engine constructing the struct.
+func constructStruct(c Caller, def *object.StructType, args ...object.Object) object.Object {
+	if len(args) > len(def.Fields) {
+		return wrongArgCountError(len(def.Fields), len(args))
+	}
+
+	values := map[string]object.Object{}
+	for idx, field := range def.Fields {
+		if idx < len(args) {
+			values[field] = args[idx]
+			continue
+		}
+
+		defaultExp, ok := def.Defaults[field]
+		if !ok {
+			return newError("missing value for field: %s.%s", def.Name, field)
+		}
+		fn, ok := def.Compiled[field]
+		if !ok {
+			// a default is evaluated like the body of a function without
+			// parameters, defined along with the struct
+			body := &ast.BlockStatement{Statements: []ast.Statement{
+				&ast.ExpressionStatement{Expression: defaultExp},
+			}}
+			fn = &object.Function{Body: body, Env: def.Env}
+		}
+		value := c.Callback(fn)
 		if isError(value) {
 			return value
 		}
-		pair := object.HashPair{Key: key, Value: value}
-		pairs[hashKey.HashKey()] = pair
+		values[field] = value
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return &object.Struct{Def: def, Values: values}
+}
+
+// expressions evaluates a list of expressions in order, for the frame on top,
+// spreading the elements of spread ones into its values.
+type expressions struct {
+	list   []ast.Expression
+	idx    int
+	values []object.Object
+	spread bool // the expression last pushed is spread
 }
 
-func (e *Evaluator) evalExpressions(expressions []ast.Expression) []object.Object {
-	var result []object.Object
-	for _, expression := range expressions {
-		expObj := e.Eval(expression)
-		if isError(expObj) {
-			return []object.Object{expObj}
+// next takes the value of the expression last pushed, if result is one, and
+// pushes the next, reporting false once they've all been evaluated. A value
+// that can't be spread returns an error from the frame on top.
+func (x *expressions) next(m *machine, e *Evaluator, result object.Object) bool {
+	if result != nil {
+		if !x.spread {
+			x.values = append(x.values, result)
+		} else if arr := Spread(result); isError(arr) {
+			m.ret(arr)
+			return true
+		} else {
+			x.values = append(x.values, arr.(*object.Array).Snapshot()...)
 		}
-		result = append(result, expObj)
+	}
+	if x.idx == len(x.list) {
+		return false
 	}
 
-	return result
+	exp := x.list[x.idx]
+	x.idx++
+	x.spread = false
+	if spread, ok := exp.(*ast.SpreadElement); ok {
+		x.spread = true
+		exp = spread.Value
+	}
+	m.push(e, exp, plain)
+	return true
 }
 
-func extendFunctionEnv(fn *object.Function, args ...object.Object) *object.Environment {
-	newEnv := object.NewEnclosedEnvironment(fn.Env)
-	for paramIdx, param := range fn.Parameters {
-		newEnv.Set(param.Value, args[paramIdx])
+// Spread returns an array of the elements of a spread iterable.
+func Spread(obj object.Object) object.Object {
+	it, err := Iterate(obj)
+	if err != nil {
+		return newError("spread of non-iterable: %s", obj.Type())
 	}
-	return newEnv
+	return Collect(it)
 }
 
-func execFunction(obj object.Object, args ...object.Object) object.Object {
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	return obj
+}
+
+// Call calls obj, which is anything callable but the functions the evaluator
+// runs itself: builtins, constructors and Callables. Calls back into Monkey
+// code, like those computing the defaults of a struct, are made through c.
+func Call(c Caller, obj object.Object, args ...object.Object) object.Object {
 	switch fn := obj.(type) {
-	case *object.Function:
-		newEnv := extendFunctionEnv(fn, args...)
-		return New(newEnv).Eval(fn.Body)
+	case object.Callable:
+		return fn.Call(args...)
+	case *object.EnumVariant:
+		return constructEnumValue(fn, args...)
+	case *object.EnumValue:
+		if fn.Variant.Unit != nil {
+			return unitPayloadError(fn.Variant)
+		}
+		return newError("not a function: %s", obj.Type())
 	case *object.Builtin:
 		return fn.Fn(args...)
+	case *object.StructType:
+		return constructStruct(c, fn, args...)
 	default:
 		return newError("not a function: %s", obj.Type())
 	}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/jamestrew/go-interpreter/monkey/ast"
 	"github.com/jamestrew/go-interpreter/monkey/object"
+	"github.com/jamestrew/go-interpreter/monkey/resolve"
 )
 
 var (
@@ -13,54 +14,150 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+// DefaultMaxDepth is how deeply function calls can nest unless WithMaxDepth
+// says otherwise.
+const DefaultMaxDepth = 10000
+
 type Evaluator struct {
 	env *object.Environment
+	gen *generator // set while running the body of a generator
+
+	legacyBlockScope bool
+	maxDepth         int
+
+	depth int // function calls in progress, including the one e is running
+}
+
+// Option configures an Evaluator.
+type Option func(*Evaluator)
+
+// WithLegacyBlockScope runs blocks in the scope that encloses them, as they were
+// before blocks had their own scope, so a let inside an if is visible after it.
+func WithLegacyBlockScope() Option {
+	return func(e *Evaluator) {
+		e.legacyBlockScope = true
+	}
+}
+
+// WithMaxDepth limits how deeply function calls can nest. Going deeper is an
+// error rather than a crash. A limit of zero or less removes it, so only memory
+// bounds the depth.
+func WithMaxDepth(depth int) Option {
+	return func(e *Evaluator) {
+		e.maxDepth = depth
+	}
 }
 
-func New(env *object.Environment) *Evaluator {
-	return &Evaluator{env: env}
+func New(env *object.Environment, opts ...Option) *Evaluator {
+	e := &Evaluator{env: env, maxDepth: DefaultMaxDepth}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
 }
 
+// child returns an evaluator with the same options as e that runs in env, with
+// gen as the running generator.
+func (e *Evaluator) child(env *object.Environment, gen *generator) *Evaluator {
+	c := *e
+	c.env = env
+	c.gen = gen
+	return &c
+}
+
+// nested returns a child evaluator for a call made by e, which runs in env, or
+// an error if calls would nest too deeply.
+func (e *Evaluator) nested(env *object.Environment) (*Evaluator, *object.Error) {
+	if e.maxDepth > 0 && e.depth >= e.maxDepth {
+		return nil, newError("maximum recursion depth exceeded")
+	}
+	c := e.child(env, e.gen)
+	c.depth++
+	return c, nil
+}
+
+// Eval evaluates node. A program is resolved first, so its local variables are
+// kept in slots, unless blocks run in the scope that encloses them: then
+// whether a block has a scope of its own depends on which evaluator runs it,
+// so names are looked up as they always were.
+//
+// Evaluation runs on a stack of frames on the heap rather than the Go stack, so
+// recursion is only as deep as WithMaxDepth allows.
 func (e *Evaluator) Eval(node ast.Node) object.Object {
+	m := &machine{}
+	m.push(e, node, plain)
+	return m.run()
+}
+
+// push starts evaluating node with e, at pos. Nodes without operands to
+// evaluate are done at once, and their result handed to the frame on top.
+func (m *machine) push(e *Evaluator, node ast.Node, pos position) {
 	switch node := node.(type) {
 	case *ast.Program:
-		return e.evalProgram(node.Statements)
+		if !e.legacyBlockScope {
+			resolve.Program(node)
+		}
+		m.pushFrame(&programFrame{e: e, statements: node.Statements})
 	case *ast.ExpressionStatement:
-		return e.Eval(node.Expression)
+		m.push(e, node.Expression, pos)
 	case *ast.PrefixExpression:
-		return e.evalPrefixExpression(node)
+		m.pushFrame(&prefixFrame{e: e, node: node})
 	case *ast.InfixExpression:
-		return e.evalInfixExpression(node)
+		m.pushFrame(&infixFrame{e: e, node: node})
 	case *ast.IfExpression:
-		return e.evalIfExpression(node)
+		m.pushFrame(&ifFrame{e: e, node: node, pos: pos})
 	case *ast.BlockStatement:
-		return e.evalBlockStatement(node.Statements)
+		m.pushFrame(&blockFrame{e: e.blockScope(), statements: node.Statements, tail: pos == tail})
 	case *ast.ReturnStatement:
-		return e.evalReturnStatement(node)
+		m.pushFrame(&returnFrame{e: e, node: node})
 	case *ast.LetStatement:
-		return e.evalLetStatement(node)
+		m.pushFrame(&letFrame{e: e, node: node})
+	case *ast.StructStatement:
+		m.deliver(e.evalStructStatement(node))
+	case *ast.ClassStatement:
+		m.pushFrame(&classFrame{e: e, node: node})
+	case *ast.EnumStatement:
+		m.deliver(e.evalEnumStatement(node))
+	case *ast.SelectStatement:
+		m.pushFrame(&selectFrame{e: e, node: node})
 	case *ast.Identifier:
-		return e.evalIdentifier(node)
+		m.deliver(e.evalIdentifier(node))
 	case *ast.FunctionLiteral:
-		return e.evalFunctionLiteral(node)
+		m.deliver(e.evalFunctionLiteral(node))
 	case *ast.CallExpression:
-		return e.evalCallExpression(node)
+		m.pushCall(e, node, pos)
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		m.deliver(&object.Integer{Value: node.Value})
 	case *ast.Boolean:
-		return nativeBoolToBooleanObject(node.Value)
+		m.deliver(nativeBoolToBooleanObject(node.Value))
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		m.deliver(&object.String{Value: node.Value})
 	case *ast.ArrayLiteral:
-		return e.evalArrayLiteral(node)
+		m.pushFrame(&arrayFrame{e: e, elements: expressions{list: node.Elements}})
 	case *ast.IndexExpression:
-		return e.evalIndexExpression(node)
+		m.pushFrame(&indexFrame{e: e, node: node, pos: pos})
 	case *ast.HashLiteral:
-		return e.evalHashLiteral(node)
+		m.pushFrame(&hashFrame{e: e, node: node, pairs: map[object.HashKey]object.HashPair{}})
+	case *ast.ArrayComprehension:
+		m.pushFrame(newArrayComprehension(e, node))
+	case *ast.HashComprehension:
+		m.pushFrame(newHashComprehension(e, node))
+	case *ast.MemberExpression:
+		m.pushFrame(&memberFrame{e: e, node: node, pos: pos})
+	case *ast.AssignExpression:
+		m.pushFrame(&assignFrame{e: e, node: node})
+	case *ast.YieldExpression:
+		m.pushFrame(&yieldFrame{e: e, node: node})
+	case *ast.SpawnExpression:
+		m.pushFrame(&spawnFrame{e: e, node: node})
+	case *ast.RangeExpression:
+		m.pushFrame(&rangeFrame{e: e, node: node})
+	case *ast.MacroLiteral:
+		m.deliver(newError("macros can only be defined by a top-level let"))
 	default:
 		fmt.Printf("Eval: node type not handled: %T\n", node)
+		m.deliver(NULL)
 	}
-	return nil
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -1,9 +1,13 @@
 package evaluator
 
 import (
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jamestrew/go-interpreter/monkey/object"
+	"github.com/jamestrew/go-interpreter/monkey/parser"
 )
 
 func TestEvalIntegerObject(t *testing.T) {
@@ -58,6 +62,9 @@ func TestBooleanObject(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
 	}
 
 	for _, tt := range tests {
@@ -163,6 +170,15 @@ if (10 > 1) {
 		{"foobar", "identifier not found: foobar"},
 		{`"hello" - "world"`, "unknown infix operation: STRING - STRING"},
 		{`{"name": "Monkey"}[fn(x) { x }];`, "unable to hash key: FUNCTION"},
+		{"fn(x) { x }(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"fn(x, y) { x }(1)", "wrong number of arguments. got=1, want=2"},
+		{`{}["a"]["b"]`, `index operator not supported: (({}["a"])["b"])`},
+		{`{}["a"]?.["b"]["c"]() - 1`, "type mismatch: NULL - INTEGER"},
+		{"5?.x", "member not found: INTEGER.x"},
+		{"5?.(1)", "not a function: INTEGER"},
+		{"{}.a?.b ?? x", "identifier not found: x"},
+		{"x ?? 1", "identifier not found: x"},
+		{"10 / (5 - 5)", "division by zero"},
 	}
 
 	for _, tt := range tests {
@@ -194,6 +210,7 @@ func TestLetStatements(t *testing.T) {
 		{"let a = 5 * 5; a;", 25},
 		{"let a = 5; let b = a; a;", 5},
 		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let a = 5; -a; a;", 5},
 	}
 
 	for _, tt := range tests {
@@ -205,24 +222,30 @@ func TestLetStatements(t *testing.T) {
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; }"
 
+	// other engines have functions of their own, which show their source the
+	// same way
 	evaluated := testEval(input)
-	fn, ok := evaluated.(*object.Function)
-	if !ok {
-		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	if evaluated.Type() != object.FUNCTION_OBJ {
+		t.Fatalf("object is not a function. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	if len(fn.Parameters) != 1 {
-		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
-	}
+	if fn, ok := evaluated.(*object.Function); ok {
+		if len(fn.Parameters) != 1 {
+			t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+		}
 
-	if fn.Parameters[0].String() != "x" {
-		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
-	}
+		if fn.Parameters[0].String() != "x" {
+			t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+		}
 
-	if fn.Body.String() != "(x + 2)" {
-		t.Fatalf("body is not \"(x + 2)\". got=%q", fn.Body.String())
+		if fn.Body.String() != "(x + 2)" {
+			t.Fatalf("body is not \"(x + 2)\". got=%q", fn.Body.String())
+		}
 	}
 
+	if evaluated.Inspect() != "fn(x) {\n(x + 2)\n}" {
+		t.Fatalf("wrong Inspect(). got=%q", evaluated.Inspect())
+	}
 }
 
 func TestFunctionApplication(t *testing.T) {
@@ -236,6 +259,8 @@ func TestFunctionApplication(t *testing.T) {
 		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
 		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
 		{"fn(x) { x; }(5)", 5},
+		{"let f = fn(x) { return x; }; f(5) + 1", 6},
+		{"let f = fn() { return 1; }; let g = fn() { f(); 2 }; g()", 2},
 	}
 
 	for _, tt := range tests {
@@ -287,6 +312,10 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`last("hello")`, "o"},
 		{`last("hello", "world")`, "wrong number of arguments. got=2, want=1"},
 		{`last([1, 2, 3])`, 3},
+		{`first("")`, nil},
+		{`first([])`, nil},
+		{`last("")`, nil},
+		{`last([])`, nil},
 		{`arrayPush([1, 2, 3], 4)`, []int{1, 2, 3, 4}},
 		{`arrayPush(4)`, "wrong number of arguments. got=1, want=2"},
 	}
@@ -450,3 +479,1385 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestMemberExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"name": "monkey"}.name`, "monkey"},
+		{`let h = {"inner": {"x": 5}}; h.inner.x`, 5},
+		{`{"name": "monkey"}.age`, nil},
+		{`{"add": fn(x, y) { x + y }}.add(2, 3)`, 5},
+		{`"abc".upper()`, "ABC"},
+		{`"ABC".lower()`, "abc"},
+		{`"  pad ".trim()`, "pad"},
+		{`"hello".len()`, 5},
+		{`"a,b,c".split(",").len()`, 3},
+		{`"a,b,c".split(",").join("-")`, "a-b-c"},
+		{`"monkey".contains("key")`, true},
+		{`let arr = [1, 2]; arr.push(3); arr.len()`, 3},
+		{`let arr = [1, 2, 3]; arr.pop() + arr.len()`, 5},
+		{`[].pop()`, nil},
+		{`[1, 2, 3].first() + [1, 2, 3].last()`, 4},
+		{`[1, 2, 3].map(fn(x) { x * 2 }).last()`, 6},
+		{`"".first()`, nil},
+		{`"".last()`, nil},
+		{`[].first()`, nil},
+		{`[].last()`, nil},
+		{`[1, 2, 3, 4].filter(fn(x) { x > 2 }).len()`, 2},
+		{`{"a": 1, "b": 2}.keys().len()`, 2},
+		{`{"a": 1, "b": 2}.values().len()`, 2},
+		{`{"a": 1}.has("a")`, true},
+		{`{"a": 1}.has("b")`, false},
+		{`{"keys": 1}.keys`, 1},
+		{`let upper = "abc".upper; upper()`, "ABC"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, tt.input, int64(expected))
+		case string:
+			testStringObject(t, evaluated, tt.input, expected)
+		case bool:
+			testBooleanObject(t, evaluated, tt.input, expected)
+		case nil:
+			testNullObject(t, evaluated, tt.input)
+		}
+	}
+}
+
+func TestMemberExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{`5.foo`, "member not found: INTEGER.foo"},
+		{`"abc".foo()`, "member not found: STRING.foo"},
+		{`"abc".upper(1)`, "wrong number of arguments. got=1, want=0"},
+		{`"abc".split(1)`, "argument to `split` must be STRING, got INTEGER"},
+		{`[1].map(fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"struct Point { x, y = 0 }; Point(1).x", 1},
+		{"struct Point { x, y = 0 }; Point(1).y", 0},
+		{"struct Point { x, y = 0 }; Point(1, 2).y", 2},
+		{`struct Point { x, y = 0 }; Point(1, 2)["y"]`, 2},
+		{"let z = 5; struct Point { x, y = z * 2 }; Point(1).y", 10},
+		{"struct Point { x, y }; Point(1, 2) == Point(1, 2)", true},
+		{"struct Point { x, y }; Point(1, 2) != Point(1, 3)", true},
+		{`struct Name { first }; Name("a") == Name("a")`, true},
+		{"struct A { x }; struct B { x }; A(1) == B(1)", false},
+		{"struct Point { x, y }; {Point(1, 2): 5}[Point(1, 2)]", 5},
+		{"struct Point { x, y }; {Point(1, 2): 5}[Point(2, 1)]", nil},
+		{"struct Point { x, y = 0 }; Point(1)", "Point{x: 1, y: 0}"},
+		{"struct Line { a, b }; struct P { x }; Line(P(1), P(2))", "Line{a: P{x: 1}, b: P{x: 2}}"},
+		{"struct Point { x, y }", "struct Point"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, tt.input, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, tt.input, expected)
+		case nil:
+			testNullObject(t, evaluated, tt.input)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"struct Point { x, y }; Point(1).z", "missing value for field: Point.y"},
+		{"struct Point { x, y }; Point(1, 2).z", "unknown field: Point.z"},
+		{`struct Point { x, y }; Point(1, 2)["z"]`, "unknown field: Point.z"},
+		{"struct Point { x, y }; Point(1, 2, 3)", "wrong number of arguments. got=3, want=2"},
+		{"struct Point { x, x }", "duplicate field: Point.x"},
+		{"struct Point { x = foo }; Point()", "identifier not found: foo"},
+		{"struct Box { v }; {Box(fn(x) { x }): 1}", "unable to hash key: STRUCT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let h = {}; h.x = 5; h["x"]`, 5},
+		{"let h = {}; let g = {}; h.x = g.y = 3; h.x + g.y", 6},
+		{"let h = {}; let f = fn() { h.x = 5 }; f(); h.x", 5},
+		{"struct Point { x, y }; let p = Point(1, 2); p.x = 5; p.x", 5},
+		{"struct Point { x, y }; let p = Point(1, 2); p.z = 5", "unknown field: Point.z"},
+		{"let a = 1; a.b = 2", "member assignment not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, tt.input, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestClasses(t *testing.T) {
+	account := `
+class Account {
+	init(owner) { self.owner = owner; self.balance = 0 }
+	deposit(n) { self.balance = self.balance + n; self }
+	describe() { self.owner + ": " + type(self) }
+}
+class Savings extends Account {
+	init(owner, rate) { super.init(owner); self.rate = rate }
+	interest() { self.balance * self.rate }
+	describe() { "savings " + super.describe() }
+}
+`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = Account("bob"); a.deposit(5); a.deposit(10); a.balance`, 15},
+		{`Account("bob").deposit(5).deposit(10).balance`, 15},
+		{`let a = Account("bob"); let d = a.deposit; d(3); a.balance`, 3},
+		{`Savings("amy", 2).deposit(5).interest()`, 10},
+		{`Savings("amy", 2).owner`, "amy"},
+		{`Account("bob").describe()`, "bob: Account"},
+		{`Savings("amy", 2).describe()`, "savings amy: Savings"},
+		{`type(Savings("amy", 2))`, "Savings"},
+		{`type(1)`, "INTEGER"},
+		{`let a = Account("bob"); a == a`, true},
+		{`Account("bob") == Account("bob")`, false},
+		{`class Empty {}; type(Empty())`, "Empty"},
+		{`class Counter { init() { self.n = 0 } inc() { self.n = self.n + 1; return self.n; 99 } }
+		  let c = Counter(); c.inc(); c.inc()`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(account + tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, tt.input, int64(expected))
+		case string:
+			testStringObject(t, evaluated, tt.input, expected)
+		case bool:
+			testBooleanObject(t, evaluated, tt.input, expected)
+		}
+	}
+}
+
+func TestClassInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`class Account {}`, "class Account"},
+		{`class Account { init(owner) { self.owner = owner; self.balance = 0 } } Account("bob")`,
+			"Account{balance: 0, owner: bob}"},
+		{`class Account { deposit(n) { n } } Account().deposit`, "bound method Account.deposit"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestClassErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{`class A {}; A().foo`, "unknown field: A.foo"},
+		{`class A {}; A(1)`, "wrong number of arguments. got=1, want=0"},
+		{`class A { init(x) {} }; A()`, "wrong number of arguments. got=0, want=1"},
+		{`let B = 5; class A extends B {}`, "superclass must be a CLASS, got INTEGER"},
+		{`class A {}; class B extends A { f() { super.f() } }; B().f()`, "unknown method: A.f"},
+		{`class A { f() { self.x + 1 } }; A().f()`, "unknown field: A.x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	state := "enum State { Pending, Active(since), Closed(reason, at) };"
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"State.Pending", "State.Pending"},
+		{"State.Active(5)", "State.Active(5)"},
+		{"State.Active", "State.Active"},
+		{"State.Pending == State.Pending", true},
+		{"State.Pending == State.Active(1)", false},
+		{"State.Active(1) == State.Active(1)", true},
+		{"State.Active(1) != State.Active(2)", true},
+		{"enum Other { Pending }; State.Pending == Other.Pending", false},
+		{"State.Active(5).since", 5},
+		{"{State.Pending: 1, State.Active(2): 2}[State.Active(2)]", 2},
+		{"{State.Pending: 1, State.Active(2): 2}[State.Pending]", 1},
+		{"{State.Pending: 1}[State.Active(2)]", nil},
+		{"let s = State.Active(7); let State.Active(since) = s; since", 7},
+		{"let State.Closed(why, _) = State.Closed(1, 2); why", 1},
+		{"let [State.Active(x), y] = [State.Active(3), 4]; x + y", 7},
+		{"type(State.Pending)", "State"},
+	}
+
+	for _, tt := range tests {
+		input := state + tt.input
+		evaluated := testEval(input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, input, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, input, expected)
+		case nil:
+			testNullObject(t, evaluated, input)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestLetPatterns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let [a, b] = [1, 2]; a + b", 3},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let [a, _] = [1, 2]; a", 1},
+		{"let [1, b] = [1, 2]; b", 2},
+		{"struct Point { x, y }; let Point(x, y) = Point(3, 4); x * y", 12},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.input, tt.expected)
+	}
+}
+
+func TestEnumErrors(t *testing.T) {
+	state := "enum State { Pending, Active(since) };"
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"State.Paused", "unknown variant: State.Paused"},
+		{"State.Active()", "wrong payload arity for State.Active. got=0, want=1"},
+		{"State.Active(1, 2)", "wrong payload arity for State.Active. got=2, want=1"},
+		{"State.Pending(1)", "State.Pending takes no payload"},
+		{"State.Pending()", "State.Pending takes no payload"},
+		{"State.Active(1)()", "not a function: ENUM_VALUE"},
+		{"State.Active(1).until", "unknown field: State.Active.until"},
+		{"enum Dup { A, A }", "duplicate variant: Dup.A"},
+		{"let State.Active(x) = State.Pending; x", "pattern mismatch: (State.Active)(x) does not match State.Pending"},
+		{"let State.Active(x, y) = State.Active(1)", "wrong payload arity for State.Active. got=2, want=1"},
+		{"let [a, b] = [1]", "pattern mismatch: [a, b] does not match [1]"},
+		{"let [1, b] = [2, 3]", "pattern mismatch: 1 does not match 2"},
+		{"let f = fn(x) { x }; let f(x) = 1", "not a constructor: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		input := state + tt.input
+		evaluated := testEval(input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	count := "fn* count(n) { let loop = fn(i) { if (i < n) { yield i; loop(i + 1) } }; loop(0) };"
+	naturals := "fn* naturals() { let loop = fn(i) { yield i; loop(i + 1) }; loop(1) };"
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let g = count(2); [g.next(), g.next(), g.next(), g.next()]", "[0, 1, null, null]"},
+		{"collect(count(4))", "[0, 1, 2, 3]"},
+		{"collect(count(0))", "[]"},
+		{"fn* two() { yield 1; yield; 3 }; collect(two())", "[1, null]"},
+		{"fn* early() { yield 1; return 5; yield 2 }; collect(early())", "[1]"},
+		{"let g = fn*(x) { yield x * 2 }; collect(g(21))", "[42]"},
+		{"collect(take(naturals(), 3))", "[1, 2, 3]"},
+		{"collect(take([1, 2, 3], 5))", "[1, 2, 3]"},
+		{"collect(map_lazy(naturals(), fn(x) { x * x }).take(4))", "[1, 4, 9, 16]"},
+		{"collect(map_lazy(\"ab\", fn(c) { c + c }))", "[aa, bb]"},
+		{"collect(zip(naturals(), \"abc\"))", "[[1, a], [2, b], [3, c]]"},
+		{"collect(zip([1, 2, 3], count(2), naturals()))", "[[1, 0, 1], [2, 1, 2]]"},
+		{"collect({\"a\": 1})", "[a]"},
+		{"count(3).map(fn(x) { x + 1 }).collect()", "[1, 2, 3]"},
+		{"let g = naturals(); g.next(); take(g, 2).collect()", "[2, 3]"},
+		{"let g = count(3); collect(g); g.next()", nil},
+		{"fn* outer() { yield 1; collect(count(2)) }; outer().next()", 1},
+		{"count(3)", "generator"},
+		{"fn* g(x) { yield x }; g", "fn*(x) {\n(yield x)\n}"},
+		{"type(naturals())", "ITERATOR"},
+		{"collect(take(naturals(), 1000)).len()", 1000},
+		{"fn add(a, b) { a + b }; add(1, 2)", 3},
+	}
+
+	for _, tt := range tests {
+		input := count + naturals + tt.input
+		evaluated := testEval(input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, input, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, input, expected)
+		case nil:
+			testNullObject(t, evaluated, input)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"yield 1", "yield outside of a generator"},
+		{"let f = fn() { yield 1 }; f()", "yield outside of a generator"},
+		{"fn* g() { yield 1; x }; collect(g())", "identifier not found: x"},
+		{"fn* g() { yield 1; x }; let it = g(); it.next(); it.next()", "identifier not found: x"},
+		{"fn* g(a) { yield a }; g()", "wrong number of arguments. got=0, want=1"},
+		{"collect(map_lazy([1], fn(x) { x + true }))", "type mismatch: INTEGER + BOOLEAN"},
+		{"collect(map_lazy([1], fn() { 1 }))", "wrong number of arguments. got=1, want=0"},
+		{"fn* g() { yield 1 }; collect(map_lazy(g(), fn(x) { yield x }))", "yield outside of a generator"},
+		{"take(5, 1)", "not iterable: INTEGER"},
+		{"take([1], \"a\")", "argument to `take` must be INTEGER, got STRING"},
+		{"zip([1])", "wrong number of arguments. got=1, want=2"},
+		{"collect(1)", "not iterable: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+// TestAbandonedGenerator drops a generator while another goroutine is in a call
+// to its Next, so it's collected while its lock is held, and checks that its
+// body is still unwound once that call returns.
+func TestAbandonedGenerator(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	release := make(chan struct{})
+	unwound := make(chan object.Object, 1)
+	it := Generator(func(yield func(value object.Object) object.Object) object.Object {
+		yield(&object.Integer{Value: 1})
+		<-release
+		yield(&object.Integer{Value: 2})
+		result := yield(&object.Integer{Value: 3})
+		unwound <- result
+		return result
+	})
+	if value, ok := it.Next(); !ok || value.Inspect() != "1" {
+		t.Fatalf("wrong first value. got=%v", value)
+	}
+
+	next := it.Next
+	returned := make(chan object.Object)
+	go func() {
+		value, _ := next()
+		returned <- value
+	}()
+	it = nil
+
+	// wait for the call to Next to take the lock, then collect the iterator
+	// while it's held
+	time.Sleep(10 * time.Millisecond)
+	runtime.GC()
+	runtime.GC()
+
+	close(release)
+	select {
+	case value := <-returned:
+		if value.Inspect() != "2" {
+			t.Errorf("wrong second value. got=%s", value.Inspect())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Next deadlocked")
+	}
+	next = nil
+
+	deadline := time.After(5 * time.Second)
+	for done := false; !done; {
+		runtime.GC()
+		select {
+		case result := <-unwound:
+			if result != errGeneratorClosed {
+				t.Errorf("body not unwound by closing. got=%v", result)
+			}
+			done = true
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("abandoned generator never closed")
+		}
+	}
+
+	for runtime.NumGoroutine() > before {
+		select {
+		case <-deadline:
+			t.Fatalf("goroutines leaked. before=%d, after=%d", before, runtime.NumGoroutine())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let t = spawn fn() { 1 + 1 }; t.wait()", 2},
+		{"let add = fn(a, b) { a + b }; (spawn add(2, 3)).wait()", 5},
+		{"let x = 1; let t = spawn fn() { x + 1 }; t.wait()", 2},
+		{"spawn fn() { 1 }", "task"},
+		{"let ch = channel(); spawn fn() { send(ch, 42) }; recv(ch)", 42},
+		{"let ch = channel(2); send(ch, 1); send(ch, 2); recv(ch) + recv(ch)", 3},
+		{"let ch = channel(1); ch.send(7); ch.recv()", 7},
+		{"let ch = channel(1); close(ch); recv(ch)", nil},
+		{"let ch = channel(1); send(ch, 1); close(ch); [recv(ch), recv(ch)]", "[1, null]"},
+		{"channel(3)", "channel(3)"},
+		{"channel()", "channel(0)"},
+		{"let ch = channel(3); send(ch, 1); send(ch, 2); close(ch); collect(map_lazy(ch, fn(x) { x * 10 }))", "[10, 20]"},
+		{
+			`let results = channel(10);
+			let square = fn(n) { send(results, n * n) };
+			let tasks = [1, 2, 3, 4].map(fn(n) { spawn square(n) });
+			tasks.map(fn(t) { t.wait() });
+			close(results);
+			len(collect(results))`,
+			4,
+		},
+		{"let ch = channel(1); select { case send(ch, 3) { recv(ch) } }", 3},
+		{"let ch = channel(1); send(ch, 5); select { case let v = recv(ch) { v * 2 } }", 10},
+		{"let ch = channel(); select { case recv(ch) { 1 } default { 2 } }", 2},
+		{"let ch = channel(1); close(ch); select { case let v = recv(ch) { v } }", nil},
+		{"let a = channel(); let b = channel(1); send(b, 9); select { case recv(a) { 0 } case let v = recv(b) { v } }", 9},
+		{"let v = 1; let ch = channel(1); send(ch, 2); select { case let v = recv(ch) { v } }; v", 1},
+		{"let f = fn() { select { default { return 4 } }; 5 }; f()", 4},
+		{"let ch = channel(); let t = spawn fn() { select { case let v = recv(ch) { v + 1 } } }; send(ch, 1); t.wait()", 2},
+		{
+			`let counter = channel(1);
+			send(counter, 0);
+			let incr = fn() { send(counter, recv(counter) + 1) };
+			let tasks = [spawn incr(), spawn incr(), spawn incr(), spawn incr()];
+			tasks.map(fn(t) { t.wait() });
+			recv(counter)`,
+			4,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, tt.input, int64(expected))
+		case nil:
+			testNullObject(t, evaluated, tt.input)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+// TestConcurrentMutation is meant to be run with -race: spawned tasks write to
+// the same array, hash, struct and instance while the main task reads them.
+func TestConcurrentMutation(t *testing.T) {
+	input := `
+struct Point { x, y }
+class Box { init() { self.n = 0 } }
+let xs = [];
+let h = {};
+let p = Point(0, 0);
+let b = Box();
+let work = fn(n) {
+	[i for i in 0..49].map(fn(i) {
+		xs.push(i);
+		h.x = i;
+		p.x = i;
+		b.n = i;
+		len(xs) + len(h) + p.y + b.n;
+		xs.pop();
+	})
+};
+let tasks = [spawn work(1), spawn work(2), spawn work(3), spawn work(4)];
+[i for i in 0..49].map(fn(i) { [len(xs), h.x, p.x, b.n] });
+tasks.map(fn(t) { t.wait() });
+[len(xs), len(h)]`
+
+	evaluated := testEval(input)
+	if evaluated.Inspect() != "[0, 1]" {
+		t.Errorf("wrong result. expected=%q, got=%q", "[0, 1]", evaluated.Inspect())
+	}
+}
+
+func TestConcurrencyErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"(spawn fn() { x }).wait()", "identifier not found: x"},
+		{"(spawn 5).wait()", "not a function: INTEGER"},
+		{"(spawn fn(a) { a }).wait()", "wrong number of arguments. got=0, want=1"},
+		{"spawn f(1)", "identifier not found: f"},
+		{"spawn len(x)", "identifier not found: x"},
+		{"(spawn fn() { yield 1 }).wait()", "yield outside of a generator"},
+		{"channel(\"a\")", "argument to `channel` must be INTEGER, got STRING"},
+		{"channel(-1)", "invalid channel capacity: -1"},
+		{"channel(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"send(1, 2)", "argument to `send` must be CHANNEL, got INTEGER"},
+		{"recv([])", "argument to `recv` must be CHANNEL, got ARRAY"},
+		{"let ch = channel(1); close(ch); send(ch, 1)", "send on closed channel"},
+		{"let ch = channel(1); close(ch); close(ch)", "close of closed channel"},
+		{"let ch = channel(1); close(ch); select { case send(ch, 1) { 1 } }", "send on closed channel"},
+		{"select { case recv(1) { 1 } }", "argument to `recv` must be CHANNEL, got INTEGER"},
+		{"let ch = channel(); select { case send(ch) { 1 } }", "wrong number of arguments. got=1, want=2"},
+		{"let ch = channel(1); select { case send(ch, x) { 1 } }", "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+func TestOptionalChaining(t *testing.T) {
+	user := `let user = {"name": "ann", "address": {"city": "Oslo"}, "greet": fn(x) { "hi " + x }};`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`user?.address?.city`, "Oslo"},
+		{`user["address"]?.["city"]`, "Oslo"},
+		{`user["billing"]?.["city"]`, nil},
+		{`user.billing?.city`, nil},
+		{`user.billing?.city.name.first`, nil},
+		{`user.billing?.["city"]["zip"]`, nil},
+		{`user.billing?.lines[0].len()`, nil},
+		{`user.greet?.("bob")`, "hi bob"},
+		{`user.wave?.("bob")`, nil},
+		{`user.wave?.(x)`, nil},
+		{`user.name?.upper()`, "ANN"},
+		{`let f = fn() { }; f()?.x`, nil},
+		{`[1, 2]?.[1]`, 2},
+		{`let calls = {"n": 0}; let tick = fn() { calls.n = calls.n + 1 }; user.none?.[tick()]; calls.n`, 0},
+	}
+
+	for _, tt := range tests {
+		input := user + tt.input
+		evaluated := testEval(input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, input, int64(expected))
+		case nil:
+			testNullObject(t, evaluated, input)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String for `%s`. got=%T (%+v)", input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong value for `%s`. expected=%q, got=%q", input, expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestNullishCoalescing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{}["port"] ?? 8080`, 8080},
+		{`{"port": 80}["port"] ?? 8080`, 80},
+		{"0 ?? 1", 0},
+		{"false ?? true", false},
+		{"{}.a ?? {}.b ?? 3", 3},
+		{"{}.a ?? {}.b", nil},
+		{`let cfg = {}; cfg?.db?.host ?? "localhost"`, "localhost"},
+		{`let calls = {"n": 0}; let tick = fn() { calls.n = calls.n + 1 }; 1 ?? tick(); calls.n`, 0},
+		{"{}.a ?? 1 + 2", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, tt.input, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, tt.input, expected)
+		case nil:
+			testNullObject(t, evaluated, tt.input)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestSpreadElements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1, 2]; let b = [4]; [...a, 3, ...b]", "[1, 2, 3, 4]"},
+		{"[...[], ...[]]", "[]"},
+		{`[..."ab", "c"]`, "[a, b, c]"},
+		{"fn* g() { yield 1; yield 2 }; [0, ...g()]", "[0, 1, 2]"},
+		{"[...take([5, 6, 7], 2)]", "[5, 6]"},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[1, 2], 3)", "6"},
+		{"let add = fn(a, b) { a + b }; let args = [1, 2]; add(...args)", "3"},
+		{"len(...[[1, 2, 3]])", "3"},
+		{`let d = {"host": "x", "port": 80}; let c = {...d, "port": 8080}; [c["host"], c["port"], d["port"]]`, "[x, 8080, 80]"},
+		{`let d = {"port": 80}; {"port": 8080, ...d}["port"]`, "80"},
+		{`let a = {"x": 1}; let b = {"x": 2, "y": 3}; let c = {...a, ...b}; [c["x"], c["y"], len(c)]`, "[2, 3, 2]"},
+		{"len({...{}})", "0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSpreadElementErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"[...5]", "spread of non-iterable: INTEGER"},
+		{"[1, ...true]", "spread of non-iterable: BOOLEAN"},
+		{"len(...fn(x) { x })", "spread of non-iterable: FUNCTION"},
+		{"[...x]", "identifier not found: x"},
+		{"{...[1, 2]}", "spread of non-hash: ARRAY"},
+		{`{"a": 1, ..."a"}`, "spread of non-hash: STRING"},
+		{"{...x}", "identifier not found: x"},
+		{"fn* g() { yield 1; y }; [...g()]", "identifier not found: y"},
+		{"fn(a) { a }(...[1, 2])", "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[x * 2 for x in [1, -2, 3] if x > 0]", "[2, 6]"},
+		{"[x for x in []]", "[]"},
+		{`[c + c for c in "abc"]`, "[aa, bb, cc]"},
+		{"[[x, y] for x in [1, 2] for y in [3, 4] if x + y != 5]", "[[1, 3], [2, 4]]"},
+		{"[y for x in [[1, 2], [3]] for y in x]", "[1, 2, 3]"},
+		{"[a * b for [a, b] in [[1, 2], [3, 4]]]", "[2, 12]"},
+		{"enum S { A(v), B }; [v for S.A(v) in [S.A(1), S.A(2)]]", "[1, 2]"},
+		{"fn* g() { yield 1; yield 2 }; [x + 10 for x in g()]", "[11, 12]"},
+		{"[x for x in take(map_lazy([1, 2, 3], fn(x) { x * x }), 2)]", "[1, 4]"},
+		{"let n = 2; [x * n for x in [1, 2]]", "[2, 4]"},
+		{"let x = 100; [x for x in [1, 2]]; x", "100"},
+		{"[x for x in [1]]; let y = 1; y", "1"},
+		{"[[y * x for y in [1, 2]] for x in [1, 10]]", "[[1, 2], [10, 20]]"},
+		{`let h = {k: v * 10 for [k, v] in [["a", 1], ["b", 2]]}; [h["a"], h["b"], len(h)]`, "[10, 20, 2]"},
+		{`{x: true for x in [1, 1, 2]}.len()`, "2"},
+		{`let h = {"a": 1}; {k: h[k] + 1 for k in h}["a"]`, "2"},
+		{"let f = fn(xs) { [x for x in xs if x > 1] }; f([1, 2, 3])", "[2, 3]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestComprehensionErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"[x for x in 5]", "not iterable: INTEGER"},
+		{"[x for x in y]", "identifier not found: y"},
+		{"[x + true for x in [1]]", "type mismatch: INTEGER + BOOLEAN"},
+		{"[x for x in [1] if z]", "identifier not found: z"},
+		{"[x for [x, y] in [[1]]]", "pattern mismatch: [x, y] does not match [1]"},
+		{"[x for x in [1]]; x", "identifier not found: x"},
+		{"{[x]: 1 for x in [1]}", "unable to hash key: ARRAY"},
+		{"{x: y for x in [1]}", "identifier not found: y"},
+		{"fn* g() { yield 1; z }; [x for x in g()]", "identifier not found: z"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+func TestRanges(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1..5", "1..5"},
+		{"0..<5", "0..<5"},
+		{"0..100 step 5", "0..100 step 5"},
+		{"[len(1..5), len(0..<5), len(5..1), len(0..100 step 5), len(0..<100 step 5)]", "[5, 5, 0, 21, 20]"},
+		{"[len(10..1 step -3), len(10..<1 step -3), len(1..1), len(1..<1)]", "[4, 3, 1, 0]"},
+		{"let r = 0..<10 step 3; [r[0], r[1], r[3], r[4], r[-1], r[-4], r[-5]]", "[0, 3, 9, null, 9, 0, null]"},
+		{"(1..1000000000000)[999999999999]", "1000000000000"},
+		{"len(-1000000000000..1000000000000)", "2000000000001"},
+		{"[3 in 1..5, 6 in 1..5, 5 in 1..<5, 4 in 0..10 step 2, 5 in 0..10 step 2]", "[true, false, false, true, false]"},
+		{"[7 in 10..1 step -3, 11 in 10..1 step -3, 1 in 10..1 step -3, \"a\" in 1..5]", "[true, false, true, false]"},
+		{"999999999999 in 0..1000000000000 step 3", "true"},
+		{"[x * x for x in 1..5]", "[1, 4, 9, 16, 25]"},
+		{"[x for x in 10..1 step -4]", "[10, 6, 2]"},
+		{"[...0..<3, 3]", "[0, 1, 2, 3]"},
+		{"collect(take(1..1000000000000, 3))", "[1, 2, 3]"},
+		{"let n = 3; [x for x in 0..<n]", "[0, 1, 2]"},
+		{"(0..100 step 5).slice(2, 5)", "10..<25 step 5"},
+		{"(0..<10).slice(-3, 100)", "7..<10"},
+		{"(0..<10).slice(5, 2).len()", "0"},
+		{"[x for x in (1..10 step 2).slice(1, -1)]", "[3, 5, 7]"},
+		{"(0..<1000000000000).slice(1, 3).len()", "2"},
+		{"[(1..3) == (1..<4), (1..3) == (1..4), (0..<0) == (5..1), (1..1) == (1..1 step 9)]", "[true, false, true, true]"},
+		{"(1..3) == [1, 2, 3]", "false"},
+		{"let a = [1]; [2 in [1, 2], 3 in [1, 2], a in [a], [1] in [[1]]]", "[true, false, true, false]"},
+		{`["ell" in "hello", "x" in "hello"]`, "[true, false]"},
+		{`["a" in {"a": 1}, "b" in {"a": 1}]`, "[true, false]"},
+		{"type(1..2)", "RANGE"},
+		{"[len(0..<9223372036854775807), (0..<9223372036854775807)[5], (0..<9223372036854775807)[-1]]", "[9223372036854775807, 5, 9223372036854775806]"},
+		{"[len(-9223372036854775806..0), len(1..9223372036854775807), len(9223372036854775807..-9223372036854775807 step -3)]", "[9223372036854775807, 9223372036854775807, 6148914691236517205]"},
+		{"[len(-9223372036854775807 - 1..9223372036854775807 step 3), len(0..9223372036854775807 step -1)]", "[6148914691236517206, 0]"},
+		{"[9223372036854775806 in 0..<9223372036854775807, -9223372036854775806 in 9223372036854775807..-9223372036854775807 step -3, -9223372036854775805 in 9223372036854775807..-9223372036854775807 step -3]", "[true, false, true]"},
+		{"(9223372036854775800..9223372036854775807).slice(5, 100)", "9223372036854775805..9223372036854775807"},
+		{"collect((9223372036854775800..9223372036854775807 step 3).slice(1, 5))", "[9223372036854775803, 9223372036854775806]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestRangeErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"1..true", "range bound must be INTEGER, got BOOLEAN"},
+		{`"a"..5`, "range bound must be INTEGER, got STRING"},
+		{"1..5 step \"a\"", "range step must be INTEGER, got STRING"},
+		{"1..5 step 0", "range step cannot be zero"},
+		{"0..9223372036854775807", "range too long: 0..9223372036854775807"},
+		{"-9223372036854775807 - 1..<9223372036854775807", "range too long: -9223372036854775808..<9223372036854775807"},
+		{"9223372036854775807..-9223372036854775807 - 1 step -1", "range too long: 9223372036854775807..-9223372036854775808 step -1"},
+		{"1..x", "identifier not found: x"},
+		{"(1..5).slice(1)", "wrong number of arguments. got=1, want=2"},
+		{"(1..5).slice(1, true)", "argument to `slice` must be INTEGER, got BOOLEAN"},
+		{"(1..5)[\"a\"]", `index operator not supported: ((1..5)["a"])`},
+		{"1 in 2", "unknown infix operation: INTEGER in INTEGER"},
+		{"1 in \"abc\"", "type mismatch: INTEGER in STRING"},
+		{"[1] in {}", "unable to hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+func TestBlockScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; if (true) { let x = 2; x }", "2"},
+		{"let x = 1; if (true) { let x = 2 }; x", "1"},
+		{"let x = 1; if (false) { 0 } else { let x = 2 }; x", "1"},
+		{"let x = {}; if (true) { x.n = 2 }; x.n", "2"},
+		{"let x = {}; if (true) { if (true) { let x = {}; x.n = 4 }; x.m = 1 }; [x.n, x.m]", "[null, 1]"},
+		{"let f = fn(n) { if (n > 0) { let n = 0 }; n }; f(5)", "5"},
+		{"let f = fn() { let t = {}; if (true) { t.n = 2; let t = 10 }; t.n }; f()", "2"},
+		{"if (true) { fn g() { 1 } }; let g = 2; g", "2"},
+		{"let fs = {}; if (true) { let v = 7; fs.f = fn() { v } }; fs.f()", "7"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBlockScopeErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"if (true) { let tmp = 1 }; tmp", "identifier not found: tmp"},
+		{"let f = fn() { if (true) { let tmp = 1 }; tmp }; f()", "identifier not found: tmp"},
+		{"if (true) { let tmp = {} }; tmp.x = 2", "identifier not found: tmp"},
+		{"select { default { let d = 1 } }; d", "identifier not found: d"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
+
+func TestLegacyBlockScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { let tmp = 1 }; tmp", "1"},
+		{"let x = 1; if (true) { let x = 2 }; x", "2"},
+		{"let f = fn() { if (true) { let tmp = 3 }; tmp }; f()", "3"},
+		{"let f = fn() { if (true) { let tmp = 3 } }; f(); tmp", "ERROR: identifier not found: tmp"},
+		{"fn* g() { if (true) { let v = 4 }; yield v }; g().next()", "4"},
+		{"let t = spawn fn() { if (true) { let v = 5 }; v }(); t.wait()", "5"},
+		{"class C { init() { if (true) { let v = 6 }; self.v = v } }; C().v", "6"},
+		{"let f = fn(x) { if (true) { let y = x }; y }; collect(map_lazy([7], f))", "[7]"},
+		{"let f = fn(x) { if (true) { let y = x }; y }; collect(take([8], 1).map(f))", "[8]"},
+		{"struct S { v = fn() { if (true) { let y = 9 }; y }() }; S().v", "9"},
+		{"let m = macro() { if (true) { let q = quote(10) }; q }; m()", "10"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalMacros(tt.input, WithLegacyBlockScope())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestResolvedLocals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() { let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5) }; f()", "120"},
+		{"let f = fn() { let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(10) }; f()", "true"},
+		{"let x = 1; let f = fn() { let g = fn() { x }; let a = g(); let x = 2; [a, g()] }; f()", "[1, 2]"},
+		{"let counter = fn() { let s = {}; s.n = 0; fn() { s.n = s.n + 1 } }; let c = counter(); c(); c()", "2"},
+		{"let f = fn(x) { let x = x * 2; x }; f(3)", "6"},
+		{"let f = fn(xs) { let [a, _, b] = xs; a + b }; f([1, 2, 3])", "4"},
+		{"let f = fn(y) { [x + y for x in 1..3] }; f(10)", "[11, 12, 13]"},
+		{"let f = fn() { struct P { x = y }; let y = 7; P().x }; f()", "7"},
+		{"class C { init(v) { let w = v; self.get = fn() { w + v } } }; C(2).get()", "4"},
+		{"let f = fn(ch) { send(ch, 1); select { case let v = recv(ch) { v + 1 } } }; f(channel(1))", "2"},
+		{"let f = fn(x) { quote(unquote(x) + 1) }; f(2)", "QUOTE((2 + 1))"},
+		{"let f = fn() { len }; f()([1])", "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestLegacyBlockScopeIgnoresSlots(t *testing.T) {
+	program, _ := parser.ParseInput("let f = fn() { if (true) { let v = 1 }; let w = 2; w }; f()")
+	if result := New(object.NewEnvironment()).Eval(program); result.Inspect() != "2" {
+		t.Fatalf("wrong result. got=%s", result.Inspect())
+	}
+
+	// the program keeps the slots it was resolved with, which don't match the
+	// legacy scopes
+	result := New(object.NewEnvironment(), WithLegacyBlockScope()).Eval(program)
+	if result.Inspect() != "2" {
+		t.Errorf("wrong result with legacy block scope. got=%s", result.Inspect())
+	}
+}
+
+// fib25 calls a recursive fib, which spends most of its time looking up n and
+// fib.
+const fib25 = "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(25)"
+
+// BenchmarkFib25 compares the evaluator looking locals up in the slots the
+// resolver gave them with looking every name up through its environments, as
+// it does with legacy block scope, where programs aren't resolved. Blocks don't
+// get scopes of their own then either, so names saves a scope for each branch.
+func BenchmarkFib25(b *testing.B) {
+	if engine != nil {
+		b.Skip("compares the evaluator's own lookups")
+	}
+
+	run := func(b *testing.B, opts ...Option) {
+		for i := 0; i < b.N; i++ {
+			program, _ := parser.ParseInput(fib25)
+			result := New(object.NewEnvironment(), opts...).Eval(program)
+			if result.Inspect() != "75025" {
+				b.Fatalf("wrong result. got=%s", result.Inspect())
+			}
+		}
+	}
+	b.Run("slots", func(b *testing.B) { run(b) })
+	b.Run("names", func(b *testing.B) { run(b, WithLegacyBlockScope()) })
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(n) { if (n == 0) { return 0 }; f(n - 1) }; f(200000)", "0"},
+		{"let f = fn(n, acc) { if (n == 0) { acc } else { f(n - 1, acc + n) } }; f(200000, 0)", "20000100000"},
+		{"let f = fn(n) { if (n > 0) { return f(n - 1) }; \"done\" }; f(200000)", "done"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { if (true) { if (n > 0) { f(n - 1) } } } }; f(200000)", "0"},
+		{
+			"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; " +
+				"let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; odd(200001)",
+			"true",
+		},
+		{"class C { count(n) { if (n == 0) { self } else { self.count(n - 1) } } }; type(C().count(200000))", "C"},
+		{"let f = fn(n) { if (n == 0) { len } else { f?.(n - 1) } }; f(200000)", "builtin function"},
+		{"let f = fn(n) { if (n == 0) { [] } else { [len(f(n - 1))] } }; f(3)", "[1]"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100)", "100"},
+		{"let f = fn() { return len([1, 2]) }; f()", "2"},
+		{"let f = fn(n) { let r = if (n > 0) { n } else { 0 }; r }; f(3)", "3"},
+		{"fn* g(n) { if (n > 0) { yield n; g(n - 1) } }; collect(g(3))", "[3]"},
+		{"let loop = fn(n) { if (n > 0) { yield n; loop(n - 1) } }; fn* g() { loop(3) }; collect(g())", "[3, 2, 1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	legacy := testEval("let f = fn(n) { if (n == 0) { let x = 1 } else { f(n - 1) } }; f(200000); x", WithLegacyBlockScope())
+	if errObj, ok := legacy.(*object.Error); !ok || errObj.Message != "identifier not found: x" {
+		t.Errorf("tail calls leaked bindings in legacy block scope. got=%s", legacy.Inspect())
+	}
+}
+
+func TestTailCallCountdown(t *testing.T) {
+	if testing.Short() {
+		t.Skip("counts down from 10 million")
+	}
+	input := "let countdown = fn(n) { if (n == 0) { return \"liftoff\" }; countdown(n - 1) }; countdown(10000000)"
+	testStringObject(t, testEval(input), input, "liftoff")
+}
+
+func TestRecursionDepth(t *testing.T) {
+	sum := "let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; "
+	tests := []struct {
+		input    string
+		opts     []Option
+		expected string
+	}{
+		{sum + "sum(1000)", nil, "500500"},
+		{sum + "sum(20000)", nil, "ERROR: maximum recursion depth exceeded"},
+		{sum + "sum(49)", []Option{WithMaxDepth(50)}, "1225"},
+		{sum + "sum(50)", []Option{WithMaxDepth(50)}, "ERROR: maximum recursion depth exceeded"},
+		{sum + "sum(100000)", []Option{WithMaxDepth(0)}, "5000050000"},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(100000)", []Option{WithMaxDepth(10)}, "0"},
+		{"let f = fn() { f() + 1 }; f(); 5", nil, "ERROR: maximum recursion depth exceeded"},
+		{"let f = fn(n) { [n].map(fn(x) { f(x + 1) }) }; f(0)", nil, "ERROR: maximum recursion depth exceeded"},
+		{"let f = fn(n) { [n].filter(fn(x) { f(x + 1) }) }; f(0)", nil, "ERROR: maximum recursion depth exceeded"},
+		{"let f = fn() { f() + 1 }; (spawn f()).wait()", nil, "ERROR: maximum recursion depth exceeded"},
+		{"class C { init(n) { if (n > 0) { C(n - 1) } } }; C(100000)", nil, "ERROR: maximum recursion depth exceeded"},
+		{"fn* g() { yield f(1) }; let f = fn(n) { f(n + 1) + 1 }; g().next()", nil, "ERROR: maximum recursion depth exceeded"},
+		{sum + "collect(map_lazy([20000], sum))", []Option{WithMaxDepth(0)}, "[200010000]"},
+		{sum + "collect(map_lazy([50], sum))", []Option{WithMaxDepth(50)}, "ERROR: maximum recursion depth exceeded"},
+		{sum + "struct S { v = sum(20000) }; S().v", []Option{WithMaxDepth(0)}, "200010000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, tt.opts...)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDeeplyNestedExpressions(t *testing.T) {
+	depth := 100000
+	input := strings.Repeat("(1 + ", depth) + "1" + strings.Repeat(")", depth)
+	testIntegerObject(t, testEval(input), "deeply nested sum", int64(depth+1))
+
+	input = strings.Repeat("if (true) { ", depth) + "2" + strings.Repeat(" }", depth)
+	testIntegerObject(t, testEval(input), "deeply nested if", 2)
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"quote(5)", "5"},
+		{"quote(5 + 8)", "(5 + 8)"},
+		{"quote(foobar)", "foobar"},
+		{"quote(foobar + barfoo)", "(foobar + barfoo)"},
+		{"quote(unquote(4))", "4"},
+		{"quote(unquote(4 + 4))", "8"},
+		{"quote(8 + unquote(4 + 4))", "(8 + 8)"},
+		{"quote(unquote(4 + 4) + 8)", "(8 + 8)"},
+		{"let foobar = 8; quote(foobar)", "foobar"},
+		{"let foobar = 8; quote(unquote(foobar))", "8"},
+		{"quote(unquote(true))", "true"},
+		{"quote(unquote(true == false))", "false"},
+		{`quote(unquote("hi"))`, `"hi"`},
+		{"quote(unquote([1, 2 + 3]))", "[1, 5]"},
+		{"quote(unquote(quote(4 + 4)))", "(4 + 4)"},
+		{"let q = quote(4 + 4); quote(unquote(4 + 4) + unquote(q))", "(8 + (4 + 4))"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Errorf("expected *object.Quote for `%s`. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if quote.Node == nil {
+			t.Errorf("quote.Node is nil for `%s`", tt.input)
+			continue
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("wrong quote for `%s`. expected=%q, got=%q", tt.input, tt.expected, quote.Node.String())
+		}
+	}
+}
+
+func TestQuoteLeavesCodeUnchanged(t *testing.T) {
+	input := "let f = fn() { quote(unquote(1 + 1) + x) }; let a = f(); let b = f(); [a, b]"
+	evaluated := testEval(input)
+	expected := "[QUOTE((2 + x)), QUOTE((2 + x))]"
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", input, expected, evaluated.Inspect())
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	program, _ := parser.ParseInput(input)
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("wrong macro parameters. got=%s, %s", macro.Parameters[0], macro.Parameters[1])
+	}
+	expectedBody := "(x + y)"
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let infixExpression = macro() { quote(1 + 2); }; infixExpression();",
+			"(1 + 2)",
+		},
+		{
+			"let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); }; reverse(2 + 2, 10 - 5);",
+			"(10 - 5) - (2 + 2)",
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			"let double = macro(x) { quote(unquote(x) * 2) }; let twice = macro(x) { quote(double(unquote(x)) + double(unquote(x))) }; twice(1)",
+			"((1 * 2) + (1 * 2))",
+		},
+		{
+			"let inc = macro(x) { quote(unquote(x) + 1) }; [inc(1), inc(2)]",
+			"[(1 + 1), (2 + 1)]",
+		},
+	}
+
+	for _, tt := range tests {
+		expected, _ := parser.ParseInput(tt.expected)
+		program, _ := parser.ParseInput(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Errorf("unexpected error for `%s`: %s", tt.input, err.Message)
+			continue
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal for `%s`. want=%q, got=%q", tt.input, expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; unless(1 > 2, 10, 20)", "10"},
+		{"let swap = macro(a, b) { quote([unquote(b), unquote(a)]) }; let x = 1; swap(x, x + 1)", "[2, 1]"},
+		{"let n = 3; let m = macro() { quote(n * 2) }; m()", "6"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalMacros(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for `%s`. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"let m = macro() { 1 }; m()", "macro must return a QUOTE, got INTEGER"},
+		{"let m = macro(a) { quote(unquote(a)) }; m()", "wrong number of arguments. got=0, want=1"},
+		{"let m = macro() { quote(m()) }; m()", "macro expansion too deep: m"},
+		{"let m = macro() { quote(unquote(fn() { 1 })) }; m()", "cannot unquote FUNCTION"},
+		{"let m = macro() { x }; m()", "identifier not found: x"},
+		{"let f = fn() { macro() { 1 } }; f()", "macros can only be defined by a top-level let"},
+		{"quote(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"quote(unquote(1, 2))", "wrong number of arguments. got=2, want=1"},
+		{"quote(unquote({}))", "cannot unquote HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalMacros(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for `%s`. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMsg {
+			t.Errorf(
+				"wrong error message for `%s`. expected=%q, got=%q",
+				tt.input,
+				tt.expectedMsg,
+				errObj.Message,
+			)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package evaluator
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// generator runs the body of a generator function on its own goroutine,
+// handing control back and forth with the caller of Next at each yield so only
+// one side is ever running. mu serializes calls to Next from different tasks.
+type generator struct {
+	mu      sync.Mutex
+	yields  chan object.Object
+	resume  chan struct{}
+	closed  chan struct{}
+	started bool
+	done    bool
+}
+
+// errGeneratorClosed unwinds the body of a suspended generator once its
+// iterator is no longer reachable.
+var errGeneratorClosed = newError("generator closed")
+
+// newGenerator returns an iterator over the values yielded by fn, whose body is
+// run by e.
+func (e *Evaluator) newGenerator(fn *object.Function) *object.Iterator {
+	return startGenerator(func(g *generator) object.Object {
+		m := &machine{}
+		m.pushFrame(&blockFrame{e: e.child(e.env, g), statements: fn.Body.Statements})
+		return m.run()
+	})
+}
+
+// Generator returns an iterator over the values body yields, for generators
+// run by other engines. body runs on its own goroutine from the first call to
+// Next, and yields by calling yield, which returns null once the next value is
+// asked for. It returns an error instead once the iterator is no longer
+// reachable, which body should return to be unwound.
+func Generator(body func(yield func(value object.Object) object.Object) object.Object) *object.Iterator {
+	return startGenerator(func(g *generator) object.Object {
+		return body(g.yield)
+	})
+}
+
+// startGenerator returns an iterator over the values yielded by body, which is
+// run with the generator it yields through.
+func startGenerator(body func(g *generator) object.Object) *object.Iterator {
+	g := &generator{
+		yields: make(chan object.Object),
+		resume: make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+
+	it := &object.Iterator{Name: "generator", Next: func() (object.Object, bool) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		if g.done {
+			return nil, false
+		}
+		if !g.started {
+			g.started = true
+			go g.run(body)
+		}
+
+		g.resume <- struct{}{}
+		value, ok := <-g.yields
+		if !ok || isError(value) {
+			g.done = true
+		}
+		return value, ok
+	}}
+
+	// the goroutine only holds on to the generator state, so an abandoned
+	// iterator can still be collected and its body unwound. The iterator can
+	// become unreachable while a call to Next is still running, in which case
+	// closing waits for a later collection
+	var finalize func(*object.Iterator)
+	finalize = func(it *object.Iterator) {
+		if !g.mu.TryLock() {
+			runtime.SetFinalizer(it, finalize)
+			return
+		}
+		defer g.mu.Unlock()
+		close(g.closed)
+	}
+	runtime.SetFinalizer(it, finalize)
+	return it
+}
+
+func (g *generator) run(body func(g *generator) object.Object) {
+	defer close(g.yields)
+
+	select {
+	case <-g.resume:
+	case <-g.closed:
+		return
+	}
+
+	result := unwrapReturnValue(body(g))
+	if isError(result) && result != errGeneratorClosed {
+		select {
+		case g.yields <- result:
+		case <-g.closed:
+		}
+	}
+}
+
+// yield hands value to the caller of Next and suspends until the next value is
+// requested.
+func (g *generator) yield(value object.Object) object.Object {
+	select {
+	case g.yields <- value:
+	case <-g.closed:
+		return errGeneratorClosed
+	}
+
+	select {
+	case <-g.resume:
+		return NULL
+	case <-g.closed:
+		return errGeneratorClosed
+	}
+}
+
+// Iterate returns an iterator over the elements of obj. Arrays yield their
+// elements, strings their characters, hashes their keys and channels the values
+// received until they're closed.
+func Iterate(obj object.Object) (*object.Iterator, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Iterator:
+		return obj, nil
+	case *object.Array:
+		return sliceIterator(obj.Snapshot()), nil
+	case *object.String:
+		chars := []object.Object{}
+		for _, ch := range obj.Value {
+			chars = append(chars, &object.String{Value: string(ch)})
+		}
+		return sliceIterator(chars), nil
+	case *object.Hash:
+		keys := []object.Object{}
+		for _, pair := range obj.Snapshot() {
+			keys = append(keys, pair.Key)
+		}
+		return sliceIterator(keys), nil
+	case *object.Range:
+		return rangeIterator(obj), nil
+	case *object.Channel:
+		return &object.Iterator{Name: "iterator", Next: func() (object.Object, bool) {
+			value, ok := <-obj.Ch
+			return value, ok
+		}}, nil
+	default:
+		return nil, newError("not iterable: %s", obj.Type())
+	}
+}
+
+func sliceIterator(elements []object.Object) *object.Iterator {
+	idx := 0
+	return &object.Iterator{Name: "iterator", Next: func() (object.Object, bool) {
+		if idx >= len(elements) {
+			return nil, false
+		}
+		idx++
+		return elements[idx-1], true
+	}}
+}
+
+// Collect drains it into an array, stopping at the first error.
+func Collect(it *object.Iterator) object.Object {
+	elements := []object.Object{}
+	for {
+		value, ok := it.Next()
+		if !ok {
+			return &object.Array{Elements: elements}
+		}
+		if isError(value) {
+			return value
+		}
+		elements = append(elements, value)
+	}
+}
@@ -0,0 +1,123 @@
+package evaluator
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// machine evaluates nodes on an explicit stack of frames kept on the heap, so
+// neither deep recursion nor deeply nested expressions grow the Go stack. Only
+// the depth limit of the evaluators making calls bounds how deep it gets.
+type machine struct {
+	frames []frame
+	result object.Object
+}
+
+// frame is a node being evaluated, or a function being called, on the stack of
+// a machine. It's stepped once it's pushed, with a nil result, and again with
+// the result of each frame it pushes, until it hands its result to the frame
+// below with ret, or its place to another frame with replace. A step does one
+// of those things, or pushes one frame, before it returns.
+type frame interface {
+	step(m *machine, result object.Object)
+}
+
+// returnTarget is a frame a returned value unwinds to, taking it out of its
+// ReturnValue: a function call, or a program.
+type returnTarget interface {
+	frame
+	returnTarget()
+}
+
+// position is where a node is evaluated, for the nodes whose evaluation depends
+// on it.
+type position int
+
+const (
+	// plain is anywhere else.
+	plain position = iota
+	// tail is the value of a function body. A call made there replaces the
+	// frame of the function making it, so tail recursion doesn't nest.
+	tail
+	// link is the inside of a chain of member, index and call expressions. A
+	// link that an optional link short-circuits returns skipped.
+	link
+)
+
+// skipped is the result of a link of a chain that an optional link has
+// short-circuited, until it reaches the end of the chain, which is null.
+var skipped object.Object = &skippedLink{}
+
+// skippedLink has a field so that skipped can't share an address with NULL,
+// as zero-sized values may.
+type skippedLink struct{ _ byte }
+
+func (*skippedLink) Type() object.ObjectType { return object.NULL_OBJ }
+func (*skippedLink) Inspect() string         { return "null" }
+
+// run steps the frames on top of the stack until they've all returned,
+// returning the last result.
+func (m *machine) run() object.Object {
+	for len(m.frames) > 0 {
+		result := m.result
+		m.result = nil
+		m.frames[len(m.frames)-1].step(m, result)
+	}
+	return m.result
+}
+
+func (m *machine) pushFrame(f frame) {
+	m.frames = append(m.frames, f)
+}
+
+func (m *machine) pop() {
+	m.frames[len(m.frames)-1] = nil
+	m.frames = m.frames[:len(m.frames)-1]
+}
+
+// ret pops the frame on top, handing its result to the frame below.
+func (m *machine) ret(result object.Object) {
+	m.pop()
+	m.deliver(result)
+}
+
+// deliver hands result to the frame on top. An error stops evaluation, and a
+// returned value unwinds to the innermost return target.
+func (m *machine) deliver(result object.Object) {
+	switch result.(type) {
+	case nil:
+		result = NULL
+	case *object.Error:
+		for len(m.frames) > 0 {
+			m.pop()
+		}
+	case *object.ReturnValue:
+		for len(m.frames) > 0 {
+			if _, ok := m.frames[len(m.frames)-1].(returnTarget); ok {
+				break
+			}
+			m.pop()
+		}
+	}
+	m.result = result
+}
+
+// skip returns the result of a link of a chain an optional link has
+// short-circuited, at pos.
+func (m *machine) skip(pos position) {
+	if pos == link {
+		m.ret(skipped)
+		return
+	}
+	m.ret(NULL)
+}
+
+// innermostFunction returns the index of the innermost function frame, or -1
+// if there is none.
+func (m *machine) innermostFunction() int {
+	for idx := len(m.frames) - 1; idx >= 0; idx-- {
+		if _, ok := m.frames[idx].(*functionFrame); ok {
+			return idx
+		}
+	}
+	return -1
+}
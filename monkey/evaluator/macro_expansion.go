@@ -0,0 +1,111 @@
+package evaluator
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// maxExpansionDepth limits how many times the code returned by a macro can
+// itself be expanded, to catch macros that expand to calls to themselves.
+const maxExpansionDepth = 100
+
+// DefineMacros moves the macros defined by the top-level lets of program into
+// env.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := []ast.Statement{}
+	for _, stmt := range program.Statements {
+		if !isMacroDefinition(stmt) {
+			statements = append(statements, stmt)
+			continue
+		}
+
+		let := stmt.(*ast.LetStatement)
+		literal := let.Value.(*ast.MacroLiteral)
+		env.Set(let.Name.Value, &object.Macro{
+			Parameters: literal.Parameters,
+			Body:       literal.Body,
+			Env:        env,
+		})
+	}
+	program.Statements = statements
+}
+
+func isMacroDefinition(stmt ast.Statement) bool {
+	let, ok := stmt.(*ast.LetStatement)
+	if !ok || let.Name == nil {
+		return false
+	}
+	_, ok = let.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+// ExpandMacros replaces the calls in program to the macros in env with the
+// code the macros return for them. Arguments are passed to a macro as quotes of
+// their code. The bodies of macros are evaluated with opts.
+func ExpandMacros(program ast.Node, env *object.Environment, opts ...Option) (ast.Node, *object.Error) {
+	return expandMacros(program, env, 0, opts)
+}
+
+func expandMacros(node ast.Node, env *object.Environment, depth int, opts []Option) (ast.Node, *object.Error) {
+	var err *object.Error
+	expanded := ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		macro, ok := macroOf(call, env)
+		if !ok {
+			return node
+		}
+		if depth >= maxExpansionDepth {
+			err = newError("macro expansion too deep: %s", call.Function.String())
+			return node
+		}
+
+		var result ast.Node
+		if result, err = expandMacroCall(macro, call, opts); err != nil {
+			return node
+		}
+		if result, err = expandMacros(result, env, depth+1, opts); err != nil {
+			return node
+		}
+		return result
+	})
+	return expanded, err
+}
+
+func macroOf(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+// expandMacroCall evaluates the body of macro for call, returning the code it
+// quotes.
+func expandMacroCall(macro *object.Macro, call *ast.CallExpression, opts []Option) (ast.Node, *object.Error) {
+	if len(call.Arguments) != len(macro.Parameters) {
+		return nil, wrongArgCountError(len(macro.Parameters), len(call.Arguments))
+	}
+
+	env := object.NewEnclosedEnvironment(macro.Env)
+	for idx, param := range macro.Parameters {
+		env.Set(param.Value, &object.Quote{Node: call.Arguments[idx]})
+	}
+
+	evaluated := unwrapReturnValue(New(env, opts...).Eval(macro.Body))
+	if err, ok := evaluated.(*object.Error); ok {
+		return nil, err
+	}
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		return nil, newError("macro must return a QUOTE, got %s", evaluated.Type())
+	}
+	return quote.Node, nil
+}
@@ -0,0 +1,255 @@
+package evaluator
+
+import (
+	"strings"
+
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// Caller makes the calls of methods that take a function, like map. A method
+// is bound to the Caller of the engine that looked it up, so its callbacks
+// count towards that engine's depth.
+type Caller interface {
+	Callback(fn object.Object, args ...object.Object) object.Object
+}
+
+type method func(c Caller, receiver object.Object, args ...object.Object) object.Object
+
+// methods is populated in init since some methods call back into the evaluator,
+// which would otherwise be an initialization cycle.
+var methods map[object.ObjectType]map[string]method
+
+func init() {
+	methods = map[object.ObjectType]map[string]method{
+		object.STRING_OBJ: {
+			"len":      fromBuiltin(__len),
+			"first":    fromBuiltin(__first),
+			"last":     fromBuiltin(__last),
+			"upper":    stringUpper,
+			"lower":    stringLower,
+			"trim":     stringTrim,
+			"split":    stringSplit,
+			"contains": stringContains,
+		},
+		object.ARRAY_OBJ: {
+			"len":    fromBuiltin(__len),
+			"first":  fromBuiltin(__first),
+			"last":   fromBuiltin(__last),
+			"push":   fromBuiltin(__arrayPush),
+			"pop":    arrayPop,
+			"join":   arrayJoin,
+			"map":    arrayMap,
+			"filter": arrayFilter,
+		},
+		object.HASH_OBJ: {
+			"len":    fromBuiltin(__len),
+			"keys":   hashKeys,
+			"values": hashValues,
+			"has":    hashHas,
+		},
+		object.ITERATOR_OBJ: {
+			"next":    iteratorNext,
+			"take":    fromBuiltin(__take),
+			"map":     fromCallbackBuiltin(__mapLazy),
+			"collect": fromBuiltin(__collect),
+		},
+		object.CHANNEL_OBJ: {
+			"send":  fromBuiltin(__send),
+			"recv":  fromBuiltin(__recv),
+			"close": fromBuiltin(__close),
+		},
+		object.RANGE_OBJ: {
+			"len":   fromBuiltin(__len),
+			"slice": rangeSlice,
+		},
+		object.TASK_OBJ: {
+			"wait": taskWait,
+		},
+	}
+}
+
+func fromBuiltin(fn object.BuiltinFunction) method {
+	return func(c Caller, receiver object.Object, args ...object.Object) object.Object {
+		return fn(append([]object.Object{receiver}, args...)...)
+	}
+}
+
+func fromCallbackBuiltin(fn callbackBuiltin) method {
+	return func(c Caller, receiver object.Object, args ...object.Object) object.Object {
+		return fn(c, append([]object.Object{receiver}, args...)...)
+	}
+}
+
+// bindMethod binds fn to receiver and c.
+func bindMethod(c Caller, receiver object.Object, fn method) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return fn(c, receiver, args...)
+	}}
+}
+
+func stringUpper(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return wrongArgCountError(0, len(args))
+	}
+	return &object.String{Value: strings.ToUpper(receiver.(*object.String).Value)}
+}
+
+func stringLower(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return wrongArgCountError(0, len(args))
+	}
+	return &object.String{Value: strings.ToLower(receiver.(*object.String).Value)}
+}
+
+func stringTrim(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return wrongArgCountError(0, len(args))
+	}
+	return &object.String{Value: strings.TrimSpace(receiver.(*object.String).Value)}
+}
+
+func stringSplit(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+	sep, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `split` must be STRING, got %s", args[0].Type())
+	}
+
+	parts := strings.Split(receiver.(*object.String).Value, sep.Value)
+	elements := make([]object.Object, len(parts))
+	for idx, part := range parts {
+		elements[idx] = &object.String{Value: part}
+	}
+	return &object.Array{Elements: elements}
+}
+
+func stringContains(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+	sub, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `contains` must be STRING, got %s", args[0].Type())
+	}
+	return nativeBoolToBooleanObject(strings.Contains(receiver.(*object.String).Value, sub.Value))
+}
+
+func arrayPop(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return wrongArgCountError(0, len(args))
+	}
+	last, ok := receiver.(*object.Array).Pop()
+	if !ok {
+		return NULL
+	}
+	return last
+}
+
+func arrayJoin(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+	sep, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `join` must be STRING, got %s", args[0].Type())
+	}
+
+	parts := []string{}
+	for _, elem := range receiver.(*object.Array).Snapshot() {
+		parts = append(parts, elem.Inspect())
+	}
+	return &object.String{Value: strings.Join(parts, sep.Value)}
+}
+
+func arrayMap(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+
+	elements := []object.Object{}
+	for _, elem := range receiver.(*object.Array).Snapshot() {
+		result := c.Callback(args[0], elem)
+		if isError(result) {
+			return result
+		}
+		elements = append(elements, result)
+	}
+	return &object.Array{Elements: elements}
+}
+
+func arrayFilter(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+
+	elements := []object.Object{}
+	for _, elem := range receiver.(*object.Array).Snapshot() {
+		result := c.Callback(args[0], elem)
+		if isError(result) {
+			return result
+		}
+		if isObjTruthy(result) {
+			elements = append(elements, elem)
+		}
+	}
+	return &object.Array{Elements: elements}
+}
+
+func hashKeys(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return wrongArgCountError(0, len(args))
+	}
+
+	keys := []object.Object{}
+	for _, pair := range receiver.(*object.Hash).Snapshot() {
+		keys = append(keys, pair.Key)
+	}
+	return &object.Array{Elements: keys}
+}
+
+func hashValues(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return wrongArgCountError(0, len(args))
+	}
+
+	values := []object.Object{}
+	for _, pair := range receiver.(*object.Hash).Snapshot() {
+		values = append(values, pair.Value)
+	}
+	return &object.Array{Elements: values}
+}
+
+func hashHas(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return wrongArgCountError(1, len(args))
+	}
+	key, ok := object.HashKeyOf(args[0])
+	if !ok {
+		return hashKeyError(args[0])
+	}
+	_, ok = receiver.(*object.Hash).Get(key)
+	return nativeBoolToBooleanObject(ok)
+}
+
+// iteratorNext returns the next value of the iterator, or null once it's
+// exhausted.
+func iteratorNext(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return wrongArgCountError(0, len(args))
+	}
+	value, ok := receiver.(*object.Iterator).Next()
+	if !ok {
+		return NULL
+	}
+	return value
+}
+
+// taskWait blocks until the task has finished, returning its result.
+func taskWait(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return wrongArgCountError(0, len(args))
+	}
+	return receiver.(*object.Task).Wait()
+}
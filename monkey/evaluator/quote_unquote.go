@@ -0,0 +1,86 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+// quote returns node unevaluated, apart from the calls to unquote in it, which
+// are replaced by the values of their arguments.
+func (e *Evaluator) quote(node ast.Node) object.Object {
+	return Quote(node, e.Eval)
+}
+
+// Quote returns node as a quote, replacing the calls to unquote in it with
+// what unquote returns for their arguments. They're replaced in the order
+// ast.Modify visits them, and only until one is an error.
+func Quote(node ast.Node, unquote func(arg ast.Node) object.Object) object.Object {
+	var err *object.Error
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil || !isUnquoteCall(call) {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			err = wrongArgCountError(1, len(call.Arguments))
+			return node
+		}
+
+		unquoted := unquote(call.Arguments[0])
+		if isError(unquoted) {
+			err = unquoted.(*object.Error)
+			return node
+		}
+		var replacement ast.Node
+		replacement, err = objectToNode(unquoted)
+		if err != nil {
+			return node
+		}
+		return replacement
+	})
+
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+func isUnquoteCall(call *ast.CallExpression) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "unquote"
+}
+
+// objectToNode returns the literal for obj, to splice into quoted code.
+func objectToNode(obj object.Object) (ast.Node, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		tok := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value)}
+		return &ast.IntegerLiteral{Token: tok, Value: obj.Value}, nil
+	case *object.Boolean:
+		tok := token.Token{Type: token.FALSE, Literal: "false"}
+		if obj.Value {
+			tok = token.Token{Type: token.TRUE, Literal: "true"}
+		}
+		return &ast.Boolean{Token: tok, Value: obj.Value}, nil
+	case *object.String:
+		tok := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: tok, Value: obj.Value}, nil
+	case *object.Array:
+		array := &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}}
+		for _, elem := range obj.Snapshot() {
+			node, err := objectToNode(elem)
+			if err != nil {
+				return nil, err
+			}
+			array.Elements = append(array.Elements, node.(ast.Expression))
+		}
+		return array, nil
+	case *object.Quote:
+		return obj.Node, nil
+	default:
+		return nil, newError("cannot unquote %s", obj.Type())
+	}
+}
@@ -0,0 +1,184 @@
+package evaluator
+
+import (
+	"strings"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// rangeFrame evaluates the bounds of a range, then its step, if it has one.
+type rangeFrame struct {
+	e      *Evaluator
+	node   *ast.RangeExpression
+	bounds []object.Object
+}
+
+func (f *rangeFrame) step(m *machine, result object.Object) {
+	if result != nil {
+		f.bounds = append(f.bounds, result)
+	}
+	switch len(f.bounds) {
+	case 0:
+		m.push(f.e, f.node.Start, plain)
+		return
+	case 1:
+		m.push(f.e, f.node.End, plain)
+		return
+	case 2:
+		if err := checkRangeBounds(f.bounds[0], f.bounds[1]); err != nil {
+			m.ret(err)
+			return
+		}
+		if f.node.Step != nil {
+			m.push(f.e, f.node.Step, plain)
+			return
+		}
+		f.bounds = append(f.bounds, nil)
+	}
+	m.ret(NewRange(f.bounds[0], f.bounds[1], f.bounds[2], f.node.Exclusive))
+}
+
+func checkRangeBounds(start, end object.Object) *object.Error {
+	for _, bound := range []object.Object{start, end} {
+		if bound.Type() != object.INTEGER_OBJ {
+			return newError("range bound must be INTEGER, got %s", bound.Type())
+		}
+	}
+	return nil
+}
+
+// NewRange returns the range from start to end, step apart. A nil step is 1.
+// Ranges with more integers than an int64 can count are rejected.
+func NewRange(start, end, step object.Object, exclusive bool) object.Object {
+	if err := checkRangeBounds(start, end); err != nil {
+		return err
+	}
+
+	stepValue := int64(1)
+	if step != nil {
+		stepInt, ok := step.(*object.Integer)
+		if !ok {
+			return newError("range step must be INTEGER, got %s", step.Type())
+		}
+		if stepInt.Value == 0 {
+			return newError("range step cannot be zero")
+		}
+		stepValue = stepInt.Value
+	}
+
+	r := &object.Range{
+		Start:     start.(*object.Integer).Value,
+		End:       end.(*object.Integer).Value,
+		Step:      stepValue,
+		Exclusive: exclusive,
+	}
+	if r.TooLong() {
+		return newError("range too long: %s", r.Inspect())
+	}
+	return r
+}
+
+// evalRangeIndex indexes a range like an array, without materializing it.
+func evalRangeIndex(rng, index object.Object) object.Object {
+	r := rng.(*object.Range)
+	idx := index.(*object.Integer).Value
+	length := r.Len()
+
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 || idx >= length {
+		return NULL
+	}
+	return &object.Integer{Value: r.At(idx)}
+}
+
+func rangeIterator(r *object.Range) *object.Iterator {
+	idx, length := int64(0), r.Len()
+	return &object.Iterator{Name: "iterator", Next: func() (object.Object, bool) {
+		if idx >= length {
+			return nil, false
+		}
+		idx++
+		return &object.Integer{Value: r.At(idx - 1)}, true
+	}}
+}
+
+func rangesEqual(left, right *object.Range) bool {
+	length := left.Len()
+	switch {
+	case length != right.Len():
+		return false
+	case length == 0:
+		return true
+	case length == 1:
+		return left.Start == right.Start
+	default:
+		return left.Start == right.Start && left.Step == right.Step
+	}
+}
+
+// evalInExpression reports whether needle is an element of a range or array,
+// a substring of a string or a key of a hash.
+func evalInExpression(needle, haystack object.Object) object.Object {
+	switch haystack := haystack.(type) {
+	case *object.Range:
+		n, ok := needle.(*object.Integer)
+		return nativeBoolToBooleanObject(ok && haystack.Contains(n.Value))
+	case *object.Array:
+		for _, elem := range haystack.Snapshot() {
+			if objectsEqual(needle, elem) {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *object.String:
+		sub, ok := needle.(*object.String)
+		if !ok {
+			return newError("type mismatch: %s in %s", needle.Type(), haystack.Type())
+		}
+		return nativeBoolToBooleanObject(strings.Contains(haystack.Value, sub.Value))
+	case *object.Hash:
+		key, ok := object.HashKeyOf(needle)
+		if !ok {
+			return hashKeyError(needle)
+		}
+		_, ok = haystack.Get(key)
+		return nativeBoolToBooleanObject(ok)
+	default:
+		return infixOperatorError(needle, haystack, "in")
+	}
+}
+
+// rangeSlice returns the sub-range between two indexes, which may be negative
+// and are clamped to the range like Python slices.
+func rangeSlice(c Caller, receiver object.Object, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return wrongArgCountError(2, len(args))
+	}
+	r := receiver.(*object.Range)
+	length := r.Len()
+
+	bounds := [2]int64{}
+	for idx, arg := range args {
+		bound, ok := arg.(*object.Integer)
+		if !ok {
+			return newError("argument to `slice` must be INTEGER, got %s", arg.Type())
+		}
+		bounds[idx] = bound.Value
+		if bounds[idx] < 0 {
+			bounds[idx] += length
+		}
+		if bounds[idx] < 0 {
+			bounds[idx] = 0
+		} else if bounds[idx] > length {
+			bounds[idx] = length
+		}
+	}
+	lo, hi := bounds[0], bounds[1]
+	if hi < lo {
+		hi = lo
+	}
+	return r.Slice(lo, hi)
+}
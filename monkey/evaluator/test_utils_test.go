@@ -7,11 +7,21 @@ import (
 	"github.com/jamestrew/go-interpreter/monkey/parser"
 )
 
-func testEval(input string) object.Object {
+func testEval(input string, opts ...Option) object.Object {
+	program, _ := parser.ParseInput(input)
+	return newTestEngine(opts...).Eval(program)
+}
+
+// testEvalMacros evaluates input after defining and expanding its macros.
+func testEvalMacros(input string, opts ...Option) object.Object {
 	program, _ := parser.ParseInput(input)
 	env := object.NewEnvironment()
-	eval := New(env)
-	return eval.Eval(program)
+	DefineMacros(program, env)
+	expanded, err := ExpandMacros(program, env, opts...)
+	if err != nil {
+		return err
+	}
+	return newTestEngine(opts...).Eval(expanded)
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, input string, expected int64) bool {
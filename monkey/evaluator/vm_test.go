@@ -0,0 +1,16 @@
+package evaluator_test
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/evaluator"
+	"github.com/jamestrew/go-interpreter/monkey/vm"
+)
+
+func init() {
+	evaluator.RegisterEngine("vm", func(legacyBlockScope bool, maxDepth int) evaluator.Engine {
+		opts := []vm.Option{vm.WithMaxDepth(maxDepth)}
+		if legacyBlockScope {
+			opts = append(opts, vm.WithLegacyBlockScope())
+		}
+		return vm.NewEngine(opts...)
+	})
+}
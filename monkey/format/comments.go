@@ -0,0 +1,196 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/lexer"
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+// Comments aren't part of the AST, so they're placed by position. Each comment
+// belongs to the innermost list of items it's in: the statements of the
+// program or a block, or the methods of a class. Within a list, a comment on
+// the last line of an item trails it, and any other comment goes before the
+// next item, or at the end of the list if there isn't one. Comments inside an
+// item but outside any nested list, like those between the elements of an
+// array literal, are moved before the item.
+
+// itemInfo is where an item is in the source, and the comments that go with
+// it.
+type itemInfo struct {
+	start, end int // lines of the first and last tokens
+	leading    []token.Token
+	trailing   *token.Token
+}
+
+type position struct {
+	line, column int
+}
+
+func positionOf(tok token.Token) position {
+	return position{tok.Line, tok.Column}
+}
+
+func (a position) before(b position) bool {
+	return a.line < b.line || a.line == b.line && a.column < b.column
+}
+
+// commentList is a list of items that comments can be placed in, between the
+// tokens at open and close.
+type commentList struct {
+	owner       ast.Node
+	items       []ast.Node
+	open, close int
+}
+
+// layout places comments among the items of program.
+func (p *printer) layout(src string, program *ast.Program, comments []token.Token) {
+	tokens := []token.Token{}
+	l := lexer.New(src)
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	index := map[position]int{}
+	for idx, tok := range tokens {
+		index[positionOf(tok)] = idx
+	}
+
+	items := []ast.Node{}
+	for _, stmt := range program.Statements {
+		items = append(items, stmt)
+	}
+	lists := []commentList{{owner: program, items: items, open: -1, close: len(tokens) - 1}}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.BlockStatement:
+			open := index[positionOf(node.Token)]
+			items := []ast.Node{}
+			for _, stmt := range node.Statements {
+				items = append(items, stmt)
+			}
+			lists = append(lists, commentList{node, items, open, matchingBrace(tokens, open)})
+		case *ast.ClassStatement:
+			open := index[positionOf(node.Token)]
+			for tokens[open].Type != token.LBRACE {
+				open++
+			}
+			items := []ast.Node{}
+			for _, method := range node.Methods {
+				items = append(items, method)
+			}
+			lists = append(lists, commentList{node, items, open, matchingBrace(tokens, open)})
+		}
+		return true
+	})
+
+	starts := map[ast.Node]int{}
+	for _, list := range lists {
+		for idx, item := range list.items {
+			start := index[positionOf(startToken(item))]
+			next := list.close
+			if idx+1 < len(list.items) {
+				next = index[positionOf(startToken(list.items[idx+1]))]
+			}
+			end := next - 1
+			if tokens[end].Type == token.SEMICOLON && end > start {
+				end--
+			}
+
+			starts[item] = start
+			p.items[item] = &itemInfo{start: tokens[start].Line, end: endLine(tokens[end])}
+		}
+	}
+
+	for _, comment := range comments {
+		pos := positionOf(comment)
+
+		// lists are nested, so the innermost one containing the comment is the
+		// one that opens last
+		var list commentList
+		for _, l := range lists {
+			inside := l.open < 0 || positionOf(tokens[l.open]).before(pos) && pos.before(positionOf(tokens[l.close]))
+			if inside && (list.owner == nil || l.open > list.open) {
+				list = l
+			}
+		}
+
+		idx := -1
+		for i, item := range list.items {
+			if positionOf(tokens[starts[item]]).before(pos) {
+				idx = i
+			}
+		}
+
+		switch {
+		case len(list.items) == 0:
+			p.dangling[list.owner] = append(p.dangling[list.owner], comment)
+		case idx < 0:
+			first := p.items[list.items[0]]
+			first.leading = append(first.leading, comment)
+		default:
+			info := p.items[list.items[idx]]
+			switch {
+			case comment.Line == info.end && info.trailing == nil:
+				c := comment
+				info.trailing = &c
+			case comment.Line <= info.end:
+				info.leading = append(info.leading, comment)
+			case idx+1 < len(list.items):
+				next := p.items[list.items[idx+1]]
+				next.leading = append(next.leading, comment)
+			default:
+				p.dangling[list.owner] = append(p.dangling[list.owner], comment)
+			}
+		}
+	}
+}
+
+// matchingBrace returns the index of the brace that closes the one at open.
+func matchingBrace(tokens []token.Token, open int) int {
+	depth := 0
+	for idx := open; idx < len(tokens); idx++ {
+		switch tokens[idx].Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return idx
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+func endLine(tok token.Token) int {
+	return tok.Line + strings.Count(tok.Literal, "\n")
+}
+
+func startToken(node ast.Node) token.Token {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token
+	case *ast.ReturnStatement:
+		return node.Token
+	case *ast.ExpressionStatement:
+		return node.Token
+	case *ast.StructStatement:
+		return node.Token
+	case *ast.ClassStatement:
+		return node.Token
+	case *ast.EnumStatement:
+		return node.Token
+	case *ast.SelectStatement:
+		return node.Token
+	case *ast.FunctionLiteral:
+		return node.Token
+	default:
+		return token.Token{}
+	}
+}
@@ -0,0 +1,534 @@
+// Package format prints Monkey programs in a canonical style: four space
+// indentation, one statement per line, calls and literals broken over several
+// lines when they're too long, and only the parentheses the parser needs.
+// Comments are kept, although those inside an expression are moved before its
+// statement.
+package format
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/parser"
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+const (
+	indentWidth = 4
+	maxWidth    = 80
+)
+
+// highest is the precedence of expressions that never need parentheses, like
+// literals and calls.
+const highest = parser.MEMBER + 1
+
+// Source formats the Monkey program src, returning an error if it doesn't
+// parse.
+func Source(src []byte) ([]byte, error) {
+	program, p := parser.ParseInput(string(src))
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := &printer{
+		items:    map[ast.Node]*itemInfo{},
+		dangling: map[ast.Node][]token.Token{},
+		memo:     map[memoKey]string{},
+	}
+	pr.layout(string(src), program, p.Comments())
+	return []byte(pr.program(program)), nil
+}
+
+type printer struct {
+	items    map[ast.Node]*itemInfo
+	dangling map[ast.Node][]token.Token // comments after the last item of a list
+	memo     map[memoKey]string
+}
+
+// memoKey identifies a rendering of an expression, which only depends on where
+// it starts. Lists render their elements both ways when deciding whether to
+// break them, so this keeps nested lists from taking exponential time.
+type memoKey struct {
+	exp         ast.Expression
+	indent, col int
+}
+
+func pad(indent int) string {
+	return strings.Repeat(" ", indent*indentWidth)
+}
+
+// advance returns the column after s, if s starts at col.
+func advance(col int, s string) int {
+	if idx := strings.LastIndexByte(s, '\n'); idx >= 0 {
+		return len(s) - idx - 1
+	}
+	return col + len(s)
+}
+
+func firstLine(s string) string {
+	if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+		return s[:idx]
+	}
+	return s
+}
+
+func (p *printer) program(program *ast.Program) string {
+	out := p.statements(program, program.Statements, 0, false)
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+// statements renders a list of statements, with the comments that go with
+// them. The last statement of a block doesn't need a semicolon.
+func (p *printer) statements(owner ast.Node, stmts []ast.Statement, indent int, inBlock bool) string {
+	texts := make([]string, len(stmts))
+	for idx, stmt := range stmts {
+		texts[idx] = p.statement(stmt, indent)
+	}
+
+	items := make([]ast.Node, len(stmts))
+	for idx, stmt := range stmts {
+		items[idx] = stmt
+		next := ""
+		last := idx+1 == len(stmts)
+		if !last {
+			next = texts[idx+1]
+		}
+		if needsSemicolon(stmt, next, last && inBlock) {
+			texts[idx] += ";"
+		}
+	}
+	return p.list(owner, items, texts, indent)
+}
+
+// needsSemicolon reports whether stmt needs a semicolon before the statement
+// rendered as next, which is empty if there isn't one. Expression statements
+// don't need one at the end of a block, and those ending with a block only need
+// one if the next statement would otherwise continue them, as in
+// `if (x) { f }; (g)()`.
+func needsSemicolon(stmt ast.Statement, next string, endOfBlock bool) bool {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement, *ast.ReturnStatement:
+		return true
+	case *ast.ExpressionStatement:
+		if endOfBlock {
+			return false
+		}
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.FunctionLiteral:
+			return next != "" && strings.ContainsAny(next[:1], "([-")
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// list joins the rendered items of owner, one per line, with their comments.
+// Single blank lines between items in the source are kept.
+func (p *printer) list(owner ast.Node, items []ast.Node, texts []string, indent int) string {
+	var out strings.Builder
+	prevEnd := -1
+	startLine := func(line int) {
+		if prevEnd >= 0 {
+			out.WriteString("\n")
+			if line-prevEnd > 1 {
+				out.WriteString("\n")
+			}
+		}
+		out.WriteString(pad(indent))
+	}
+
+	for idx, item := range items {
+		info, ok := p.items[item]
+		if !ok {
+			info = &itemInfo{}
+		}
+		for _, comment := range info.leading {
+			line := comment.Line
+			if line > info.start {
+				// moved from inside the item
+				line = info.start
+			}
+			startLine(line)
+			out.WriteString(comment.Literal)
+			prevEnd = line
+		}
+
+		startLine(info.start)
+		out.WriteString(texts[idx])
+		if info.trailing != nil {
+			out.WriteString(" " + info.trailing.Literal)
+		}
+		prevEnd = info.end
+	}
+
+	for _, comment := range p.dangling[owner] {
+		startLine(comment.Line)
+		out.WriteString(comment.Literal)
+		prevEnd = comment.Line
+	}
+	return out.String()
+}
+
+func (p *printer) block(block *ast.BlockStatement, indent int) string {
+	body := p.statements(block, block.Statements, indent+1, true)
+	if body == "" {
+		return "{}"
+	}
+	return "{\n" + body + "\n" + pad(indent) + "}"
+}
+
+func (p *printer) statement(stmt ast.Statement, indent int) string {
+	col := indent * indentWidth
+
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		lhs := "let "
+		if stmt.Name != nil {
+			lhs += p.identifier(stmt.Name)
+		} else {
+			lhs += p.expr(stmt.Pattern, indent, col+len(lhs))
+		}
+		lhs += " = "
+		return lhs + p.expr(stmt.Value, indent, advance(col, lhs))
+	case *ast.ReturnStatement:
+		if stmt.Value == nil {
+			return "return"
+		}
+		return "return " + p.expr(stmt.Value, indent, col+len("return "))
+	case *ast.ExpressionStatement:
+		return p.expr(stmt.Expression, indent, col)
+	case *ast.StructStatement:
+		head := "struct " + stmt.Name.Value + " "
+		return head + p.fields(len(stmt.Fields), func(idx int) string {
+			field := stmt.Fields[idx]
+			if field.Default == nil {
+				return field.Name.Value
+			}
+			return field.Name.Value + " = " + p.expr(field.Default, indent+1, 0)
+		}, indent, col+len(head))
+	case *ast.EnumStatement:
+		head := "enum " + stmt.Name.Value + " "
+		return head + p.fields(len(stmt.Variants), func(idx int) string {
+			variant := stmt.Variants[idx]
+			if variant.Fields == nil {
+				return variant.Name.Value
+			}
+			return variant.Name.Value + p.parameters(variant.Fields)
+		}, indent, col+len(head))
+	case *ast.ClassStatement:
+		return p.class(stmt, indent)
+	case *ast.SelectStatement:
+		return p.selectStatement(stmt, indent)
+	default:
+		return stmt.String()
+	}
+}
+
+// fields renders the fields of a struct or the variants of an enum, on one
+// line if they fit.
+func (p *printer) fields(n int, render func(idx int) string, indent, col int) string {
+	if n == 0 {
+		return "{}"
+	}
+
+	texts := make([]string, n)
+	for idx := range texts {
+		texts[idx] = render(idx)
+	}
+
+	flat := "{ " + strings.Join(texts, ", ") + " }"
+	if col+len(flat) <= maxWidth && !strings.Contains(flat, "\n") {
+		return flat
+	}
+	return "{\n" + pad(indent+1) + strings.Join(texts, ",\n"+pad(indent+1)) + ",\n" + pad(indent) + "}"
+}
+
+func (p *printer) class(stmt *ast.ClassStatement, indent int) string {
+	head := "class " + stmt.Name.Value
+	if stmt.SuperClass != nil {
+		head += " extends " + stmt.SuperClass.Value
+	}
+
+	items := make([]ast.Node, len(stmt.Methods))
+	texts := make([]string, len(stmt.Methods))
+	for idx, method := range stmt.Methods {
+		items[idx] = method
+		texts[idx] = p.signature(method.Name.Value, method) + " " + p.block(method.Body, indent+1)
+	}
+
+	body := p.list(stmt, items, texts, indent+1)
+	if body == "" {
+		return head + " {}"
+	}
+	return head + " {\n" + body + "\n" + pad(indent) + "}"
+}
+
+func (p *printer) selectStatement(stmt *ast.SelectStatement, indent int) string {
+	var out strings.Builder
+	out.WriteString("select {\n")
+
+	for _, sc := range stmt.Cases {
+		head := "case "
+		if sc.Name != nil {
+			head += "let " + sc.Name.Value + " = "
+		}
+		col := (indent+1)*indentWidth + len(head)
+		head += p.expr(sc.Operation, indent+1, col)
+
+		out.WriteString(pad(indent+1) + head + " " + p.block(sc.Body, indent+1) + "\n")
+	}
+	if stmt.Default != nil {
+		out.WriteString(pad(indent+1) + "default " + p.block(stmt.Default, indent+1) + "\n")
+	}
+
+	out.WriteString(pad(indent) + "}")
+	return out.String()
+}
+
+// signature renders the part of a function before its body, after the `fn`
+// for function literals.
+func (p *printer) signature(name string, fn *ast.FunctionLiteral) string {
+	out := name + p.parameters(fn.Parameters)
+	if fn.ReturnType != nil {
+		out += " -> " + fn.ReturnType.String()
+	}
+	return out
+}
+
+func (p *printer) parameters(params []*ast.Identifier) string {
+	texts := make([]string, len(params))
+	for idx, param := range params {
+		texts[idx] = p.identifier(param)
+	}
+	return "(" + strings.Join(texts, ", ") + ")"
+}
+
+func (p *printer) identifier(ident *ast.Identifier) string {
+	if ident.Type != nil {
+		return ident.Value + ": " + ident.Type.String()
+	}
+	return ident.Value
+}
+
+// precedence returns how tightly exp binds, from the precedences the parser
+// uses. exp needs parentheses where an operand of a higher precedence is
+// expected.
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression, *ast.SpawnExpression:
+		return parser.PREFIX
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.RangeExpression:
+		return parser.RANGE
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.YieldExpression:
+		// yield takes everything after it as its value
+		return parser.LOWEST
+	default:
+		return highest
+	}
+}
+
+// operand renders exp, in parentheses if it binds less tightly than min.
+func (p *printer) operand(exp ast.Expression, min, indent, col int) string {
+	if precedence(exp) < min {
+		return "(" + p.expr(exp, indent, col+1) + ")"
+	}
+	return p.expr(exp, indent, col)
+}
+
+// expr renders exp starting at col, with any lines after the first indented
+// by indent.
+func (p *printer) expr(exp ast.Expression, indent, col int) string {
+	key := memoKey{exp, indent, col}
+	if out, ok := p.memo[key]; ok {
+		return out
+	}
+	out := p.render(exp, indent, col)
+	p.memo[key] = out
+	return out
+}
+
+func (p *printer) render(exp ast.Expression, indent, col int) string {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return p.identifier(exp)
+	case *ast.IntegerLiteral:
+		if exp.Token.Literal != "" {
+			return exp.Token.Literal
+		}
+		return strconv.FormatInt(exp.Value, 10)
+	case *ast.StringLiteral:
+		return `"` + exp.Value + `"`
+	case *ast.Boolean:
+		return strconv.FormatBool(exp.Value)
+	case *ast.PrefixExpression:
+		return exp.Operator + p.operand(exp.Right, parser.PREFIX, indent, col+len(exp.Operator))
+	case *ast.InfixExpression:
+		prec := precedence(exp)
+		left := p.operand(exp.Left, prec, indent, col)
+		op := " " + exp.Operator + " "
+		// operators are left associative, so the right operand needs
+		// parentheses at the same precedence
+		right := p.operand(exp.Right, prec+1, indent, advance(col, left)+len(op))
+		return left + op + right
+	case *ast.AssignExpression:
+		target := p.operand(exp.Target, highest, indent, col)
+		return target + " = " + p.expr(exp.Value, indent, advance(col, target)+3)
+	case *ast.RangeExpression:
+		out := p.operand(exp.Start, parser.RANGE, indent, col)
+		out += exp.Token.Literal
+		out += p.operand(exp.End, parser.RANGE+1, indent, advance(col, out))
+		if exp.Step != nil {
+			out += " step "
+			out += p.operand(exp.Step, parser.RANGE+1, indent, advance(col, out))
+		}
+		return out
+	case *ast.MemberExpression:
+		out := p.operand(exp.Object, highest, indent, col)
+		if exp.Optional {
+			return out + "?." + exp.Property.Value
+		}
+		return out + "." + exp.Property.Value
+	case *ast.IndexExpression:
+		out := p.operand(exp.Left, highest, indent, col)
+		if exp.Optional {
+			out += "?."
+		}
+		out += "["
+		return out + p.expr(exp.Index, indent, advance(col, out)) + "]"
+	case *ast.CallExpression:
+		out := p.operand(exp.Function, highest, indent, col)
+		if exp.Optional {
+			out += "?."
+		}
+		return out + p.elements("(", ")", exp.Arguments, indent, advance(col, out))
+	case *ast.ArrayLiteral:
+		return p.elements("[", "]", exp.Elements, indent, col)
+	case *ast.HashLiteral:
+		return p.pairs(exp.Pairs, indent, col)
+	case *ast.ArrayComprehension:
+		out := "[" + p.expr(exp.Element, indent, col+1)
+		out += p.clauses(exp.Clauses, indent, advance(col, out))
+		return out + "]"
+	case *ast.HashComprehension:
+		out := "{" + p.expr(exp.Key, indent, col+1) + ": "
+		out += p.expr(exp.Value, indent, advance(col, out))
+		out += p.clauses(exp.Clauses, indent, advance(col, out))
+		return out + "}"
+	case *ast.IfExpression:
+		out := "if (" + p.expr(exp.Condition, indent, col+4) + ") "
+		out += p.block(exp.Consequence, indent)
+		if exp.Alternative != nil {
+			out += " else " + p.block(exp.Alternative, indent)
+		}
+		return out
+	case *ast.FunctionLiteral:
+		out := "fn"
+		if exp.IsGenerator {
+			out += "*"
+		}
+		name := ""
+		if exp.Name != nil {
+			name = " " + exp.Name.Value
+		}
+		return out + p.signature(name, exp) + " " + p.block(exp.Body, indent)
+	case *ast.MacroLiteral:
+		return "macro" + p.parameters(exp.Parameters) + " " + p.block(exp.Body, indent)
+	case *ast.YieldExpression:
+		if exp.Value == nil {
+			return "yield"
+		}
+		return "yield " + p.expr(exp.Value, indent, col+len("yield "))
+	case *ast.SpawnExpression:
+		return "spawn " + p.operand(exp.Call, parser.PREFIX, indent, col+len("spawn "))
+	case *ast.SpreadElement:
+		return "..." + p.expr(exp.Value, indent, col+3)
+	default:
+		return exp.String()
+	}
+}
+
+func (p *printer) clauses(clauses []*ast.ComprehensionClause, indent, col int) string {
+	var out strings.Builder
+	for _, clause := range clauses {
+		out.WriteString(" for ")
+		out.WriteString(p.expr(clause.Pattern, indent, advance(col, out.String())))
+		out.WriteString(" in ")
+		out.WriteString(p.expr(clause.Iterable, indent, advance(col, out.String())))
+		if clause.Condition != nil {
+			out.WriteString(" if ")
+			out.WriteString(p.expr(clause.Condition, indent, advance(col, out.String())))
+		}
+	}
+	return out.String()
+}
+
+func (p *printer) elements(open, close string, elements []ast.Expression, indent, col int) string {
+	return p.breakable(open, close, len(elements), func(idx, indent, col int) string {
+		return p.expr(elements[idx], indent, col)
+	}, indent, col)
+}
+
+func (p *printer) pairs(pairs []ast.HashPair, indent, col int) string {
+	return p.breakable("{", "}", len(pairs), func(idx, indent, col int) string {
+		pair := pairs[idx]
+		key := p.expr(pair.Key, indent, col)
+		if pair.Value == nil {
+			return key
+		}
+		key += ": "
+		return key + p.expr(pair.Value, indent, advance(col, key))
+	}, indent, col)
+}
+
+// breakable renders n items between open and close on one line if they fit,
+// or one per line if they don't. On one line, only the last item can span
+// several lines, like a function literal passed as the last argument.
+func (p *printer) breakable(
+	open, close string,
+	n int,
+	render func(idx, indent, col int) string,
+	indent, col int,
+) string {
+	if n == 0 {
+		return open + close
+	}
+
+	var flat strings.Builder
+	flat.WriteString(open)
+	fits := true
+	for idx := 0; idx < n && fits; idx++ {
+		if idx > 0 {
+			flat.WriteString(", ")
+		}
+		item := render(idx, indent, advance(col, flat.String()))
+		fits = idx == n-1 || !strings.Contains(item, "\n")
+		flat.WriteString(item)
+	}
+	flat.WriteString(close)
+	if fits && col+len(firstLine(flat.String())) <= maxWidth {
+		return flat.String()
+	}
+
+	var out strings.Builder
+	out.WriteString(open + "\n")
+	for idx := 0; idx < n; idx++ {
+		out.WriteString(pad(indent + 1))
+		out.WriteString(render(idx, indent+1, (indent+1)*indentWidth))
+		if idx < n-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString(pad(indent) + close)
+	return out.String()
+}
@@ -0,0 +1,207 @@
+package format
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/internal/corpus"
+	"github.com/jamestrew/go-interpreter/monkey/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let   x=1", "let x = 1;\n"},
+		{"x", "x;\n"},
+		{"let x = (1 + 2) * 3; let y = 1 + (2 * 3);", "let x = (1 + 2) * 3;\nlet y = 1 + 2 * 3;\n"},
+		{"a - (b - c); (a - b) - c;", "a - (b - c);\na - b - c;\n"},
+		{"-(-x); (-x).y; !(a == b);", "--x;\n(-x).y;\n!(a == b);\n"},
+		{"a.x = (b.y = c); (1..5); (1..(2..3));", "a.x = b.y = c;\n1..5;\n1..(2..3);\n"},
+		{"(a ?? b) ?? c; a ?? (b ?? c);", "a ?? b ?? c;\na ?? (b ?? c);\n"},
+		{"(f)(x); (fn(x) { x })(1);", "f(x);\nfn(x) {\n    x\n}(1);\n"},
+		{"xs?.[0]; f?.(1); a?.b;", "xs?.[0];\nf?.(1);\na?.b;\n"},
+		{"let f = fn*(x: int) -> int { yield x + 1; };", "let f = fn*(x: int) -> int {\n    yield x + 1\n};\n"},
+		{"fn add(a, b) { return a + b }", "fn add(a, b) {\n    return a + b;\n}\n"},
+		{"if (x) { 1 } else { 2 }", "if (x) {\n    1\n} else {\n    2\n}\n"},
+		{"if (x) {}; (f)(1)", "if (x) {}\nf(1);\n"},
+		{"if (x) {}; (a + b)(c)", "if (x) {};\n(a + b)(c);\n"},
+		{"if (x) {}; -1", "if (x) {};\n-1;\n"},
+		{"if (x) {}; f(1)", "if (x) {}\nf(1);\n"},
+		{`{"a": 1, "b": [1, 2]}`, "{\"a\": 1, \"b\": [1, 2]};\n"},
+		{"[x * 2 for x in xs if x > 1]", "[x * 2 for x in xs if x > 1];\n"},
+		{"struct Point { x, y = 0 }", "struct Point { x, y = 0 }\n"},
+		{"enum Shape { Circle(r), Square(side), }", "enum Shape { Circle(r), Square(side) }\n"},
+		{
+			"class A extends B { init(x) { this.x = x; } get() { this.x } }",
+			"class A extends B {\n    init(x) {\n        this.x = x\n    }\n    get() {\n        this.x\n    }\n}\n",
+		},
+		{"class A {}", "class A {}\n"},
+		{
+			"select { case let v = recv(ch) { v } default { 0 } }",
+			"select {\n    case let v = recv(ch) {\n        v\n    }\n    default {\n        0\n    }\n}\n",
+		},
+		{
+			"let xs = [aaaaaaaaaaaaaaaaaaaa, bbbbbbbbbbbbbbbbbbbb, cccccccccccccccccccc, dddddddddd];",
+			"let xs = [\n    aaaaaaaaaaaaaaaaaaaa,\n    bbbbbbbbbbbbbbbbbbbb,\n    cccccccccccccccccccc,\n    dddddddddd\n];\n",
+		},
+		{
+			"map(xs, fn(x) { x * 2 })",
+			"map(xs, fn(x) {\n    x * 2\n});\n",
+		},
+		{
+			"struct Options { verbose = false, output = \"out.txt\", retries = 3, timeout = 1000 }",
+			"struct Options {\n    verbose = false,\n    output = \"out.txt\",\n    retries = 3,\n    timeout = 1000,\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		out, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source failed for `%s`: %s", tt.input, err)
+			continue
+		}
+		if string(out) != tt.expected {
+			t.Errorf("wrong output for `%s`.\nexpected=%q\ngot=     %q", tt.input, tt.expected, out)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// only a comment", "// only a comment\n"},
+		{"let x = 1;   // one  \n", "let x = 1; // one\n"},
+		{
+			"// header\n\n\n\nlet x = 1;\n// about y\nlet y = 2;\n\n// end",
+			"// header\n\nlet x = 1;\n// about y\nlet y = 2;\n\n// end\n",
+		},
+		{
+			"let f = fn(x) { // opening\n  // first\n  x\n  // last\n};",
+			"let f = fn(x) {\n    // opening\n    // first\n    x\n    // last\n};\n",
+		},
+		{"if (x) {\n// nothing\n}", "if (x) {\n    // nothing\n}\n"},
+		{
+			"let xs = [\n  1, // one\n  2\n];\nxs",
+			"// one\nlet xs = [1, 2];\nxs;\n",
+		},
+		{
+			"class A {\n  // the getter\n  get() { 1 } // one\n\n  // done\n}",
+			"class A {\n    // the getter\n    get() {\n        1\n    } // one\n\n    // done\n}\n",
+		},
+		{"let s = \"a\nb\"; // after", "let s = \"a\nb\"; // after\n"},
+	}
+
+	for _, tt := range tests {
+		out, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source failed for `%s`: %s", tt.input, err)
+			continue
+		}
+		if string(out) != tt.expected {
+			t.Errorf("wrong output for `%s`.\nexpected=%q\ngot=     %q", tt.input, tt.expected, out)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("let = 1;"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if !strings.Contains(err.Error(), "no prefix parse function for = found") {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+}
+
+// testInputs returns the string literals in the parser and evaluator tests that
+// parse without errors.
+func testInputs(t *testing.T) []string {
+	return corpus.Inputs(t, func(input string) bool {
+		program, p := parser.ParseInput(input)
+		return len(p.Errors()) == 0 && len(program.Statements) > 0
+	}, "../parser/parser_test.go", "../evaluator/evaluator_test.go")
+}
+
+func TestSourcePreservesPrograms(t *testing.T) {
+	inputs := testInputs(t)
+	if len(inputs) < 200 {
+		t.Fatalf("expected at least 200 inputs. got=%d", len(inputs))
+	}
+
+	for _, input := range inputs {
+		out, err := Source([]byte(input))
+		if err != nil {
+			t.Errorf("Source failed for `%s`: %s", input, err)
+			continue
+		}
+
+		program, _ := parser.ParseInput(input)
+		formatted, p := parser.ParseInput(string(out))
+		if len(p.Errors()) != 0 {
+			t.Errorf("formatted `%s` doesn't parse: %v\n%s", input, p.Errors(), out)
+			continue
+		}
+		if formatted.String() != program.String() {
+			t.Errorf("formatting changed `%s`.\nexpected=%q\ngot=     %q", input, program.String(), formatted.String())
+		}
+
+		again, err := Source(out)
+		if err != nil || string(again) != string(out) {
+			t.Errorf("formatting `%s` isn't idempotent.\nfirst= %q\nsecond=%q", input, out, again)
+		}
+	}
+}
+
+func TestSourcePreservesComments(t *testing.T) {
+	inputs := testInputs(t)
+
+	for _, input := range inputs {
+		// put a comment after every line
+		lines := strings.Split(input, "\n")
+		for idx := range lines {
+			lines[idx] += " // c" + strconv.Itoa(idx)
+		}
+		commented := strings.Join(lines, "\n")
+		if _, p := parser.ParseInput(commented); len(p.Errors()) != 0 {
+			// the comment swallowed part of a multi-line string
+			continue
+		}
+
+		out, err := Source([]byte(commented))
+		if err != nil {
+			t.Errorf("Source failed for `%s`: %s", commented, err)
+			continue
+		}
+
+		_, p := parser.ParseInput(string(out))
+		if len(p.Errors()) != 0 {
+			t.Errorf("formatted `%s` doesn't parse: %v\n%s", commented, p.Errors(), out)
+			continue
+		}
+		comments := p.Comments()
+		if len(comments) != len(lines) {
+			t.Errorf("wrong number of comments for `%s`. expected=%d, got=%d\n%s",
+				commented, len(lines), len(comments), out)
+			continue
+		}
+		for idx, comment := range comments {
+			expected := "// c" + strconv.Itoa(idx)
+			if comment.Literal != expected {
+				t.Errorf("comments of `%s` out of order. expected=%q, got=%q\n%s",
+					commented, expected, comment.Literal, out)
+				break
+			}
+		}
+
+		again, err := Source(out)
+		if err != nil || string(again) != string(out) {
+			t.Errorf("formatting `%s` isn't idempotent.\nfirst= %q\nsecond=%q", commented, out, again)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package corpus collects Monkey programs from the string literals of Go test
+// files, for tests that check a property of every program the other tests use.
+package corpus
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"strconv"
+	"testing"
+)
+
+// Inputs returns the string literals in the Go files at paths that parses
+// accepts. The parser is passed in rather than imported, so its own tests can
+// use Inputs too.
+func Inputs(t testing.TB, parses func(input string) bool, paths ...string) []string {
+	t.Helper()
+
+	inputs := []string{}
+	for _, path := range paths {
+		fset := gotoken.NewFileSet()
+		file, err := goparser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", path, err)
+		}
+
+		goast.Inspect(file, func(node goast.Node) bool {
+			lit, ok := node.(*goast.BasicLit)
+			if !ok || lit.Kind != gotoken.STRING {
+				return true
+			}
+			input, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return true
+			}
+			if parses(input) {
+				inputs = append(inputs, input)
+			}
+			return true
+		})
+	}
+	return inputs
+}
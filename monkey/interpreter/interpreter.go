@@ -1,12 +1,14 @@
 package interpreter
 
 import (
-	"bufio"
 	"io"
 
+	"github.com/jamestrew/go-interpreter/monkey/ast"
 	"github.com/jamestrew/go-interpreter/monkey/evaluator"
 	"github.com/jamestrew/go-interpreter/monkey/object"
+	"github.com/jamestrew/go-interpreter/monkey/optimize"
 	"github.com/jamestrew/go-interpreter/monkey/parser"
+	"github.com/jamestrew/go-interpreter/monkey/resolve"
 )
 
 func PrintParseErrors(out io.Writer, errors []string) {
@@ -17,21 +19,40 @@ func PrintParseErrors(out io.Writer, errors []string) {
 	}
 }
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	eval := evaluator.New(object.NewEnvironment())
+// Engine runs programs, such as an *evaluator.Evaluator or a *vm.Engine.
+type Engine interface {
+	Eval(node ast.Node) object.Object
+}
 
-	for {
-		if !scanner.Scan() {
-			return
-		}
-		line := scanner.Text()
-		program, p := parser.ParseInput(line)
-		if len(p.Errors()) != 0 {
-			PrintParseErrors(out, p.Errors())
-			return
-		}
+// Start runs the source read from in as one program, unless it doesn't parse
+// or its macros don't expand. It returns the program it ran, macro expanded,
+// optimized and resolved, and whether it ran at all. Macros are expanded with
+// macroOpts.
+func Start(in io.Reader, out io.Writer, eval Engine, macroOpts ...evaluator.Option) (*ast.Program, bool) {
+	src, err := io.ReadAll(in)
+	if err != nil {
+		io.WriteString(out, err.Error())
+		io.WriteString(out, "\n")
+		return nil, false
+	}
+	program, p := parser.ParseInput(string(src))
+	if len(p.Errors()) != 0 {
+		PrintParseErrors(out, p.Errors())
+		return nil, false
+	}
 
-		eval.Eval(program)
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, expandErr := evaluator.ExpandMacros(program, macroEnv, macroOpts...)
+	if expandErr != nil {
+		io.WriteString(out, expandErr.Inspect())
+		io.WriteString(out, "\n")
+		return nil, false
 	}
+
+	program = expanded.(*ast.Program)
+	optimize.Program(program)
+	resolve.Program(program)
+	eval.Eval(program)
+	return program, true
 }
@@ -0,0 +1,72 @@
+package interpreter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/evaluator"
+	"github.com/jamestrew/go-interpreter/monkey/format"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// recordingEngine keeps the result of the last program it ran.
+type recordingEngine struct {
+	eval   *evaluator.Evaluator
+	result object.Object
+}
+
+func (r *recordingEngine) Eval(node ast.Node) object.Object {
+	r.result = r.eval.Eval(node)
+	return r.result
+}
+
+func TestStartRunsFormattedSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(a, b) { let sum = a + b; sum }; add(1, 2)", "3"},
+		{"let xs = [1, 2, 3]; let acc = {}; if (len(xs) > 2) { acc.total = xs[0] + xs[2] }; acc.total", "4"},
+		{"struct Point { x, y = 0 }; let p = Point(3); p.x + p.y", "3"},
+		{"let unless = macro(c, a) { quote(if (!(unquote(c))) { unquote(a) }) }; unless(1 > 2, 10)", "10"},
+		{"class Counter { init() { self.n = 0 } inc() { self.n = self.n + 1; self } }; Counter().inc().inc().n", "2"},
+	}
+
+	for _, tt := range tests {
+		src, err := format.Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("format.Source failed for `%s`: %s", tt.input, err)
+			continue
+		}
+		if !strings.Contains(strings.TrimSpace(string(src)), "\n") {
+			t.Errorf("expected `%s` to be formatted over several lines. got=%q", tt.input, src)
+		}
+
+		engine := &recordingEngine{eval: evaluator.New(object.NewEnvironment())}
+		var out bytes.Buffer
+		if _, ok := Start(bytes.NewReader(src), &out, engine); !ok {
+			t.Errorf("Start failed for formatted `%s`:\n%s\n%s", tt.input, src, out.String())
+			continue
+		}
+		if engine.result == nil || engine.result.Inspect() != tt.expected {
+			t.Errorf("wrong result for formatted `%s`. expected=%q, got=%v", tt.input, tt.expected, engine.result)
+		}
+	}
+}
+
+func TestStartReportsParseErrors(t *testing.T) {
+	engine := &recordingEngine{eval: evaluator.New(object.NewEnvironment())}
+	var out bytes.Buffer
+	program, ok := Start(strings.NewReader("let x = 1;\nlet = 2;\nx"), &out, engine)
+	if ok || program != nil {
+		t.Errorf("expected Start to fail. got program=%v", program)
+	}
+	if engine.result != nil {
+		t.Errorf("expected nothing to run. got=%s", engine.result.Inspect())
+	}
+	if !strings.Contains(out.String(), "no prefix parse function for = found") {
+		t.Errorf("parse error wasn't printed. got=%q", out.String())
+	}
+}
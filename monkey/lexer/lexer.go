@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"strings"
+
 	"github.com/jamestrew/go-interpreter/monkey/token"
 )
 
@@ -9,17 +11,31 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	line         int
+	column       int
+	comments     []token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) NextToken() token.Token {
 	l.skipWhiteSpace()
+	for l.ch == '/' && l.peekChar() == '/' {
+		l.comments = append(l.comments, l.readComment())
+		l.skipWhiteSpace()
+	}
 
+	line, column := l.line, l.column
+	tok := l.readToken()
+	tok.Line, tok.Column = line, column
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 	switch l.ch {
 	case '=':
@@ -27,7 +43,7 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		tok = token.New(token.PLUS, l.ch)
 	case '-':
-		tok = token.New(token.MINUS, l.ch)
+		tok = l.getMultiChToken('>', token.MINUS, token.ARROW)
 	case '*':
 		tok = token.New(token.ASTERISK, l.ch)
 	case '/':
@@ -44,6 +60,19 @@ func (l *Lexer) NextToken() token.Token {
 		tok = token.New(token.SEMICOLON, l.ch)
 	case ':':
 		tok = token.New(token.COLON, l.ch)
+	case '.':
+		tok = l.readDots()
+	case '?':
+		switch l.peekChar() {
+		case '.':
+			l.readChar()
+			tok = token.Token{Type: token.QUESTION_DOT, Literal: "?."}
+		case '?':
+			l.readChar()
+			tok = token.Token{Type: token.NULLISH, Literal: "??"}
+		default:
+			tok = token.New(token.ILLEGAL, l.ch)
+		}
 	case '(':
 		tok = token.New(token.LPAREN, l.ch)
 	case ')':
@@ -85,7 +114,29 @@ func (l *Lexer) skipWhiteSpace() {
 	}
 }
 
+// Comments returns the comments skipped so far, in order. Comments run from
+// `//` to the end of the line.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+func (l *Lexer) readComment() token.Token {
+	tok := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	tok.Literal = strings.TrimRight(l.input[position:l.position], " \t\r")
+	return tok
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -127,6 +178,25 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// readDots reads ., .., ..< or ...
+func (l *Lexer) readDots() token.Token {
+	if l.peekChar() != '.' {
+		return token.New(token.DOT, l.ch)
+	}
+	l.readChar()
+
+	switch l.peekChar() {
+	case '.':
+		l.readChar()
+		return token.Token{Type: token.ELLIPSIS, Literal: "..."}
+	case '<':
+		l.readChar()
+		return token.Token{Type: token.RANGE_EXC, Literal: "..<"}
+	default:
+		return token.Token{Type: token.RANGE, Literal: ".."}
+	}
+}
+
 func (l *Lexer) getMultiChToken(secChar byte, oneChToken, twoChToken token.TokenType) token.Token {
 	var tok token.Token
 	if l.peekChar() == secChar {
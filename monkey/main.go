@@ -1,15 +1,81 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/user"
 
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/cache"
+	"github.com/jamestrew/go-interpreter/monkey/evaluator"
+	"github.com/jamestrew/go-interpreter/monkey/format"
 	"github.com/jamestrew/go-interpreter/monkey/interpreter"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+	"github.com/jamestrew/go-interpreter/monkey/parser"
 	"github.com/jamestrew/go-interpreter/monkey/repl"
+	"github.com/jamestrew/go-interpreter/monkey/typecheck"
+	"github.com/jamestrew/go-interpreter/monkey/vm"
 )
 
+var legacyBlockScope = flag.Bool(
+	"legacy-block-scope",
+	false,
+	"let bindings inside a block stay visible after it, as in older versions",
+)
+
+var maxDepth = flag.Int(
+	"max-depth",
+	evaluator.DefaultMaxDepth,
+	"how deeply function calls can nest, or 0 for no limit",
+)
+
+var engine = flag.String(
+	"engine",
+	"eval",
+	"what runs programs: eval, the tree-walking evaluator, or vm, the bytecode virtual machine",
+)
+
+func evalOptions() []evaluator.Option {
+	opts := []evaluator.Option{evaluator.WithMaxDepth(*maxDepth)}
+	if *legacyBlockScope {
+		opts = append(opts, evaluator.WithLegacyBlockScope())
+	}
+	return opts
+}
+
+// cacheOptions returns the options cached programs are expanded with, which
+// are the evaluator's.
+func cacheOptions() cache.Options {
+	return cache.Options{LegacyBlockScope: *legacyBlockScope, MaxDepth: *maxDepth}
+}
+
+func vmOptions() []vm.Option {
+	opts := []vm.Option{vm.WithMaxDepth(*maxDepth)}
+	if *legacyBlockScope {
+		opts = append(opts, vm.WithLegacyBlockScope())
+	}
+	return opts
+}
+
+// newEngine returns the engine chosen by --engine.
+func newEngine() interpreter.Engine {
+	switch *engine {
+	case "eval":
+		return evaluator.New(object.NewEnvironment(), evalOptions()...)
+	case "vm":
+		return vm.NewEngine(vmOptions()...)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", *engine)
+		os.Exit(2)
+		return nil
+	}
+}
+
 func startRepl() {
 	user, err := user.Current()
 	if err != nil {
@@ -17,24 +83,187 @@ func startRepl() {
 	}
 
 	fmt.Printf("Hello %s --- Let's get monkey\n", user.Username)
-	repl.Start(os.Stdin, os.Stdout)
+	repl.Start(os.Stdin, os.Stdout, newEngine(), evalOptions()...)
 }
 
+// execFile runs the file at filePath, from its cache if it's up to date, and
+// otherwise from its source, caching it for next time.
 func execFile(filePath string) {
-	f, err := os.Open(filePath)
+	eval := newEngine()
+	src, err := os.ReadFile(filePath)
 	if err != nil {
 		panic(err)
 	}
-	interpreter.Start(f, os.Stdout)
+
+	cachePath := cache.Path(filePath)
+	program, err := cache.Load(cachePath, src, cacheOptions())
+	if err == nil {
+		eval.Eval(program)
+		return
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "warning: ignoring %s: %s\n", cachePath, err)
+	}
+
+	program, ok := interpreter.Start(bytes.NewReader(src), os.Stdout, eval, evalOptions()...)
+	if ok {
+		// the cache only saves time, so a file that can't be written, like one
+		// in a read-only directory, is simply left out
+		cache.Write(cachePath, src, cacheOptions(), program)
+	}
+}
+
+func checkFiles(filePaths []string) {
+	failed := false
+	for _, filePath := range filePaths {
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+
+		program, p := parser.ParseInput(string(src))
+		if len(p.Errors()) != 0 {
+			for _, msg := range p.Errors() {
+				fmt.Printf("%s: %s\n", filePath, msg)
+			}
+			failed = true
+			continue
+		}
+
+		macroEnv := object.NewEnvironment()
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, expandErr := evaluator.ExpandMacros(program, macroEnv, evalOptions()...)
+		if expandErr != nil {
+			fmt.Printf("%s: %s\n", filePath, expandErr.Message)
+			failed = true
+			continue
+		}
+
+		for _, err := range typecheck.Check(expanded.(*ast.Program)) {
+			fmt.Printf("%s:%s\n", filePath, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseFiles prints the AST of each file, in the form given by --format.
+func parseFiles(args []string) {
+	flags := flag.NewFlagSet("parse", flag.ExitOnError)
+	outputFormat := flags.String("format", "string", "how to print the AST: string, json, dot or sexp")
+	asJSON := flags.Bool("json", false, "print the AST as JSON, like --format=json")
+	flags.Parse(args)
+
+	if *asJSON {
+		*outputFormat = "json"
+	}
+	switch *outputFormat {
+	case "string", "json", "dot", "sexp":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *outputFormat)
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, filePath := range flags.Args() {
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+
+		program, p := parser.ParseInput(string(src))
+		if len(p.Errors()) != 0 {
+			for _, msg := range p.Errors() {
+				fmt.Printf("%s: %s\n", filePath, msg)
+			}
+			failed = true
+			continue
+		}
+
+		switch *outputFormat {
+		case "json":
+			data, err := json.MarshalIndent(program, "", "  ")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+				continue
+			}
+			fmt.Println(string(data))
+		case "dot":
+			fmt.Print(ast.Dot(program))
+		case "sexp":
+			fmt.Println(ast.SExpr(program))
+		default:
+			fmt.Println(program.String())
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// formatFiles prints each file formatted, or rewrites it if -w is given.
+func formatFiles(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of printing it")
+	flags.Parse(args)
+
+	failed := false
+	for _, filePath := range flags.Args() {
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+
+		out, err := format.Source(src)
+		if err != nil {
+			fmt.Printf("%s: %s\n", filePath, err)
+			failed = true
+			continue
+		}
+
+		if !*write {
+			os.Stdout.Write(out)
+			continue
+		}
+		if string(out) == string(src) {
+			continue
+		}
+		if err := os.WriteFile(filePath, out, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
 }
 
 func main() {
 	flag.Parse()
 	args := flag.Args()
 
-	if len(args) == 0 {
+	switch {
+	case len(args) == 0:
 		startRepl()
-	} else {
+	case args[0] == "check":
+		checkFiles(args[1:])
+	case args[0] == "parse":
+		parseFiles(args[1:])
+	case args[0] == "fmt":
+		formatFiles(args[1:])
+	default:
 		execFile(flag.Arg(0))
 	}
 }
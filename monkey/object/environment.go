@@ -1,7 +1,16 @@
 package object
 
+import "sync"
+
+// Environment is safe for concurrent use, since spawned tasks share the
+// environments their functions captured.
+//
+// Local variables the resolver found a slot for are kept in slots. Globals, and
+// any name the resolver left alone, are kept in store by name.
 type Environment struct {
+	mu    sync.RWMutex
 	store map[string]Object
+	slots []Object
 	outer *Environment
 }
 
@@ -10,14 +19,16 @@ func NewEnvironment() *Environment {
 	return &Environment{store: store, outer: nil}
 }
 
+// NewEnclosedEnvironment returns a scope nested in outer. Its store is only
+// made once a name is set in it, since most scopes only hold slots.
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	return &Environment{outer: outer}
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
 	obj, ok := e.store[name]
+	e.mu.RUnlock()
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
@@ -25,6 +36,46 @@ func (e *Environment) Get(name string) (Object, bool) {
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = val
+	e.mu.Unlock()
+	return val
+}
+
+// scope returns the environment depth scopes out from e.
+func (e *Environment) scope(depth int) *Environment {
+	env := e
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	return env
+}
+
+// GetLocal returns the value in slot of the scope depth scopes out, reporting
+// false if nothing has been set there yet.
+func (e *Environment) GetLocal(depth, slot int) (Object, bool) {
+	env := e.scope(depth)
+	var obj Object
+	env.mu.RLock()
+	if slot < len(env.slots) {
+		obj = env.slots[slot]
+	}
+	env.mu.RUnlock()
+	return obj, obj != nil
+}
+
+// SetLocal sets slot of e to val, growing the slots to hold it.
+func (e *Environment) SetLocal(slot int, val Object) Object {
+	e.mu.Lock()
+	if slot >= len(e.slots) {
+		slots := make([]Object, slot+1)
+		copy(slots, e.slots)
+		e.slots = slots
+	}
+	e.slots[slot] = val
+	e.mu.Unlock()
 	return val
 }
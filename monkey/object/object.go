@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/code"
 )
 
 type ObjectType string
@@ -22,6 +26,23 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	STRUCT_TYPE_OBJ  = "STRUCT_TYPE"
+	STRUCT_OBJ       = "STRUCT"
+	CLASS_OBJ        = "CLASS"
+	INSTANCE_OBJ     = "INSTANCE"
+	BOUND_METHOD_OBJ = "BOUND_METHOD"
+	SUPER_OBJ        = "SUPER"
+	ENUM_OBJ         = "ENUM"
+	ENUM_VARIANT_OBJ = "ENUM_VARIANT"
+	ENUM_VALUE_OBJ   = "ENUM_VALUE"
+	ITERATOR_OBJ     = "ITERATOR"
+	CHANNEL_OBJ      = "CHANNEL"
+	TASK_OBJ         = "TASK"
+	RANGE_OBJ        = "RANGE"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type Object interface {
@@ -38,6 +59,21 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// HashKeyOf returns the hash key of obj, reporting false if obj, or any value
+// it's composed of, isn't hashable.
+func HashKeyOf(obj Object) (HashKey, bool) {
+	switch obj := obj.(type) {
+	case *Struct:
+		return obj.hashKey()
+	case *EnumValue:
+		return obj.hashKey()
+	case Hashable:
+		return obj.HashKey(), true
+	default:
+		return HashKey{}, false
+	}
+}
+
 type Integer struct {
 	Value int64
 }
@@ -84,25 +120,98 @@ func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
 type Function struct {
-	Parameters []*ast.Identifier
-	Body       *ast.BlockStatement
-	Env        *Environment
+	Parameters  []*ast.Identifier
+	Body        *ast.BlockStatement
+	Env         *Environment
+	IsGenerator bool
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
+	return inspectFunction(f.Parameters, f.Body, f.IsGenerator)
+}
+
+func inspectFunction(parameters []*ast.Identifier, body *ast.BlockStatement, isGenerator bool) string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, param := range f.Parameters {
+	for _, param := range parameters {
 		params = append(params, param.String())
 	}
 
 	out.WriteString("fn")
+	if isGenerator {
+		out.WriteString("*")
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	if body != nil {
+		out.WriteString(body.String())
+	}
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// CompiledFunction is the bytecode of a function, for the vm. The source it was
+// compiled from is kept for Inspect, along with the names of its variables for
+// the errors about them.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	// IsMethod is set for the methods of a class, which take the values of
+	// self and super ahead of their parameters
+	IsMethod bool
+
+	Parameters  []*ast.Identifier
+	Body        *ast.BlockStatement
+	IsGenerator bool
+
+	LocalNames []string
+	FreeNames  []string
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return inspectFunction(cf.Parameters, cf.Body, cf.IsGenerator)
+}
+
+// Callable is a function that runs itself, like a closure of the vm. The
+// evaluator calls them with Call.
+type Callable interface {
+	Object
+	Call(args ...Object) Object
+}
+
+// Quote is an unevaluated piece of the program.
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, param := range m.Parameters {
+		params = append(params, param.String())
+	}
+
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
 	out.WriteString("\n}")
 
 	return out.String()
@@ -128,7 +237,10 @@ type Builtin struct {
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
+// Array is safe for concurrent use through its methods, since spawned tasks can
+// share it. Elements is only used directly while the array is being built.
 type Array struct {
+	mu       sync.RWMutex
 	Elements []Object
 }
 
@@ -137,7 +249,7 @@ func (a *Array) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, param := range a.Elements {
+	for _, param := range a.Snapshot() {
 		params = append(params, param.Inspect())
 	}
 
@@ -147,12 +259,76 @@ func (a *Array) Inspect() string {
 	return out.String()
 }
 
+func (a *Array) Len() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.Elements)
+}
+
+// Get returns the element at idx, counting back from the end if it's negative,
+// or false if there's no such element.
+func (a *Array) Get(idx int64) (Object, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if idx < 0 {
+		idx += int64(len(a.Elements))
+	}
+	if idx < 0 || idx >= int64(len(a.Elements)) {
+		return nil, false
+	}
+	return a.Elements[idx], true
+}
+
+// Set replaces the element at idx, counting back from the end if it's
+// negative, reporting false if there's no such element.
+func (a *Array) Set(idx int64, value Object) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if idx < 0 {
+		idx += int64(len(a.Elements))
+	}
+	if idx < 0 || idx >= int64(len(a.Elements)) {
+		return false
+	}
+	a.Elements[idx] = value
+	return true
+}
+
+func (a *Array) Append(values ...Object) {
+	a.mu.Lock()
+	a.Elements = append(a.Elements, values...)
+	a.mu.Unlock()
+}
+
+// Pop removes the last element and returns it, or false if there's none.
+func (a *Array) Pop() (Object, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.Elements) == 0 {
+		return nil, false
+	}
+	last := a.Elements[len(a.Elements)-1]
+	a.Elements = a.Elements[:len(a.Elements)-1]
+	return last, true
+}
+
+// Snapshot returns a copy of the elements, which later changes to the array
+// don't affect.
+func (a *Array) Snapshot() []Object {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Object{}, a.Elements...)
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
 }
 
+// Hash is safe for concurrent use through its methods, since spawned tasks can
+// share it. Pairs is only used directly while the hash is being built.
 type Hash struct {
+	mu    sync.RWMutex
 	Pairs map[HashKey]HashPair
 }
 
@@ -161,7 +337,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Snapshot() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
@@ -171,3 +347,411 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+func (h *Hash) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.Pairs)
+}
+
+func (h *Hash) Get(key HashKey) (HashPair, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	pair, ok := h.Pairs[key]
+	return pair, ok
+}
+
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	h.mu.Lock()
+	h.Pairs[key] = pair
+	h.mu.Unlock()
+}
+
+// Snapshot returns a copy of the pairs, which later changes to the hash don't
+// affect.
+func (h *Hash) Snapshot() map[HashKey]HashPair {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	pairs := make(map[HashKey]HashPair, len(h.Pairs))
+	for key, pair := range h.Pairs {
+		pairs[key] = pair
+	}
+	return pairs
+}
+
+// StructType is a struct definition. The defaults of a struct compiled for the
+// vm are computed by calling the functions in Compiled, rather than evaluating
+// Defaults in Env.
+type StructType struct {
+	Name     string
+	Fields   []string
+	Defaults map[string]ast.Expression
+	Env      *Environment
+	Compiled map[string]Object
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string  { return "struct " + st.Name }
+
+func (st *StructType) HasField(name string) bool {
+	for _, field := range st.Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Struct is safe for concurrent use through its methods, since spawned tasks
+// can share it. Values is only used directly while the struct is being built.
+type Struct struct {
+	mu     sync.RWMutex
+	Def    *StructType
+	Values map[string]Object
+}
+
+// Get returns the value of the field called name, or false if there's none.
+func (s *Struct) Get(name string) (Object, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.Values[name]
+	return value, ok
+}
+
+func (s *Struct) Set(name string, value Object) {
+	s.mu.Lock()
+	s.Values[name] = value
+	s.mu.Unlock()
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, field := range s.Def.Fields {
+		value, _ := s.Get(field)
+		fields = append(fields, fmt.Sprintf("%s: %s", field, value.Inspect()))
+	}
+
+	out.WriteString(s.Def.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (s *Struct) hashKey() (HashKey, bool) {
+	h := fnv.New64a()
+	h.Write([]byte(s.Def.Name))
+	for _, field := range s.Def.Fields {
+		value, _ := s.Get(field)
+		key, ok := HashKeyOf(value)
+		if !ok {
+			return HashKey{}, false
+		}
+		fmt.Fprintf(h, "|%s:%s:%d", field, key.Type, key.Value)
+	}
+	return HashKey{Type: s.Type(), Value: h.Sum64()}, true
+}
+
+// Class is a class definition. Its methods are Functions, or Callables when it
+// was compiled for the vm.
+type Class struct {
+	Name    string
+	Super   *Class
+	Methods map[string]Object
+}
+
+func (c *Class) Type() ObjectType { return CLASS_OBJ }
+func (c *Class) Inspect() string  { return "class " + c.Name }
+
+// FindMethod looks up name on the class and its superclasses, returning the
+// method along with the class that defines it.
+func (c *Class) FindMethod(name string) (Object, *Class) {
+	for class := c; class != nil; class = class.Super {
+		if method, ok := class.Methods[name]; ok {
+			return method, class
+		}
+	}
+	return nil, nil
+}
+
+// Instance is safe for concurrent use through its methods, since spawned tasks
+// can share it. Fields is only used directly while the instance is being
+// built.
+type Instance struct {
+	mu     sync.RWMutex
+	Class  *Class
+	Fields map[string]Object
+}
+
+// Get returns the field called name, or false if it isn't set.
+func (i *Instance) Get(name string) (Object, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	value, ok := i.Fields[name]
+	return value, ok
+}
+
+func (i *Instance) Set(name string, value Object) {
+	i.mu.Lock()
+	i.Fields[name] = value
+	i.mu.Unlock()
+}
+
+func (i *Instance) Type() ObjectType { return INSTANCE_OBJ }
+func (i *Instance) Inspect() string {
+	var out bytes.Buffer
+
+	i.mu.RLock()
+	values := make(map[string]Object, len(i.Fields))
+	names := []string{}
+	for name, value := range i.Fields {
+		names = append(names, name)
+		values[name] = value
+	}
+	i.mu.RUnlock()
+	sort.Strings(names)
+
+	fields := []string{}
+	for _, name := range names {
+		fields = append(fields, fmt.Sprintf("%s: %s", name, values[name].Inspect()))
+	}
+
+	out.WriteString(i.Class.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// BoundMethod is a method bound to the instance it was accessed on. Class is the
+// class defining the method, which is where `super` lookups start from. A
+// method that's a Callable is called with self and super ahead of its
+// arguments, super being null when Class has no superclass.
+type BoundMethod struct {
+	Receiver *Instance
+	Class    *Class
+	Name     string
+	Method   Object
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (bm *BoundMethod) Inspect() string {
+	return fmt.Sprintf("bound method %s.%s", bm.Class.Name, bm.Name)
+}
+
+// Super is the value of `super` inside a method, resolving methods starting
+// from Class but binding them to Receiver.
+type Super struct {
+	Receiver *Instance
+	Class    *Class
+}
+
+func (s *Super) Type() ObjectType { return SUPER_OBJ }
+func (s *Super) Inspect() string  { return "super " + s.Class.Name }
+
+type Enum struct {
+	Name     string
+	Variants map[string]*EnumVariant
+}
+
+func (e *Enum) Type() ObjectType { return ENUM_OBJ }
+func (e *Enum) Inspect() string  { return "enum " + e.Name }
+
+// EnumVariant is a variant of an enum. Variants with a payload are called to
+// construct values, while Unit holds the only value of variants without one.
+type EnumVariant struct {
+	Enum   *Enum
+	Name   string
+	Fields []string
+	Unit   *EnumValue
+}
+
+func (ev *EnumVariant) Type() ObjectType { return ENUM_VARIANT_OBJ }
+func (ev *EnumVariant) Inspect() string  { return ev.Enum.Name + "." + ev.Name }
+
+type EnumValue struct {
+	Variant *EnumVariant
+	Payload []Object
+}
+
+func (ev *EnumValue) Type() ObjectType { return ENUM_VALUE_OBJ }
+func (ev *EnumValue) Inspect() string {
+	if ev.Variant.Unit != nil {
+		return ev.Variant.Inspect()
+	}
+
+	payload := []string{}
+	for _, value := range ev.Payload {
+		payload = append(payload, value.Inspect())
+	}
+	return ev.Variant.Inspect() + "(" + strings.Join(payload, ", ") + ")"
+}
+
+func (ev *EnumValue) hashKey() (HashKey, bool) {
+	h := fnv.New64a()
+	h.Write([]byte(ev.Variant.Inspect()))
+	for _, value := range ev.Payload {
+		key, ok := HashKeyOf(value)
+		if !ok {
+			return HashKey{}, false
+		}
+		fmt.Fprintf(h, "|%s:%d", key.Type, key.Value)
+	}
+	return HashKey{Type: ev.Type(), Value: h.Sum64()}, true
+}
+
+// Iterator lazily produces a sequence of values. Next reports false once the
+// sequence is exhausted.
+type Iterator struct {
+	Name string
+	Next func() (Object, bool)
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return it.Name }
+
+// Channel carries values between tasks.
+type Channel struct {
+	Ch     chan Object
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return fmt.Sprintf("channel(%d)", cap(c.Ch)) }
+
+// Close closes the channel, reporting false if it was already closed.
+func (c *Channel) Close() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.closed = true
+	close(c.Ch)
+	return true
+}
+
+// Task is a function call running on its own goroutine. Done is closed once
+// Result is set.
+type Task struct {
+	Done   chan struct{}
+	Result Object
+}
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string  { return "task" }
+
+// Wait blocks until the task has finished, returning its result.
+func (t *Task) Wait() Object {
+	<-t.Done
+	return t.Result
+}
+
+// Range is a lazy sequence of integers from Start towards End, Step apart.
+// End is included unless the range is Exclusive.
+type Range struct {
+	Start     int64
+	End       int64
+	Step      int64
+	Exclusive bool
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	op := ".."
+	if r.Exclusive {
+		op = "..<"
+	}
+	out := fmt.Sprintf("%d%s%d", r.Start, op, r.End)
+	if r.Step != 1 {
+		out += fmt.Sprintf(" step %d", r.Step)
+	}
+	return out
+}
+
+// distance returns how far the range moves from its start to reach n, in the
+// direction of its step, reporting false if n is behind the start. It can't
+// overflow, since it's at most the distance between two int64s.
+func (r *Range) distance(n int64) (uint64, bool) {
+	if r.Step > 0 {
+		return uint64(n) - uint64(r.Start), n >= r.Start
+	}
+	return uint64(r.Start) - uint64(n), n <= r.Start
+}
+
+// stride returns the size of the step.
+func (r *Range) stride() uint64 {
+	if r.Step > 0 {
+		return uint64(r.Step)
+	}
+	return -uint64(r.Step)
+}
+
+// count returns the number of integers in the range, reporting false if
+// there are more than an int64 can hold.
+func (r *Range) count() (int64, bool) {
+	dist, ok := r.distance(r.End)
+	if !ok || (r.Exclusive && dist == 0) {
+		return 0, true
+	}
+	if r.Exclusive {
+		dist--
+	}
+	n := dist / r.stride()
+	if n >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(n) + 1, true
+}
+
+// TooLong reports whether the range holds more integers than an int64 can
+// count, which NewRange in the evaluator rejects.
+func (r *Range) TooLong() bool {
+	_, ok := r.count()
+	return !ok
+}
+
+// Len returns the number of integers in the range, which mustn't be TooLong.
+func (r *Range) Len() int64 {
+	n, _ := r.count()
+	return n
+}
+
+// At returns the integer at idx, which must be in [0, Len()).
+func (r *Range) At(idx int64) int64 {
+	return r.Start + idx*r.Step
+}
+
+// Contains reports whether n is one of the integers in the range.
+func (r *Range) Contains(n int64) bool {
+	dist, ok := r.distance(n)
+	if !ok || dist%r.stride() != 0 {
+		return false
+	}
+	return dist/r.stride() < uint64(r.Len())
+}
+
+// Slice returns the part of the range between the indexes lo and hi, which
+// must satisfy 0 <= lo <= hi <= Len().
+func (r *Range) Slice(lo, hi int64) *Range {
+	if hi > lo {
+		// the exclusive bound of a range ending near the int64 limits can't
+		// be represented, so end at the last integer instead
+		last := r.At(hi - 1)
+		if next := last + r.Step; (next > last) != (r.Step > 0) {
+			return &Range{Start: r.At(lo), End: last, Step: r.Step}
+		}
+	}
+	return &Range{
+		Start:     r.At(lo),
+		End:       r.At(hi),
+		Step:      r.Step,
+		Exclusive: true,
+	}
+}
@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"sync"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +61,80 @@ func TestBoolHashKey(t *testing.T) {
 		t.Errorf("bools with different content has same hash keys")
 	}
 }
+
+func TestStructHashKey(t *testing.T) {
+	point := &StructType{Name: "Point", Fields: []string{"x", "y"}}
+	newPoint := func(x, y Object) *Struct {
+		return &Struct{Def: point, Values: map[string]Object{"x": x, "y": y}}
+	}
+
+	p1a, ok := HashKeyOf(newPoint(&Integer{Value: 1}, &String{Value: "a"}))
+	if !ok {
+		t.Fatalf("struct with hashable fields is not hashable")
+	}
+	p1b, _ := HashKeyOf(newPoint(&Integer{Value: 1}, &String{Value: "a"}))
+	p2, _ := HashKeyOf(newPoint(&Integer{Value: 2}, &String{Value: "a"}))
+
+	if p1a != p1b {
+		t.Errorf("structs with the same content has different hash keys")
+	}
+
+	if p1a == p2 {
+		t.Errorf("structs with different content has same hash keys")
+	}
+
+	if _, ok := HashKeyOf(newPoint(&Integer{Value: 1}, &Array{})); ok {
+		t.Errorf("struct with unhashable field is hashable")
+	}
+}
+
+func TestEnvironmentConcurrentAccess(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 0})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			env := NewEnclosedEnvironment(outer)
+			for j := 0; j < 100; j++ {
+				env.Set("y", &Integer{Value: int64(j)})
+				outer.Set("x", &Integer{Value: int64(i)})
+				if _, ok := env.Get("x"); !ok {
+					t.Errorf("x not found")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, ok := outer.Get("y"); ok {
+		t.Errorf("y leaked into the outer environment")
+	}
+}
+
+func TestEnvironmentLocals(t *testing.T) {
+	outer := NewEnclosedEnvironment(NewEnvironment())
+	inner := NewEnclosedEnvironment(outer)
+
+	if _, ok := inner.GetLocal(1, 0); ok {
+		t.Errorf("unset slot found")
+	}
+	outer.SetLocal(2, &Integer{Value: 1})
+	if _, ok := inner.GetLocal(1, 1); ok {
+		t.Errorf("slot skipped by SetLocal found")
+	}
+	outer.SetLocal(2, &Integer{Value: 2})
+	if _, ok := inner.GetLocal(0, 2); ok {
+		t.Errorf("slot of the outer scope found in the inner one")
+	}
+
+	obj, ok := inner.GetLocal(1, 2)
+	if !ok || obj.(*Integer).Value != 2 {
+		t.Errorf("wrong value in slot. got=%v", obj)
+	}
+	if _, ok := inner.Get("x"); ok {
+		t.Errorf("slots found by name")
+	}
+}
@@ -0,0 +1,299 @@
+// Package optimize rewrites programs so that they do less work when they're
+// evaluated, without changing what they evaluate to.
+package optimize
+
+import (
+	"strconv"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+// Program optimizes program in place. It folds prefix and infix operators on
+// integer, string and boolean literals, replaces if expressions whose condition
+// is a literal by the branch they take, and drops the statements after a return.
+// Operations that fail, like a division by zero, are left to fail when the
+// program runs.
+//
+// Programs should be optimized after their macros are expanded. The arguments
+// of quote are left as they are.
+func Program(program *ast.Program) {
+	ast.Apply(program, skipQuotes, optimize)
+}
+
+func skipQuotes(c *ast.Cursor) bool {
+	call, ok := c.Node().(*ast.CallExpression)
+	if !ok {
+		return true
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	return !ok || ident.Value != "quote"
+}
+
+// optimize rewrites the node at c, whose children are already optimized.
+func optimize(c *ast.Cursor) bool {
+	switch node := c.Node().(type) {
+	case *ast.PrefixExpression:
+		if folded := foldPrefix(node); folded != nil {
+			c.Replace(folded)
+		}
+	case *ast.InfixExpression:
+		if folded := foldInfix(node); folded != nil {
+			c.Replace(folded)
+		}
+	case *ast.IfExpression:
+		if taken := pruneIf(node); taken != nil {
+			c.Replace(taken)
+		}
+	case *ast.BlockStatement:
+		node.Statements = optimizeStatements(node.Statements)
+	case *ast.Program:
+		node.Statements = optimizeStatements(node.Statements)
+	}
+	return true
+}
+
+func foldPrefix(pe *ast.PrefixExpression) ast.Expression {
+	switch pe.Operator {
+	case "!":
+		if truthy, ok := truthiness(pe.Right); ok {
+			return newBoolean(pe.Token, !truthy)
+		}
+	case "-":
+		if right, ok := pe.Right.(*ast.IntegerLiteral); ok {
+			return newInteger(pe.Token, -right.Value)
+		}
+	}
+	return nil
+}
+
+func foldInfix(ie *ast.InfixExpression) ast.Expression {
+	switch left := ie.Left.(type) {
+	case *ast.IntegerLiteral:
+		if right, ok := ie.Right.(*ast.IntegerLiteral); ok {
+			return foldIntegers(ie.Token, ie.Operator, left.Value, right.Value)
+		}
+	case *ast.StringLiteral:
+		if right, ok := ie.Right.(*ast.StringLiteral); ok {
+			return foldStrings(ie.Token, ie.Operator, left.Value, right.Value)
+		}
+	}
+
+	// literals of different types are never equal
+	if !isLiteral(ie.Left) || !isLiteral(ie.Right) {
+		return nil
+	}
+	switch ie.Operator {
+	case "==":
+		return newBoolean(ie.Token, literalsEqual(ie.Left, ie.Right))
+	case "!=":
+		return newBoolean(ie.Token, !literalsEqual(ie.Left, ie.Right))
+	}
+	return nil
+}
+
+func foldIntegers(tok token.Token, operator string, left, right int64) ast.Expression {
+	switch operator {
+	case "+":
+		return newInteger(tok, left+right)
+	case "-":
+		return newInteger(tok, left-right)
+	case "*":
+		return newInteger(tok, left*right)
+	case "/":
+		if right == 0 {
+			return nil
+		}
+		return newInteger(tok, left/right)
+	case "<":
+		return newBoolean(tok, left < right)
+	case ">":
+		return newBoolean(tok, left > right)
+	case "==":
+		return newBoolean(tok, left == right)
+	case "!=":
+		return newBoolean(tok, left != right)
+	}
+	return nil
+}
+
+func foldStrings(tok token.Token, operator string, left, right string) ast.Expression {
+	switch operator {
+	case "+":
+		return newString(tok, left+right)
+	case "==":
+		return newBoolean(tok, left == right)
+	case "!=":
+		return newBoolean(tok, left != right)
+	}
+	return nil
+}
+
+// pruneIf drops the branch of ie that isn't taken if its condition is a
+// literal. It returns the expression that replaces ie if the taken branch is a
+// single expression that can be evaluated outside its block, or nil if ie
+// stays.
+func pruneIf(ie *ast.IfExpression) ast.Expression {
+	truthy, ok := truthiness(ie.Condition)
+	if !ok {
+		return nil
+	}
+	if !truthy {
+		if ie.Alternative == nil {
+			return nil
+		}
+		ie.Condition = newBoolean(ie.Token, true)
+		ie.Consequence = ie.Alternative
+	}
+	ie.Alternative = nil
+
+	stmts := ie.Consequence.Statements
+	if len(stmts) != 1 || declares(stmts[0]) {
+		return nil
+	}
+	if stmt, ok := stmts[0].(*ast.ExpressionStatement); ok {
+		return stmt.Expression
+	}
+	return nil
+}
+
+// optimizeStatements splices the taken branches of if statements with literal
+// conditions into stmts, and drops the statements after the first return.
+func optimizeStatements(stmts []ast.Statement) []ast.Statement {
+	out := []ast.Statement{}
+	for idx, stmt := range stmts {
+		branch, ok := takenBranch(stmt)
+		// the value of an if without statements is null, which matters for
+		// the last statement
+		last := idx == len(stmts)-1
+		if !ok || len(branch) == 0 && last || anyDeclares(branch) {
+			out = append(out, stmt)
+			continue
+		}
+		out = append(out, branch...)
+	}
+
+	for idx, stmt := range out {
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			return out[:idx+1]
+		}
+	}
+	return out
+}
+
+// takenBranch returns the statements stmt evaluates if it's an if expression
+// with a literal condition.
+func takenBranch(stmt ast.Statement) ([]ast.Statement, bool) {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	ie, ok := es.Expression.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+	truthy, ok := truthiness(ie.Condition)
+	switch {
+	case !ok:
+		return nil, false
+	case truthy:
+		return ie.Consequence.Statements, true
+	case ie.Alternative != nil:
+		return ie.Alternative.Statements, true
+	default:
+		return nil, true
+	}
+}
+
+func anyDeclares(stmts []ast.Statement) bool {
+	for _, stmt := range stmts {
+		if declares(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// declares reports whether stmt binds a name in the scope it's evaluated in, so
+// it can't be moved out of its block.
+func declares(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.LetStatement, *ast.StructStatement, *ast.ClassStatement, *ast.EnumStatement:
+		return true
+	}
+
+	found := false
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			// named functions are bound where they're defined
+			found = found || node.Name != nil
+		case *ast.BlockStatement:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+func isLiteral(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	default:
+		return false
+	}
+}
+
+func literalsEqual(left, right ast.Expression) bool {
+	switch left := left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := right.(*ast.IntegerLiteral)
+		return ok && left.Value == right.Value
+	case *ast.StringLiteral:
+		right, ok := right.(*ast.StringLiteral)
+		return ok && left.Value == right.Value
+	case *ast.Boolean:
+		right, ok := right.(*ast.Boolean)
+		return ok && left.Value == right.Value
+	default:
+		return false
+	}
+}
+
+// truthiness reports whether exp is truthy if it's a literal.
+func truthiness(exp ast.Expression) (truthy bool, ok bool) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return exp.Value != 0, true
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.StringLiteral:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// The literals that replace folded expressions keep the position of the
+// expression's token.
+
+func newInteger(pos token.Token, value int64) *ast.IntegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: newToken(pos, token.INT, literal), Value: value}
+}
+
+func newString(pos token.Token, value string) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: newToken(pos, token.STRING, value), Value: value}
+}
+
+func newBoolean(pos token.Token, value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: newToken(pos, token.TRUE, "true"), Value: true}
+	}
+	return &ast.Boolean{Token: newToken(pos, token.FALSE, "false"), Value: false}
+}
+
+func newToken(pos token.Token, typ token.TokenType, literal string) token.Token {
+	return token.Token{Type: typ, Literal: literal, Line: pos.Line, Column: pos.Column}
+}
@@ -0,0 +1,178 @@
+package optimize
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/evaluator"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+	"github.com/jamestrew/go-interpreter/monkey/parser"
+)
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"60 * 60 * 24", "86400"},
+		{"1 + x * 2", "(1 + (x * 2))"},
+		{"x * 2 * 3", "((x * 2) * 3)"},
+		{"-(2 - 5)", "3"},
+		{`"a" + "b" == "ab"`, "true"},
+		{`"a" - "b"`, `("a" - "b")`},
+		{"!0; !!5; !\"\"", "true;true;false"},
+		{"1 == true; 1 != \"1\"; true == !false", "false;true;true"},
+		{"1 < 2; 2 > 3; 3 != 3", "true;false;false"},
+		{"10 / 0; 10 / (5 - 5)", "(10 / 0);(10 / 0)"},
+		{"true + 1; -true", "(true + 1);(-true)"},
+		{"1 in [1]; x ?? 1 + 1", "(1 in [1]);(x ?? 2)"},
+		{"let x = if (1 < 2) { 10 } else { 20 };", "let x = 10;"},
+		{"let x = if (0) { 10 } else { 20 };", "let x = 20;"},
+		{"let x = if (false) { 10 };", "let x = if (false) { 10 };"},
+		{"let x = if (true) { f(); 10 } else { 20 };", "let x = if (true) { f();10 };"},
+		{"let x = if (y) { 1 + 1 } else { 2 * 2 };", "let x = if (y) { 2 } else { 4 };"},
+		{"if (true) { f(); g() }; h()", "f();g();h()"},
+		{"if (false) { f() }; h()", "h()"},
+		{"if (false) { f() } else { g(); h() }", "g();h()"},
+		{"f(); if (false) { g() }", "f();if (false) { g() }"},
+		{"f(); if (true) {}", "f();if (true) {}"},
+		{"if (true) { let x = 1; x }; x", "if (true) { let x = 1;x };x"},
+		{"if (true) { fn f() { 1 } }; f()", "if (true) { fn f() { 1 } };f()"},
+		{"if (true) { g(fn f() { 1 }) }; f()", "if (true) { g(fn f() { 1 }) };f()"},
+		{"if (true) { g(fn() { let x = 1; x }) }", "g(fn() { let x = 1;x })"},
+		{"fn() { f(); return 1 + 1; g(); h() }", "fn() { f();return 2; }"},
+		{"fn() { if (true) { return 1 }; g() }", "fn() { return 1; }"},
+		{"fn() { if (x) { return 1; g() }; h() }", "fn() { if (x) { return 1; };h() }"},
+		{"return 1; f()", "return 1;"},
+		{"quote(1 + 2) + (3 + 4)", "(quote((1 + 2)) + 7)"},
+	}
+
+	for _, tt := range tests {
+		program, p := parser.ParseInput(tt.input)
+		if len(p.Errors()) != 0 {
+			t.Fatalf("failed to parse `%s`: %v", tt.input, p.Errors())
+		}
+
+		Program(program)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for `%s`.\nexpected=%q\ngot=     %q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestProgramKeepsPositions(t *testing.T) {
+	program, _ := parser.ParseInput("let x =\n  2 * 3;")
+	Program(program)
+
+	lit, ok := program.Statements[0].(*ast.LetStatement).Value.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("value not folded. got=%s", program.String())
+	}
+	if lit.Token.Line != 2 || lit.Token.Column != 5 {
+		t.Errorf("wrong position. got=%d:%d", lit.Token.Line, lit.Token.Column)
+	}
+}
+
+// evaluatorInputs returns the string literals in the evaluator tests that parse
+// without errors.
+func evaluatorInputs(t *testing.T) []string {
+	fset := gotoken.NewFileSet()
+	file, err := goparser.ParseFile(fset, "../evaluator/evaluator_test.go", nil, 0)
+	if err != nil {
+		t.Fatalf("failed to parse evaluator_test.go: %s", err)
+	}
+
+	inputs := []string{}
+	goast.Inspect(file, func(node goast.Node) bool {
+		lit, ok := node.(*goast.BasicLit)
+		if !ok || lit.Kind != gotoken.STRING {
+			return true
+		}
+		input, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		program, p := parser.ParseInput(input)
+		if len(p.Errors()) == 0 && len(program.Statements) > 0 {
+			inputs = append(inputs, input)
+		}
+		return true
+	})
+	return inputs
+}
+
+func eval(input string, optimized bool) object.Object {
+	program, _ := parser.ParseInput(input)
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return err
+	}
+	if optimized {
+		Program(expanded.(*ast.Program))
+	}
+	return evaluator.New(object.NewEnvironment()).Eval(expanded)
+}
+
+// canonical is obj.Inspect() with the pairs of hashes sorted, since they're in
+// no particular order.
+func canonical(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.Hash:
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, canonical(pair.Key)+": "+canonical(pair.Value))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *object.Array:
+		elems := []string{}
+		for _, elem := range obj.Elements {
+			elems = append(elems, canonical(elem))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	default:
+		return obj.Inspect()
+	}
+}
+
+func TestProgramMatchesEvaluation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("evaluates the evaluator tests twice")
+	}
+
+	inputs := evaluatorInputs(t)
+	if len(inputs) < 200 {
+		t.Fatalf("expected at least 200 inputs. got=%d", len(inputs))
+	}
+
+	for _, input := range inputs {
+		expected := eval(input, false)
+		got := eval(input, true)
+		if expected == nil || got == nil {
+			if expected != got {
+				t.Errorf("wrong result for `%s`. expected=%v, got=%v", input, expected, got)
+			}
+			continue
+		}
+
+		switch expected.Type() {
+		case object.FUNCTION_OBJ, object.MACRO_OBJ:
+			// these show their optimized code
+			if got.Type() != expected.Type() {
+				t.Errorf("wrong result for `%s`. expected=%s, got=%s", input, expected.Inspect(), got.Inspect())
+			}
+			continue
+		}
+		if canonical(got) != canonical(expected) {
+			t.Errorf("wrong result for `%s`.\nexpected=%s\ngot=     %s", input, canonical(expected), canonical(got))
+		}
+	}
+}
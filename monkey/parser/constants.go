@@ -5,24 +5,44 @@ import "github.com/jamestrew/go-interpreter/monkey/token"
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN
+	NULLISH
 	EQUALS
 	LESSGREATER
+	RANGE
 	SUM
 	PRODUCT
 	PREFIX
 	CALL
 	INDEX
+	MEMBER
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:       ASSIGN,
+	token.NULLISH:      NULLISH,
+	token.EQ:           EQUALS,
+	token.NOT_EQ:       EQUALS,
+	token.LT:           LESSGREATER,
+	token.GT:           LESSGREATER,
+	token.IN:           LESSGREATER,
+	token.RANGE:        RANGE,
+	token.RANGE_EXC:    RANGE,
+	token.PLUS:         SUM,
+	token.MINUS:        SUM,
+	token.SLASH:        PRODUCT,
+	token.ASTERISK:     PRODUCT,
+	token.LPAREN:       CALL,
+	token.LBRACKET:     INDEX,
+	token.DOT:          MEMBER,
+	token.QUESTION_DOT: MEMBER,
+}
+
+// Precedence returns the precedence of the infix operator t, or LOWEST if t
+// isn't one.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
 }
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+)
+
+func TestPrecedenceSExpr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"a + b * c",
+			`(InfixExpression :left (Identifier :value "a") :operator "+" :right ` +
+				`(InfixExpression :left (Identifier :value "b") :operator "*" :right (Identifier :value "c")))`,
+		},
+		{
+			"-a.b",
+			`(PrefixExpression :operator "-" :right ` +
+				`(MemberExpression :object (Identifier :value "a") :property (Identifier :value "b")))`,
+		},
+		{
+			"x.z = y ?? 1..2",
+			`(AssignExpression :target (MemberExpression :object (Identifier :value "x") :property (Identifier :value "z")) :value (InfixExpression ` +
+				`:left (Identifier :value "y") :operator "??" :right ` +
+				`(RangeExpression :start (IntegerLiteral :value 1) :end (IntegerLiteral :value 2))))`,
+		},
+	}
+
+	for _, tt := range tests {
+		program, p := programSetup(t, tt.input, 1)
+		checkParserErrors(t, p, 0)
+		stmt := checkExpressionStatement(t, program)
+
+		if got := ast.SExpr(stmt.Expression); got != tt.expected {
+			t.Errorf("wrong tree for `%s`.\nexpected=%s\ngot=     %s", tt.input, tt.expected, got)
+		}
+	}
+}
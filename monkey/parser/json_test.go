@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/internal/corpus"
+)
+
+// testInputs returns the string literals in the given test files that parse
+// without errors, which includes the inputs of their tests.
+func testInputs(t *testing.T, paths ...string) []string {
+	return corpus.Inputs(t, func(input string) bool {
+		program, p := ParseInput(input)
+		return len(p.Errors()) == 0 && len(program.Statements) > 0
+	}, paths...)
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := testInputs(t, "parser_test.go")
+	if len(inputs) < 100 {
+		t.Fatalf("expected at least 100 inputs from parser_test.go. got=%d", len(inputs))
+	}
+
+	for _, input := range inputs {
+		program, _ := ParseInput(input)
+		data, err := json.Marshal(program)
+		if err != nil {
+			t.Errorf("failed to marshal `%s`: %s", input, err)
+			continue
+		}
+
+		var decoded ast.Program
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Errorf("failed to unmarshal `%s`: %s", input, err)
+			continue
+		}
+
+		if decoded.String() != program.String() {
+			t.Errorf("String() changed for `%s`. expected=%q, got=%q", input, program.String(), decoded.String())
+		}
+		if !reflect.DeepEqual(&decoded, program) {
+			t.Errorf("AST changed for `%s`", input)
+		}
+	}
+}
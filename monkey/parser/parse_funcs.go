@@ -81,6 +81,25 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseFunctionParam() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		ident.Type = p.parseType()
+	}
+	return ident
+}
+
+func (p *Parser) parseReturnType() ast.TypeNode {
+	if !p.peekTokenIs(token.ARROW) {
+		return nil
+	}
+	p.nextToken()
+	p.nextToken()
+	return p.parseType()
+}
+
 func (p *Parser) parseFunctionParams() []*ast.Identifier {
 	params := []*ast.Identifier{}
 
@@ -91,13 +110,11 @@ func (p *Parser) parseFunctionParams() []*ast.Identifier {
 
 	p.nextToken()
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	params = append(params, ident)
+	params = append(params, p.parseFunctionParam())
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		params = append(params, ident)
+		params = append(params, p.parseFunctionParam())
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -110,11 +127,21 @@ func (p *Parser) parseFunctionParams() []*ast.Identifier {
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	fn := &ast.FunctionLiteral{Token: p.curToken}
 
+	if p.peekTokenIs(token.ASTERISK) {
+		p.nextToken()
+		fn.IsGenerator = true
+	}
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		fn.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
 	fn.Parameters = p.parseFunctionParams()
+	fn.ReturnType = p.parseReturnType()
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -125,43 +152,120 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return fn
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	macro.Parameters = p.parseFunctionParams()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	macro.Body = p.parseBlockStatement()
+
+	return macro
+}
+
+func (p *Parser) parseYieldExpression() ast.Expression {
+	ye := &ast.YieldExpression{Token: p.curToken}
+
+	switch p.peekToken.Type {
+	case token.SEMICOLON, token.RBRACE, token.RPAREN, token.EOF:
+		return ye
+	}
+
+	p.nextToken()
+	ye.Value = p.parseExpression(LOWEST)
+	return ye
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
-	array.Elements = p.parseExpressionList(token.RBRACKET)
-	return array
-}
 
-func (p *Parser) parseHashPair() (ast.Expression, ast.Expression) {
-	key := p.parseExpression(LOWEST)
-	if !p.expectPeek(token.COLON) {
-		return nil, nil
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		array.Elements = []ast.Expression{}
+		return array
 	}
+
 	p.nextToken()
-	value := p.parseExpression(LOWEST)
-	return key, value
+	first := p.parseListElement()
+	if _, ok := first.(*ast.SpreadElement); !ok && p.peekTokenIs(token.FOR) {
+		comprehension := &ast.ArrayComprehension{Token: array.Token, Element: first}
+		comprehension.Clauses = p.parseComprehensionClauses()
+		if comprehension.Clauses == nil || !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return comprehension
+	}
+
+	array.Elements = p.parseExpressionListFrom(first, token.RBRACKET)
+	return array
 }
 
-func (p *Parser) parseHashPairs() map[ast.Expression]ast.Expression {
-	pairs := map[ast.Expression]ast.Expression{}
+func (p *Parser) parseComprehensionClauses() []*ast.ComprehensionClause {
+	clauses := []*ast.ComprehensionClause{}
+
+	for p.peekTokenIs(token.FOR) {
+		p.nextToken()
+		clause := &ast.ComprehensionClause{Token: p.curToken}
+
+		p.nextToken()
+		// parsed above any infix operator so the pattern stops before `in`
+		clause.Pattern = p.parsePattern(PREFIX)
+		if clause.Pattern == nil || !p.expectPeek(token.IN) {
+			return nil
+		}
 
-	if p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
-		return pairs
+		clause.Iterable = p.parseExpression(LOWEST)
+
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			clause.Condition = p.parseExpression(LOWEST)
+		}
+		clauses = append(clauses, clause)
 	}
 
+	return clauses
+}
+
+// parseHashPair parses an entry of a hash literal, reporting false if it's
+// malformed.
+func (p *Parser) parseHashPair() (ast.HashPair, bool) {
+	if p.curTokenIs(token.ELLIPSIS) {
+		spread := p.parseSpreadElement()
+		return ast.HashPair{Key: spread}, spread.Value != nil
+	}
+
+	key := p.parseExpression(LOWEST)
+	if key == nil || !p.expectPeek(token.COLON) {
+		return ast.HashPair{}, false
+	}
 	p.nextToken()
-	key, value := p.parseHashPair()
-	pairs[key] = value
+	value := p.parseExpression(LOWEST)
+	return ast.HashPair{Key: key, Value: value}, value != nil
+}
+
+// parseHashPairs parses the remaining pairs of a hash literal, after its first.
+func (p *Parser) parseHashPairs(first ast.HashPair) []ast.HashPair {
+	pairs := []ast.HashPair{first}
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		key, value := p.parseHashPair()
-		pairs[key] = value
+		pair, ok := p.parseHashPair()
+		if !ok {
+			return nil
+		}
+		pairs = append(pairs, pair)
 	}
 
 	if !p.expectPeek(token.RBRACE) {
@@ -173,25 +277,68 @@ func (p *Parser) parseHashPairs() map[ast.Expression]ast.Expression {
 
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
-	hash.Pairs = p.parseHashPairs()
+
+	if p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		hash.Pairs = []ast.HashPair{}
+		return hash
+	}
+
+	p.nextToken()
+	first, ok := p.parseHashPair()
+	if !ok {
+		return nil
+	}
+	if first.Value != nil && p.peekTokenIs(token.FOR) {
+		comprehension := &ast.HashComprehension{Token: hash.Token, Key: first.Key, Value: first.Value}
+		comprehension.Clauses = p.parseComprehensionClauses()
+		if comprehension.Clauses == nil || !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		return comprehension
+	}
+
+	hash.Pairs = p.parseHashPairs(first)
+	if hash.Pairs == nil {
+		return nil
+	}
 	return hash
 }
 
-func (p *Parser) parseExpressionList(endToken token.TokenType) []ast.Expression {
-	csv := []ast.Expression{}
+// parseListElement parses an element of an array literal or argument list,
+// which may be spread.
+func (p *Parser) parseListElement() ast.Expression {
+	if p.curTokenIs(token.ELLIPSIS) {
+		return p.parseSpreadElement()
+	}
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseSpreadElement() *ast.SpreadElement {
+	spread := &ast.SpreadElement{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
 
+func (p *Parser) parseExpressionList(endToken token.TokenType) []ast.Expression {
 	if p.peekTokenIs(endToken) {
 		p.nextToken()
-		return csv
+		return []ast.Expression{}
 	}
 
 	p.nextToken()
-	csv = append(csv, p.parseExpression(LOWEST))
+	return p.parseExpressionListFrom(p.parseListElement(), endToken)
+}
+
+// parseExpressionListFrom parses the rest of a list after its first element.
+func (p *Parser) parseExpressionListFrom(first ast.Expression, endToken token.TokenType) []ast.Expression {
+	csv := []ast.Expression{first}
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		csv = append(csv, p.parseExpression(LOWEST))
+		csv = append(csv, p.parseListElement())
 	}
 
 	if !p.expectPeek(endToken) {
@@ -218,6 +365,85 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: object}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return exp
+}
+
+// parseRangeExpression parses start..end and start..<end, with an optional
+// step. `step` is only a keyword in this position.
+func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	exp := &ast.RangeExpression{
+		Token:     p.curToken,
+		Start:     start,
+		Exclusive: p.curTokenIs(token.RANGE_EXC),
+	}
+
+	p.nextToken()
+	exp.End = p.parseExpression(RANGE)
+
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "step" {
+		p.nextToken()
+		p.nextToken()
+		exp.Step = p.parseExpression(RANGE)
+	}
+	return exp
+}
+
+// parseOptionalChain parses a?.b, a?.[i] and f?.(x), which evaluate to null
+// rather than failing when the left side is null.
+func (p *Parser) parseOptionalChain(left ast.Expression) ast.Expression {
+	switch p.peekToken.Type {
+	case token.LBRACKET:
+		p.nextToken()
+		exp, ok := p.parseIndexExpression(left).(*ast.IndexExpression)
+		if !ok {
+			return nil
+		}
+		exp.Optional = true
+		return exp
+	case token.LPAREN:
+		p.nextToken()
+		exp := p.parseCallExpression(left).(*ast.CallExpression)
+		exp.Optional = true
+		return exp
+	default:
+		exp, ok := p.parseMemberExpression(left).(*ast.MemberExpression)
+		if !ok {
+			return nil
+		}
+		exp.Optional = true
+		return exp
+	}
+}
+
+// isAssignTarget reports whether exp can be assigned to. Only members can be,
+// and not through optional chains, since they may not refer to anything.
+func isAssignTarget(exp ast.Expression) bool {
+	member, ok := exp.(*ast.MemberExpression)
+	return ok && !member.Optional
+}
+
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{Token: p.curToken, Target: target}
+
+	if !isAssignTarget(target) {
+		msg := fmt.Sprintf("invalid assignment target: %s", target.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	p.nextToken()
+	// parse with a lower precedence so assignment is right associative
+	exp.Value = p.parseExpression(LOWEST)
+	return exp
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefixFn := p.prefixParseFns[p.curToken.Type]
 	if prefixFn == nil {
@@ -264,13 +490,17 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
+	p.nextToken()
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.curTokenIs(token.IDENT) && (p.peekTokenIs(token.ASSIGN) || p.peekTokenIs(token.COLON)) {
+		stmt.Name = p.parseFunctionParam()
+	} else {
+		stmt.Pattern = p.parsePattern(ASSIGN)
+		if stmt.Pattern == nil {
+			return nil
+		}
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -296,7 +526,328 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
-// func (p *Parser) parseIfStatement() {}
+func (p *Parser) parseStructField() *ast.StructField {
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	field := &ast.StructField{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+
+	if p.peekTokenIs(token.ASSIGN) {
+		p.nextToken()
+		p.nextToken()
+		field.Default = p.parseExpression(LOWEST)
+	}
+	return field
+}
+
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = []*ast.StructField{}
+	for !p.peekTokenIs(token.RBRACE) {
+		field := p.parseStructField()
+		if field == nil {
+			return nil
+		}
+		stmt.Fields = append(stmt.Fields, field)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseClassMethod() *ast.FunctionLiteral {
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	method := &ast.FunctionLiteral{Token: p.curToken}
+	method.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	method.Parameters = p.parseFunctionParams()
+	method.ReturnType = p.parseReturnType()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	method.Body = p.parseBlockStatement()
+
+	return method
+}
+
+func (p *Parser) parseClassStatement() *ast.ClassStatement {
+	stmt := &ast.ClassStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.EXTENDS) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.SuperClass = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Methods = []*ast.FunctionLiteral{}
+	for !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		method := p.parseClassMethod()
+		if method == nil {
+			return nil
+		}
+		stmt.Methods = append(stmt.Methods, method)
+
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parsePattern parses the left-hand side of a destructuring let. Patterns are
+// parsed as expressions and then checked to only contain bindings, literals
+// and enum variants.
+func (p *Parser) parsePattern(precedence int) ast.Expression {
+	errors := len(p.errors)
+	pattern := p.parseExpression(precedence)
+	if pattern == nil || len(p.errors) > errors {
+		// the error that cut the pattern short has been reported already
+		return nil
+	}
+	if !isValidPattern(pattern) {
+		msg := fmt.Sprintf("invalid pattern: %s", pattern.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	return pattern
+}
+
+// isValidPattern reports whether pattern is a valid pattern. Patterns left
+// incomplete by a parse error aren't, so they're rejected before anything
+// looks at their missing parts.
+func isValidPattern(pattern ast.Expression) bool {
+	switch pattern := pattern.(type) {
+	case nil:
+		return false
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.MemberExpression:
+		return isValidPatternPath(pattern)
+	case *ast.ArrayLiteral:
+		for _, elem := range pattern.Elements {
+			if !isValidPattern(elem) {
+				return false
+			}
+		}
+		return true
+	case *ast.CallExpression:
+		if !isValidPatternPath(pattern.Function) {
+			return false
+		}
+		for _, arg := range pattern.Arguments {
+			if !isValidPattern(arg) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// isValidPatternPath reports whether exp names a constructor, like `Point` or
+// `State.Active`.
+func isValidPatternPath(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return true
+	case *ast.MemberExpression:
+		return isValidPatternPath(exp.Object)
+	default:
+		return false
+	}
+}
+
+func (p *Parser) parseEnumVariant() *ast.EnumVariant {
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	variant := &ast.EnumVariant{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		variant.Fields = p.parseFunctionParams()
+		if variant.Fields == nil {
+			return nil
+		}
+	}
+	return variant
+}
+
+func (p *Parser) parseEnumStatement() *ast.EnumStatement {
+	stmt := &ast.EnumStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Variants = []*ast.EnumVariant{}
+	for !p.peekTokenIs(token.RBRACE) {
+		variant := p.parseEnumVariant()
+		if variant == nil {
+			return nil
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseSelectStatement() *ast.SelectStatement {
+	stmt := &ast.SelectStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Cases = []*ast.SelectCase{}
+	for !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+
+		switch p.curToken.Type {
+		case token.CASE:
+			sc := p.parseSelectCase()
+			if sc == nil {
+				return nil
+			}
+			stmt.Cases = append(stmt.Cases, sc)
+		case token.DEFAULT:
+			if stmt.Default != nil {
+				p.errors = append(p.errors, "multiple defaults in select")
+				return nil
+			}
+			if !p.expectPeek(token.LBRACE) {
+				return nil
+			}
+			stmt.Default = p.parseBlockStatement()
+		default:
+			msg := fmt.Sprintf("expected case or default, got %s instead", p.curToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	sc := &ast.SelectCase{Token: p.curToken}
+
+	if p.peekTokenIs(token.LET) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		sc.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.ASSIGN) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+	if exp == nil {
+		return nil
+	}
+
+	op := ""
+	call, ok := exp.(*ast.CallExpression)
+	if ok {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			op = ident.Value
+		}
+	}
+	if op != "send" && op != "recv" {
+		msg := fmt.Sprintf("select case must be a send or recv, got %s", exp)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	if sc.Name != nil && op == "send" {
+		msg := fmt.Sprintf("cannot bind the result of %s", exp)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	sc.Operation = call
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	sc.Body = p.parseBlockStatement()
+	return sc
+}
+
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	se := &ast.SpawnExpression{Token: p.curToken}
+	p.nextToken()
+	se.Call = p.parseExpression(PREFIX)
+	return se
+}
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
@@ -304,7 +855,94 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.CLASS:
+		return p.parseClassStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
+	case token.SELECT:
+		return p.parseSelectStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
+
+func (p *Parser) parseType() ast.TypeNode {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: p.curToken, Name: p.curToken.Literal}
+	case token.LBRACKET:
+		return p.parseArrayType()
+	case token.LBRACE:
+		return p.parseHashType()
+	case token.FUNCTION:
+		return p.parseFunctionType()
+	default:
+		msg := fmt.Sprintf("expected a type, got %s instead", p.curToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+}
+
+func (p *Parser) parseArrayType() ast.TypeNode {
+	arrayType := &ast.ArrayType{Token: p.curToken}
+
+	p.nextToken()
+	arrayType.Element = p.parseType()
+	if arrayType.Element == nil || !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return arrayType
+}
+
+func (p *Parser) parseHashType() ast.TypeNode {
+	hashType := &ast.HashType{Token: p.curToken}
+
+	p.nextToken()
+	hashType.Key = p.parseType()
+	if hashType.Key == nil || !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	p.nextToken()
+	hashType.Value = p.parseType()
+	if hashType.Value == nil || !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return hashType
+}
+
+func (p *Parser) parseFunctionType() ast.TypeNode {
+	fnType := &ast.FunctionType{Token: p.curToken, Parameters: []ast.TypeNode{}}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		param := p.parseType()
+		if param == nil {
+			return nil
+		}
+		fnType.Parameters = append(fnType.Parameters, param)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.ARROW) {
+		fnType.Return = p.parseReturnType()
+		if fnType.Return == nil {
+			return nil
+		}
+	}
+	return fnType
+}
@@ -172,7 +172,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"a * b / c", "((a * b) / c)", 1},
 		{"a + b / c", "(a + (b / c))", 1},
 		{"a + b * c + d / e - f", "(((a + (b * c)) + (d / e)) - f)", 1},
-		{"3 + 4; -5 * 5", "(3 + 4)((-5) * 5)", 2},
+		{"3 + 4; -5 * 5", "(3 + 4);((-5) * 5)", 2},
 		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))", 1},
 		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))", 1},
 		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))", 1},
@@ -194,6 +194,21 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))", 1},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)", 1},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))", 1},
+		{"a.b.c", "((a.b).c)", 1},
+		{"a.b(c)", "(a.b)(c)", 1},
+		{"a.b[1] * c.d", "(((a.b)[1]) * (c.d))", 1},
+		{"-a.b", "(-(a.b))", 1},
+		{"f(x).y", "(f(x).y)", 1},
+		{"a.x = b.y = c", "((a.x) = ((b.y) = c))", 1},
+		{"a.b = 1 + 2", "((a.b) = (1 + 2))", 1},
+		{"a[0].b = b == c", "(((a[0]).b) = (b == c))", 1},
+		{"a?.b?.c", "((a?.b)?.c)", 1},
+		{"a?.[b + 1].c", "((a?.[(b + 1)]).c)", 1},
+		{"f?.(x)?.y", "(f?.(x)?.y)", 1},
+		{"a ?? b ?? c", "((a ?? b) ?? c)", 1},
+		{"a ?? b == c", "(a ?? (b == c))", 1},
+		{"a + b ?? c * d", "((a + b) ?? (c * d))", 1},
+		{"x.y = a?.b ?? c", "((x.y) = ((a?.b) ?? c))", 1},
 	}
 
 	for _, tt := range tests {
@@ -518,8 +533,8 @@ func TestHashLiteral(t *testing.T) {
 			continue
 		}
 
-		for pkey, pvalue := range hashObj.Pairs {
-			checkStringLiteral(t, pvalue, tt.pairs[pkey.String()])
+		for _, pair := range hashObj.Pairs {
+			checkStringLiteral(t, pair.Value, tt.pairs[pair.Key.(*ast.StringLiteral).Value])
 		}
 	}
 }
@@ -551,19 +566,19 @@ func TestHashLiteralsWithExpression(t *testing.T) {
 		},
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
 			continue
 		}
 
-		testFunc, ok := tests[literal.String()]
+		testFunc, ok := tests[literal.Value]
 		if !ok {
-			t.Errorf("No test function for key %q found", literal.String())
+			t.Errorf("No test function for key %q found", literal.Value)
 			continue
 		}
-		testFunc(value)
+		testFunc(pair.Value)
 	}
 }
 
@@ -584,10 +599,601 @@ func TestHashIndexing(t *testing.T) {
 		t.Fatalf("left of IndexExpression not HashLiteral. got=%T", indexExp.Left)
 	}
 
-	for key, value := range hash.Pairs {
-		checkStringLiteral(t, key, "foo")
-		checkIntegerLiteral(t, value, 5)
+	for _, pair := range hash.Pairs {
+		checkStringLiteral(t, pair.Key, "foo")
+		checkIntegerLiteral(t, pair.Value, 5)
 	}
 
 	checkStringLiteral(t, indexExp.Index, "foo")
 }
+
+func TestMemberExpression(t *testing.T) {
+	input := "foo.bar"
+
+	program, parser := programSetup(t, input, 1)
+	checkParserErrors(t, parser, 0)
+
+	stmt := checkExpressionStatement(t, program)
+	memberExp, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MemberExpression. got=%T", stmt.Expression)
+	}
+
+	if !checkIdentifier(t, memberExp.Object, "foo") {
+		return
+	}
+	checkIdentifier(t, memberExp.Property, "bar")
+}
+
+func TestMemberExpressionErrors(t *testing.T) {
+	_, parser := programSetup(t, "foo.5", -1)
+	checkParserErrors(t, parser, 1)
+
+	expected := "expected next token to be IDENT, got INT instead"
+	if parser.Errors()[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, parser.Errors()[0])
+	}
+}
+
+func TestStructStatement(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedFields []string
+		expected       string
+	}{
+		{"struct Empty {};", "Empty", []string{}, "struct Empty {}"},
+		{"struct Point { x, y };", "Point", []string{"x", "y"}, "struct Point { x, y }"},
+		{"struct Point { x, y = 0, }", "Point", []string{"x", "y"}, "struct Point { x, y = 0 }"},
+		{
+			"struct Config { port = 80 + 8000, host = \"localhost\" }",
+			"Config",
+			[]string{"port", "host"},
+			"struct Config { port = (80 + 8000), host = \"localhost\" }",
+		},
+	}
+
+	for _, tt := range tests {
+		program, parser := programSetup(t, tt.input, 1)
+		checkParserErrors(t, parser, 0)
+
+		stmt, ok := program.Statements[0].(*ast.StructStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.StructStatement. got=%T", program.Statements[0])
+		}
+
+		checkIdentifier(t, stmt.Name, tt.expectedName)
+		if len(stmt.Fields) != len(tt.expectedFields) {
+			t.Fatalf("expected %d fields. got=%d", len(tt.expectedFields), len(stmt.Fields))
+		}
+		for idx, field := range tt.expectedFields {
+			checkIdentifier(t, stmt.Fields[idx].Name, field)
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestOptionalChainErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a?.1", "expected next token to be IDENT, got INT instead"},
+		{"a?.[1", "expected next token to be ], got EOF instead"},
+		{"a?.b = 1", "invalid assignment target: (a?.b)"},
+		{"a?.[0] = 1", "invalid assignment target: (a?.[0])"},
+	}
+
+	for _, tt := range tests {
+		_, parser := programSetup(t, tt.input, -1)
+		if len(parser.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if parser.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, parser.Errors()[0])
+		}
+	}
+}
+
+func TestAssignExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 = 3", "invalid assignment target: (1 + 2)"},
+		{"x = 1", "invalid assignment target: x"},
+		{"a[0] = 1", "invalid assignment target: (a[0])"},
+		{"a?.b = 1", "invalid assignment target: (a?.b)"},
+	}
+
+	for _, tt := range tests {
+		_, parser := programSetup(t, tt.input, -1)
+		checkParserErrors(t, parser, 1)
+
+		if parser.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, parser.Errors()[0])
+		}
+	}
+}
+
+func TestClassStatement(t *testing.T) {
+	input := `class Savings extends Account {
+		init(owner, rate) { self.owner = owner; self.rate = rate }
+		interest() { self.balance * self.rate }
+	}`
+
+	program, parser := programSetup(t, input, 1)
+	checkParserErrors(t, parser, 0)
+
+	stmt, ok := program.Statements[0].(*ast.ClassStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ClassStatement. got=%T", program.Statements[0])
+	}
+
+	checkIdentifier(t, stmt.Name, "Savings")
+	checkIdentifier(t, stmt.SuperClass, "Account")
+
+	if len(stmt.Methods) != 2 {
+		t.Fatalf("expected 2 methods. got=%d", len(stmt.Methods))
+	}
+
+	checkIdentifier(t, stmt.Methods[0].Name, "init")
+	if len(stmt.Methods[0].Parameters) != 2 {
+		t.Errorf("expected 2 params for init. got=%d", len(stmt.Methods[0].Parameters))
+	}
+	checkIdentifier(t, stmt.Methods[1].Name, "interest")
+
+	expected := "class Savings extends Account { " +
+		"init(owner, rate) { ((self.owner) = owner);((self.rate) = rate) } " +
+		"interest() { ((self.balance) * (self.rate)) } }"
+	if stmt.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, stmt.String())
+	}
+}
+
+func TestEnumStatement(t *testing.T) {
+	input := "enum State { Pending, Active(since), Closed(reason, at), }"
+
+	program, parser := programSetup(t, input, 1)
+	checkParserErrors(t, parser, 0)
+
+	stmt, ok := program.Statements[0].(*ast.EnumStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.EnumStatement. got=%T", program.Statements[0])
+	}
+	checkIdentifier(t, stmt.Name, "State")
+
+	expected := []struct {
+		name   string
+		fields []string
+	}{
+		{"Pending", nil},
+		{"Active", []string{"since"}},
+		{"Closed", []string{"reason", "at"}},
+	}
+	if len(stmt.Variants) != len(expected) {
+		t.Fatalf("expected %d variants. got=%d", len(expected), len(stmt.Variants))
+	}
+	for idx, variant := range expected {
+		checkIdentifier(t, stmt.Variants[idx].Name, variant.name)
+		if len(stmt.Variants[idx].Fields) != len(variant.fields) {
+			t.Errorf("variant %s expected %d fields. got=%d",
+				variant.name, len(variant.fields), len(stmt.Variants[idx].Fields))
+			continue
+		}
+		for fieldIdx, field := range variant.fields {
+			checkIdentifier(t, stmt.Variants[idx].Fields[fieldIdx], field)
+		}
+	}
+
+	expectedStr := "enum State { Pending, Active(since), Closed(reason, at) }"
+	if stmt.String() != expectedStr {
+		t.Errorf("expected=%q, got=%q", expectedStr, stmt.String())
+	}
+}
+
+func TestLetPatterns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = x;", "let [a, b] = x;"},
+		{"let [a, [b, _]] = x;", "let [a, [b, _]] = x;"},
+		{"let State.Active(since) = x;", "let (State.Active)(since) = x;"},
+		{"let Point(x, 0) = p;", "let Point(x, 0) = p;"},
+		{"let State.Pending = x;", "let (State.Pending) = x;"},
+	}
+
+	for _, tt := range tests {
+		program, parser := programSetup(t, tt.input, 1)
+		checkParserErrors(t, parser, 0)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Pattern == nil {
+			t.Errorf("stmt.Pattern is nil for %q", tt.input)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestLetPatternErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a + b = x;", "invalid pattern: (a + b)"},
+		{"let [f(x)()] = x;", "invalid pattern: [f(x)()]"},
+		{"let x;", "expected next token to be =, got ; instead"},
+		{"let {a, b} = h; a", "expected next token to be :, got , instead"},
+		{"let {a: 1, b} = h; a", "expected next token to be :, got } instead"},
+		{"let [a, )] = x; a", "no prefix parse function for ) found"},
+		{"let State.Active(, x) = s; x", "no prefix parse function for , found"},
+	}
+
+	for _, tt := range tests {
+		_, parser := programSetup(t, tt.input, -1)
+		if len(parser.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if parser.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, parser.Errors()[0])
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let xs: [string] = [];", "let xs: [string] = [];"},
+		{"let h: {string: [int]} = {};", "let h: {string: [int]} = {};"},
+		{"let f: fn(int, bool) -> string = g;", "let f: fn(int, bool) -> string = g;"},
+		{"let f: fn() -> fn(int) -> int = g;", "let f: fn() -> fn(int) -> int = g;"},
+		{"fn(a: int, b) -> bool { a }", "fn(a: int, b) -> bool { a }"},
+		{"fn(a, b: Point) { a }", "fn(a, b: Point) { a }"},
+		{"fn() -> [int] { [] }", "fn() -> [int] { [] }"},
+	}
+
+	for _, tt := range tests {
+		program, parser := programSetup(t, tt.input, 1)
+		checkParserErrors(t, parser, 0)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: = 5;", "expected a type, got = instead"},
+		{"let x: [int = 5;", "expected next token to be ], got = instead"},
+		{"fn(a: 5) { a }", "expected a type, got INT instead"},
+		{"fn(a) -> 5 { a }", "expected a type, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		_, parser := programSetup(t, tt.input, -1)
+		if len(parser.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if parser.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, parser.Errors()[0])
+		}
+	}
+}
+
+func TestGeneratorFunctions(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		name        string
+		isGenerator bool
+	}{
+		{"fn*(n) { yield n; }", "fn*(n) { (yield n) }", "", true},
+		{"fn* count(n) { yield n + 1 }", "fn* count(n) { (yield (n + 1)) }", "count", true},
+		{"fn add(a, b) { a + b }", "fn add(a, b) { (a + b) }", "add", false},
+		{"fn*() { yield; yield }", "fn*() { yield;yield }", "", true},
+		{"fn*() { f(yield) }", "fn*() { f(yield) }", "", true},
+	}
+
+	for _, tt := range tests {
+		program, parser := programSetup(t, tt.input, 1)
+		checkParserErrors(t, parser, 0)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		fn, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression not *ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+		if fn.IsGenerator != tt.isGenerator {
+			t.Errorf("fn.IsGenerator wrong for %q. got=%t", tt.input, fn.IsGenerator)
+		}
+		if (fn.Name == nil && tt.name != "") || (fn.Name != nil && fn.Name.Value != tt.name) {
+			t.Errorf("fn.Name wrong for %q. expected=%q, got=%v", tt.input, tt.name, fn.Name)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestSpawnExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"spawn fn() { x }", "(spawn fn() { x })"},
+		{"spawn worker(1, 2)", "(spawn worker(1, 2))"},
+		{"let t = spawn f;", "let t = (spawn f);"},
+		{"(spawn f()).wait()", "((spawn f()).wait)()"},
+	}
+
+	for _, tt := range tests {
+		program, parser := programSetup(t, tt.input, 1)
+		checkParserErrors(t, parser, 0)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestSelectStatement(t *testing.T) {
+	input := `select {
+		case let v = recv(a) { v }
+		case send(b, 1 + 2) { 1 }
+		case recv(c) { }
+		default { 0 }
+	}`
+
+	program, parser := programSetup(t, input, 1)
+	checkParserErrors(t, parser, 0)
+
+	stmt, ok := program.Statements[0].(*ast.SelectStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.SelectStatement. got=%T", program.Statements[0])
+	}
+	if len(stmt.Cases) != 3 {
+		t.Fatalf("wrong number of cases. expected=3, got=%d", len(stmt.Cases))
+	}
+	if stmt.Cases[0].Name == nil || stmt.Cases[0].Name.Value != "v" {
+		t.Errorf("stmt.Cases[0].Name wrong. got=%v", stmt.Cases[0].Name)
+	}
+	if stmt.Cases[1].Name != nil {
+		t.Errorf("stmt.Cases[1].Name not nil. got=%v", stmt.Cases[1].Name)
+	}
+	if stmt.Default == nil {
+		t.Fatalf("stmt.Default is nil")
+	}
+
+	expected := "select { case let v = recv(a) { v } case send(b, (1 + 2)) { 1 } case recv(c) {} default { 0 } }"
+	if stmt.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, stmt.String())
+	}
+}
+
+func TestSelectStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"select { case f(a) { 1 } }", "select case must be a send or recv, got f(a)"},
+		{"select { case recv { 1 } }", "select case must be a send or recv, got recv"},
+		{"select { case let v = send(a, 1) { 1 } }", "cannot bind the result of send(a, 1)"},
+		{"select { default { 1 } default { 2 } }", "multiple defaults in select"},
+		{"select { recv(a) { 1 } }", "expected case or default, got IDENT instead"},
+		{"select { case let 1 = recv(a) { 1 } }", "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		_, parser := programSetup(t, tt.input, -1)
+		if len(parser.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if parser.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, parser.Errors()[0])
+		}
+	}
+}
+
+func TestSpreadElements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[...a, x, ...b]", "[...a, x, ...b]"},
+		{"[...a.b, ...f(x)]", "[...(a.b), ...f(x)]"},
+		{"f(...args)", "f(...args)"},
+		{"f(a, ...[b, c])", "f(a, ...[b, c])"},
+		{`{...defaults, "port": 8080}`, `{...defaults, "port": 8080}`},
+		{`{"a": 1, ...x, "a": 2, ...y}`, `{"a": 1, ...x, "a": 2, ...y}`},
+	}
+
+	for _, tt := range tests {
+		program, parser := programSetup(t, tt.input, 1)
+		checkParserErrors(t, parser, 0)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestSpreadElementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"...a", "no prefix parse function for ... found"},
+		{"[...]", "no prefix parse function for ] found"},
+		{"let [a, ...b] = x;", "invalid pattern: [a, ...b]"},
+		{"{...a: 1}", "expected next token to be }, got : instead"},
+	}
+
+	for _, tt := range tests {
+		_, parser := programSetup(t, tt.input, -1)
+		if len(parser.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if parser.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, parser.Errors()[0])
+		}
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[x * 2 for x in xs if x > 0]", "[(x * 2) for x in xs if (x > 0)]"},
+		{"[x for x in [1, 2]]", "[x for x in [1, 2]]"},
+		{"[[x, y] for x in xs for y in ys if x != y]", "[[x, y] for x in xs for y in ys if (x != y)]"},
+		{"[x for x in xs if x > 0 for y in f(x) if y]", "[x for x in xs if (x > 0) for y in f(x) if y]"},
+		{"[a + b for [a, b] in pairs]", "[(a + b) for [a, b] in pairs]"},
+		{"[s for State.Active(s) in states]", "[s for (State.Active)(s) in states]"},
+		{"{k: v for [k, v] in pairs}", "{k: v for [k, v] in pairs}"},
+		{"{x: x * x for x in xs if x}", "{x: (x * x) for x in xs if x}"},
+		{"[[y for y in x] for x in xss]", "[[y for y in x] for x in xss]"},
+	}
+
+	for _, tt := range tests {
+		program, parser := programSetup(t, tt.input, 1)
+		checkParserErrors(t, parser, 0)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestComprehensionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[x for x xs]", "expected next token to be IN, got IDENT instead"},
+		{"[x for x + 1 in xs]", "expected next token to be IN, got + instead"},
+		{"[x for f(x)() in xs]", "invalid pattern: f(x)()"},
+		{"[x for x in xs", "expected next token to be ], got EOF instead"},
+		{"[x for x in xs, y]", "expected next token to be ], got , instead"},
+		{"[...x for x in xs]", "expected next token to be ], got FOR instead"},
+		{"{...x for x in xs}", "expected next token to be }, got FOR instead"},
+		{"{k: v for k in ks, 1: 2}", "expected next token to be }, got , instead"},
+	}
+
+	for _, tt := range tests {
+		_, parser := programSetup(t, tt.input, -1)
+		if len(parser.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if parser.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, parser.Errors()[0])
+		}
+	}
+}
+
+func TestRangeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1..10", "(1..10)"},
+		{"0..<n", "(0..<n)"},
+		{"1..n + 1", "(1..(n + 1))"},
+		{"a * 2..<b - 1", "((a * 2)..<(b - 1))"},
+		{"0..100 step 5", "(0..100 step 5)"},
+		{"10..0 step -1 + x", "(10..0 step ((-1) + x))"},
+		{"1..3 == r", "((1..3) == r)"},
+		{"x in 1..10", "(x in (1..10))"},
+		{"!(x in xs)", "(!(x in xs))"},
+		{"(1..10)[2]", "((1..10)[2])"},
+		{"let step = 2; 0..10 step step", "let step = 2;(0..10 step step)"},
+		{"[x for x in 0..<n if x in ys]", "[x for x in (0..<n) if (x in ys)]"},
+	}
+
+	for _, tt := range tests {
+		program, parser := programSetup(t, tt.input, -1)
+		checkParserErrors(t, parser, 0)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestRangeExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1..", "no prefix parse function for EOF found"},
+		{"1..10 step", "no prefix parse function for EOF found"},
+		{"1..<", "no prefix parse function for EOF found"},
+	}
+
+	for _, tt := range tests {
+		_, parser := programSetup(t, tt.input, -1)
+		if len(parser.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if parser.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, parser.Errors()[0])
+		}
+	}
+}
+
+func TestMacroLiteral(t *testing.T) {
+	input := "macro(x, y) { x + y; }"
+
+	program, parser := programSetup(t, input, 1)
+	checkParserErrors(t, parser, 0)
+
+	stmt := checkExpressionStatement(t, program)
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not a ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro expected 2 params. got=%d", len(macro.Parameters))
+	}
+
+	checkLiteralExpression(t, macro.Parameters[0], "x")
+	checkLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements expects 1 statement. got=%d", len(macro.Body.Statements))
+	}
+
+	body, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro.Body.Statements[0] is not ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+	}
+	checkInfixExpression(t, body.Expression, "x", "y", "+")
+
+	if macro.String() != "macro(x, y) { (x + y) }" {
+		t.Errorf("macro.String() wrong. got=%q", macro.String())
+	}
+}
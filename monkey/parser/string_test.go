@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+)
+
+func TestStringRoundTrip(t *testing.T) {
+	inputs := testInputs(t, "parser_test.go", "../evaluator/evaluator_test.go")
+	if len(inputs) < 200 {
+		t.Fatalf("expected at least 200 inputs. got=%d", len(inputs))
+	}
+
+	for _, input := range inputs {
+		program, _ := ParseInput(input)
+		output := program.String()
+
+		reparsed, p := ParseInput(output)
+		if len(p.Errors()) != 0 {
+			t.Errorf("String() of `%s` doesn't parse: %q\n%s", input, output, strings.Join(p.Errors(), "\n"))
+			continue
+		}
+		// the reparsed tree must be the same as the original, apart from
+		// tokens, which SExpr leaves out
+		if expected, got := ast.SExpr(program), ast.SExpr(reparsed); got != expected {
+			t.Errorf("String() of `%s` isn't the same program: %q\nexpected=%s\ngot=     %s", input, output, expected, got)
+		}
+	}
+}
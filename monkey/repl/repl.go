@@ -5,18 +5,21 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/jamestrew/go-interpreter/monkey/ast"
 	"github.com/jamestrew/go-interpreter/monkey/evaluator"
 	"github.com/jamestrew/go-interpreter/monkey/interpreter"
 	"github.com/jamestrew/go-interpreter/monkey/object"
+	"github.com/jamestrew/go-interpreter/monkey/optimize"
 	"github.com/jamestrew/go-interpreter/monkey/parser"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
+// Start runs the lines read from in, printing their results. Macros are
+// expanded with macroOpts.
+func Start(in io.Reader, out io.Writer, eval interpreter.Engine, macroOpts ...evaluator.Option) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	eval := evaluator.New(env)
+	macroEnv := object.NewEnvironment()
 
 	for {
 		fmt.Printf(PROMPT)
@@ -31,7 +34,16 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		evaluated := eval.Eval(program)
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv, macroOpts...)
+		if err != nil {
+			io.WriteString(out, err.Inspect())
+			io.WriteString(out, "\n")
+			continue
+		}
+
+		optimize.Program(expanded.(*ast.Program))
+		evaluated := eval.Eval(expanded)
 		if evaluated != nil && evaluated.Type() != object.FUNCTION_OBJ {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
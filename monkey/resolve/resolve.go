@@ -0,0 +1,262 @@
+// Package resolve works out where the local variables of a program are stored,
+// so the evaluator can find them by position instead of searching its scopes by
+// name.
+package resolve
+
+import "github.com/jamestrew/go-interpreter/monkey/ast"
+
+// Program sets the Local of each identifier in program that names a local
+// variable: the slot it's stored in, and how many scopes out from the
+// identifier that slot is. Globals are left to be looked up by name.
+//
+// The scopes are the environments the evaluator makes when blocks have their
+// own scope: one for each block, function call, comprehension and select case
+// that receives into a name, and one for the default of each struct field. A
+// function body can use the variables its enclosing scopes declare after it,
+// since it only looks them up once it's called.
+//
+// Programs should be resolved after their macros are expanded. The identifiers
+// in quoted code are left alone, apart from those in the arguments of unquote.
+func Program(program *ast.Program) {
+	r := &resolver{}
+	r.statements(&scope{global: true}, program.Statements)
+
+	for len(r.pending) > 0 {
+		next := r.pending[0]
+		r.pending = r.pending[1:]
+		next()
+	}
+}
+
+// byName is the slot of a name that's bound by name in a local scope, like the
+// self of a method.
+const byName = -1
+
+type scope struct {
+	outer  *scope
+	global bool
+	names  map[string]int // the slot of each name declared in the scope
+	slots  int
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, names: map[string]int{}}
+}
+
+// declare binds ident in s, in the slot of an earlier declaration of the same
+// name if there is one.
+func (s *scope) declare(ident *ast.Identifier) {
+	ident.Local = nil
+	if s.global {
+		return
+	}
+
+	slot, ok := s.names[ident.Value]
+	if !ok {
+		slot = s.slots
+		s.names[ident.Value] = slot
+		s.slots++
+	}
+	if slot != byName {
+		ident.Local = &ast.Local{Slot: slot}
+	}
+}
+
+// lookup resolves ident to the nearest declaration of its name.
+func (s *scope) lookup(ident *ast.Identifier) {
+	ident.Local = nil
+	for depth := 0; !s.global; depth++ {
+		if slot, ok := s.names[ident.Value]; ok {
+			if slot != byName {
+				ident.Local = &ast.Local{Depth: depth, Slot: slot}
+			}
+			return
+		}
+		s = s.outer
+	}
+}
+
+type resolver struct {
+	// pending resolves the function bodies and struct defaults found so far,
+	// once the scopes they're in are complete
+	pending []func()
+}
+
+func (r *resolver) later(resolve func()) {
+	r.pending = append(r.pending, resolve)
+}
+
+func (r *resolver) statements(s *scope, stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		r.node(s, stmt)
+	}
+}
+
+func (r *resolver) node(s *scope, node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		return r.visit(s, node)
+	})
+}
+
+// visit resolves node in s, reporting whether its children are left to
+// resolve in s as well.
+func (r *resolver) visit(s *scope, node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		s.lookup(node)
+	case *ast.LetStatement:
+		r.node(s, node.Value)
+		if node.Pattern != nil {
+			r.pattern(s, node.Pattern)
+		} else {
+			s.declare(node.Name)
+		}
+	case *ast.BlockStatement:
+		r.statements(newScope(s), node.Statements)
+	case *ast.FunctionLiteral:
+		if node.Name != nil {
+			s.declare(node.Name)
+		}
+		r.function(newScope(s), node)
+	case *ast.MacroLiteral:
+		// macros are expanded before programs are resolved
+	case *ast.ClassStatement:
+		r.class(s, node)
+	case *ast.StructStatement:
+		for _, field := range node.Fields {
+			if field.Default != nil {
+				def := field.Default
+				r.later(func() { r.node(newScope(s), def) })
+			}
+		}
+		s.declare(node.Name)
+	case *ast.EnumStatement:
+		s.declare(node.Name)
+	case *ast.SelectStatement:
+		r.selectStatement(s, node)
+	case *ast.ArrayComprehension:
+		body := r.clauses(s, node.Clauses)
+		r.node(body, node.Element)
+	case *ast.HashComprehension:
+		body := r.clauses(s, node.Clauses)
+		r.node(body, node.Key)
+		r.node(body, node.Value)
+	case *ast.MemberExpression:
+		// the property is a name, not a variable
+		r.node(s, node.Object)
+	case *ast.CallExpression:
+		if !isCallTo(node, "quote") {
+			return true
+		}
+		r.unquotes(s, node)
+	default:
+		return true
+	}
+	return false
+}
+
+// function resolves the parameters and body of fn in call, the scope of a call
+// to it, once the scopes enclosing call are complete.
+func (r *resolver) function(call *scope, fn *ast.FunctionLiteral) {
+	r.later(func() {
+		for _, param := range fn.Parameters {
+			call.declare(param)
+		}
+		r.statements(call, fn.Body.Statements)
+	})
+}
+
+func (r *resolver) class(s *scope, cs *ast.ClassStatement) {
+	if cs.SuperClass != nil {
+		s.lookup(cs.SuperClass)
+	}
+	for _, method := range cs.Methods {
+		// self and super are bound by name when a method is called
+		call := newScope(s)
+		call.names["self"] = byName
+		if cs.SuperClass != nil {
+			call.names["super"] = byName
+		}
+		r.function(call, method)
+	}
+	s.declare(cs.Name)
+}
+
+func (r *resolver) selectStatement(s *scope, ss *ast.SelectStatement) {
+	for _, sc := range ss.Cases {
+		// the operation is named by its function, which isn't looked up
+		for _, arg := range sc.Operation.Arguments {
+			r.node(s, arg)
+		}
+		if sc.Name == nil {
+			r.node(s, sc.Body)
+			continue
+		}
+		body := newScope(s)
+		body.declare(sc.Name)
+		r.statements(body, sc.Body.Statements)
+	}
+	if ss.Default != nil {
+		r.node(s, ss.Default)
+	}
+}
+
+// clauses resolves the clauses of a comprehension, returning the scope of its
+// body.
+func (r *resolver) clauses(s *scope, clauses []*ast.ComprehensionClause) *scope {
+	body := newScope(s)
+	for _, clause := range clauses {
+		r.node(body, clause.Iterable)
+		r.pattern(body, clause.Pattern)
+		if clause.Condition != nil {
+			r.node(body, clause.Condition)
+		}
+	}
+	return body
+}
+
+// pattern declares the identifiers a destructuring pattern binds, and resolves
+// the constructors and values it matches against.
+func (r *resolver) pattern(s *scope, pattern ast.Expression) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value == "_" {
+			pattern.Local = nil
+			return
+		}
+		s.declare(pattern)
+	case *ast.ArrayLiteral:
+		for _, elem := range pattern.Elements {
+			r.pattern(s, elem)
+		}
+	case *ast.CallExpression:
+		r.node(s, pattern.Function)
+		for _, arg := range pattern.Arguments {
+			r.pattern(s, arg)
+		}
+	default:
+		r.node(s, pattern)
+	}
+}
+
+// unquotes resolves the arguments of the calls to unquote in a quote, which
+// are evaluated where the quote is.
+func (r *resolver) unquotes(s *scope, quote *ast.CallExpression) {
+	for _, arg := range quote.Arguments {
+		ast.Inspect(arg, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpression)
+			if !ok || !isCallTo(call, "unquote") {
+				return true
+			}
+			for _, arg := range call.Arguments {
+				r.node(s, arg)
+			}
+			return false
+		})
+	}
+}
+
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
@@ -0,0 +1,70 @@
+package resolve
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/parser"
+)
+
+// locals lists the identifiers of node in order, with the depth and slot of
+// those that were resolved, like "x@1:0".
+func locals(node ast.Node) string {
+	idents := []string{}
+	ast.Inspect(node, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			if ident.Local == nil {
+				idents = append(idents, ident.Value)
+			} else {
+				idents = append(idents, fmt.Sprintf("%s@%d:%d", ident.Value, ident.Local.Depth, ident.Local.Slot))
+			}
+		}
+		return true
+	})
+	return strings.Join(idents, " ")
+}
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; x", "x x"},
+		{"let f = fn(a, b) { a + b }", "f a@0:0 b@0:1 a@0:0 b@0:1"},
+		{"fn(x) { let y = x; y }", "x@0:0 y@0:1 x@0:0 y@0:1"},
+		{"fn(x) { let x = x + 1; x }", "x@0:0 x@0:0 x@0:0 x@0:0"},
+		{"fn(x) { fn() { x } }", "x@0:0 x@1:0"},
+		{"fn(x) { if (x) { let y = 1; y } else { x } }", "x@0:0 x@0:0 y@0:0 y@0:0 x@1:0"},
+		{"let x = 1; fn() { x; len }", "x x len"},
+		{"fn() { let f = fn() { g() }; let g = fn() { 1 } }", "f@0:0 g@1:1 g@0:1"},
+		{"fn() { let fact = fn(n) { fact(n - 1) } }", "fact@0:0 n@0:0 fact@1:0 n@0:0"},
+		{"fn() { fn f() { 1 }; f() }", "f@0:0 f@0:0"},
+		{"fn(xs) { let [a, _, b] = xs; a + b }", "xs@0:0 a@0:1 _ b@0:2 xs@0:0 a@0:1 b@0:2"},
+		{"fn(v) { let Some(x) = v; x }", "v@0:0 Some x@0:1 v@0:0 x@0:1"},
+		{"fn(xs) { [x * 2 for x in xs if x > 0] }", "xs@0:0 x@0:0 x@0:0 xs@1:0 x@0:0"},
+		{"fn(h) { h.x + h[\"y\"] }", "h@0:0 h@0:0 x h@0:0"},
+		{"fn(x) { x.y = x }", "x@0:0 x@0:0 y x@0:0"},
+		{"fn() { struct P { x = y }; let y = 1 }", "P@0:0 x y@1:1 y@0:1"},
+		{"fn() { enum E { A(x) }; E.A }", "E@0:0 A x E@0:0 A"},
+		{
+			"fn(base) { class A extends base { init(x) { self.x = x; super.init() } } }",
+			"base@0:0 A@0:1 base@0:0 init x@0:0 self x x@0:0 super init",
+		},
+		{"fn(ch) { select { case let v = recv(ch) { v } } }", "ch@0:0 v@0:0 recv ch@0:0 v@0:0"},
+		{"fn(x) { quote(x + unquote(x)) }", "x@0:0 quote x unquote x@0:0"},
+	}
+
+	for _, tt := range tests {
+		program, p := parser.ParseInput(tt.input)
+		if len(p.Errors()) != 0 {
+			t.Fatalf("failed to parse `%s`: %v", tt.input, p.Errors())
+		}
+
+		Program(program)
+		if got := locals(program); got != tt.expected {
+			t.Errorf("wrong locals for `%s`.\nexpected=%s\ngot=     %s", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -5,10 +5,12 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int
+	Column  int
 }
 
 func New(tokenType TokenType, ch byte) Token {
-	return Token{tokenType, string(ch)}
+	return Token{Type: tokenType, Literal: string(ch)}
 }
 
 func KeywordOrIdent(literal string) TokenType {
@@ -27,6 +29,30 @@ func KeywordOrIdent(literal string) TokenType {
 		return IF
 	case "else":
 		return ELSE
+	case "struct":
+		return STRUCT
+	case "class":
+		return CLASS
+	case "extends":
+		return EXTENDS
+	case "enum":
+		return ENUM
+	case "yield":
+		return YIELD
+	case "spawn":
+		return SPAWN
+	case "select":
+		return SELECT
+	case "case":
+		return CASE
+	case "default":
+		return DEFAULT
+	case "for":
+		return FOR
+	case "in":
+		return IN
+	case "macro":
+		return MACRO
 
 	default:
 		return IDENT
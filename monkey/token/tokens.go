@@ -3,6 +3,7 @@ package token
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 
 	IDENT  = "IDENT"
 	INT    = "INT"
@@ -26,6 +27,14 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."
+	ELLIPSIS  = "..."
+	RANGE     = ".."
+	RANGE_EXC = "..<"
+	ARROW     = "->"
+
+	QUESTION_DOT = "?."
+	NULLISH      = "??"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -42,4 +51,16 @@ const (
 	RETURN   = "RETURN"
 	IF       = "IF"
 	ELSE     = "ELSE"
+	STRUCT   = "STRUCT"
+	CLASS    = "CLASS"
+	EXTENDS  = "EXTENDS"
+	ENUM     = "ENUM"
+	YIELD    = "YIELD"
+	SPAWN    = "SPAWN"
+	SELECT   = "SELECT"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
+	FOR      = "FOR"
+	IN       = "IN"
+	MACRO    = "MACRO"
 )
@@ -0,0 +1,93 @@
+package typecheck
+
+import "fmt"
+
+// builtin checks a call to a builtin function, returning the type of the call
+// and an error message if the arguments are invalid.
+type builtin func(args []Type) (Type, string)
+
+var builtins = map[string]builtin{
+	"len": func(args []Type) (Type, string) {
+		if len(args) != 1 {
+			return Int, wrongArgCount(1, len(args))
+		}
+		switch args[0].(type) {
+		case *Array, *Hash:
+			return Int, ""
+		}
+		if args[0] == String || args[0] == Range || args[0] == Any {
+			return Int, ""
+		}
+		return Int, fmt.Sprintf("argument to `len` not supported, got %s", args[0])
+	},
+	"print": func(args []Type) (Type, string) {
+		return Null, ""
+	},
+	"first": elementBuiltin("first"),
+	"last":  elementBuiltin("last"),
+	"arrayPush": func(args []Type) (Type, string) {
+		if len(args) != 2 {
+			return Any, wrongArgCount(2, len(args))
+		}
+		if arr, ok := args[0].(*Array); ok {
+			return &Array{Element: join(arr.Element, args[1])}, ""
+		}
+		if args[0] == Any {
+			return &Array{Element: Any}, ""
+		}
+		return Any, fmt.Sprintf("argument to `arrayPush` not supported, got %s", args[0])
+	},
+	"take":     fixedBuiltin(2, Any),
+	"map_lazy": fixedBuiltin(2, Any),
+	"collect":  fixedBuiltin(1, &Array{Element: Any}),
+	"send":     fixedBuiltin(2, Null),
+	"recv":     fixedBuiltin(1, Any),
+	"close":    fixedBuiltin(1, Null),
+	"channel": func(args []Type) (Type, string) {
+		if len(args) > 1 {
+			return Any, wrongArgCount(1, len(args))
+		}
+		return Any, ""
+	},
+	"zip": func(args []Type) (Type, string) {
+		if len(args) < 2 {
+			return Any, wrongArgCount(2, len(args))
+		}
+		return Any, ""
+	},
+	"type": func(args []Type) (Type, string) {
+		if len(args) != 1 {
+			return String, wrongArgCount(1, len(args))
+		}
+		return String, ""
+	},
+}
+
+// fixedBuiltin only checks the number of arguments.
+func fixedBuiltin(want int, result Type) builtin {
+	return func(args []Type) (Type, string) {
+		if len(args) != want {
+			return result, wrongArgCount(want, len(args))
+		}
+		return result, ""
+	}
+}
+
+func elementBuiltin(name string) builtin {
+	return func(args []Type) (Type, string) {
+		if len(args) != 1 {
+			return Any, wrongArgCount(1, len(args))
+		}
+		if arr, ok := args[0].(*Array); ok {
+			return arr.Element, ""
+		}
+		if args[0] == String || args[0] == Any {
+			return args[0], ""
+		}
+		return Any, fmt.Sprintf("argument to `%s` not supported, got %s", name, args[0])
+	}
+}
+
+func wrongArgCount(want, got int) string {
+	return fmt.Sprintf("wrong number of arguments. got=%d, want=%d", got, want)
+}
@@ -0,0 +1,843 @@
+// Package typecheck statically checks Monkey programs using the optional type
+// annotations on let bindings and functions, along with types inferred from
+// literals and operators. Code without annotations is only checked where the
+// types involved are known, so unannotated programs stay valid.
+//
+// An inferred type is only trusted while it can't change. The elements of the
+// arrays and hashes held by bindings without an annotation are any, since they
+// change in place.
+package typecheck
+
+import (
+	"fmt"
+
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/token"
+)
+
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+type binding struct {
+	typ       Type
+	annotated bool
+}
+
+type scope struct {
+	bindings map[string]*binding
+	outer    *scope
+}
+
+func (s *scope) lookup(name string) *binding {
+	for sc := s; sc != nil; sc = sc.outer {
+		if b, ok := sc.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// function tracks the declared return type of the function being checked,
+// along with the types it's been seen returning. The return type of a
+// generator is the type of the values it yields.
+type function struct {
+	returnType Type
+	returns    Type
+	generator  bool
+}
+
+type checker struct {
+	scope  *scope
+	fn     *function
+	errors []*Error
+
+	named map[string]bool // the names of the structs, classes and enums
+}
+
+// Check reports the type errors found in program.
+func Check(program *ast.Program) []*Error {
+	c := &checker{
+		scope: &scope{bindings: map[string]*binding{}},
+		named: map[string]bool{},
+	}
+	c.collect(program)
+	c.checkStatements(program.Statements)
+	return c.errors
+}
+
+// collect finds the types declared in program, which type annotations can refer
+// to before their declaration.
+func (c *checker) collect(program *ast.Program) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.StructStatement:
+			c.named[node.Name.Value] = true
+		case *ast.ClassStatement:
+			c.named[node.Name.Value] = true
+		case *ast.EnumStatement:
+			c.named[node.Name.Value] = true
+		}
+		return true
+	})
+}
+
+func (c *checker) errorf(tok token.Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, &Error{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func (c *checker) pushScope() {
+	c.scope = &scope{bindings: map[string]*binding{}, outer: c.scope}
+}
+
+func (c *checker) popScope() {
+	c.scope = c.scope.outer
+}
+
+// declare binds name to a value of type typ. Unless the type is annotated, it's
+// loosened to what stays true of the value for as long as it's bound.
+func (c *checker) declare(name string, typ Type, annotated bool) {
+	if !annotated {
+		typ = loosen(typ)
+	}
+	c.scope.bindings[name] = &binding{typ: typ, annotated: annotated}
+}
+
+func loosen(typ Type) Type {
+	switch typ.(type) {
+	case *Array:
+		return &Array{Element: Any}
+	case *Hash:
+		return &Hash{Key: Any, Value: Any}
+	default:
+		return typ
+	}
+}
+
+func (c *checker) resolve(node ast.TypeNode) Type {
+	switch node := node.(type) {
+	case *ast.NamedType:
+		switch node.Name {
+		case "int":
+			return Int
+		case "string":
+			return String
+		case "bool":
+			return Bool
+		case "null":
+			return Null
+		case "range":
+			return Range
+		case "any":
+			return Any
+		}
+		if !c.named[node.Name] {
+			c.errorf(node.Token, "unknown type: %s", node.Name)
+			return Any
+		}
+		return &Named{Name: node.Name}
+	case *ast.ArrayType:
+		return &Array{Element: c.resolve(node.Element)}
+	case *ast.HashType:
+		return &Hash{Key: c.resolve(node.Key), Value: c.resolve(node.Value)}
+	case *ast.FunctionType:
+		fn := &Function{Params: []Type{}, Return: c.resolve(node.Return)}
+		for _, param := range node.Parameters {
+			fn.Params = append(fn.Params, c.resolve(param))
+		}
+		return fn
+	default:
+		return Any
+	}
+}
+
+// checkStatements checks a list of statements, returning the type of the value
+// the list evaluates to, or nil if it always returns before the end.
+func (c *checker) checkStatements(statements []ast.Statement) Type {
+	var result Type = Null
+	for _, stmt := range statements {
+		result = c.checkStatement(stmt)
+	}
+	return result
+}
+
+func (c *checker) checkBlock(block *ast.BlockStatement) Type {
+	if block == nil {
+		return Null
+	}
+	c.pushScope()
+	defer c.popScope()
+	return c.checkStatements(block.Statements)
+}
+
+func (c *checker) checkStatement(stmt ast.Statement) Type {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return c.checkLetStatement(stmt)
+	case *ast.ReturnStatement:
+		c.checkReturn(stmt.Token, c.expectReturn(stmt.Value))
+		return nil
+	case *ast.ExpressionStatement:
+		return c.value(stmt.Expression)
+	case *ast.BlockStatement:
+		return c.checkBlock(stmt)
+	case *ast.StructStatement:
+		return c.checkStructStatement(stmt)
+	case *ast.ClassStatement:
+		return c.checkClassStatement(stmt)
+	case *ast.EnumStatement:
+		c.declare(stmt.Name.Value, Any, false)
+		return Any
+	case *ast.SelectStatement:
+		return c.checkSelectStatement(stmt)
+	default:
+		return Any
+	}
+}
+
+func (c *checker) checkLetStatement(ls *ast.LetStatement) Type {
+	if ls.Pattern != nil {
+		valueType := c.infer(ls.Value)
+		c.declarePattern(ls.Pattern)
+		return valueType
+	}
+
+	if ls.Name.Type == nil {
+		valueType := c.infer(ls.Value)
+		c.declare(ls.Name.Value, valueType, false)
+		return valueType
+	}
+
+	declared := c.resolve(ls.Name.Type)
+	valueType := c.expect(ls.Value, declared)
+	if !assignable(valueType, declared) {
+		c.errorf(ls.Name.Token, "cannot use %s as %s in let %s", valueType, declared, ls.Name.Value)
+	}
+	c.declare(ls.Name.Value, declared, true)
+	return declared
+}
+
+func (c *checker) declarePattern(pattern ast.Expression) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		c.declare(pattern.Value, Any, false)
+	case *ast.ArrayLiteral:
+		for _, elem := range pattern.Elements {
+			c.declarePattern(elem)
+		}
+	case *ast.CallExpression:
+		for _, arg := range pattern.Arguments {
+			c.declarePattern(arg)
+		}
+	}
+}
+
+// expectReturn returns the type of exp, which the enclosing function returns.
+func (c *checker) expectReturn(exp ast.Expression) Type {
+	if c.fn == nil || c.fn.generator || c.fn.returnType == nil {
+		return c.infer(exp)
+	}
+	return c.expect(exp, c.fn.returnType)
+}
+
+func (c *checker) checkReturn(tok token.Token, typ Type) {
+	if c.fn == nil || c.fn.generator {
+		return
+	}
+	c.fn.returns = join(c.fn.returns, typ)
+
+	if c.fn.returnType == nil {
+		return
+	}
+	if !assignable(typ, c.fn.returnType) {
+		c.errorf(tok, "cannot use %s as %s in return", typ, c.fn.returnType)
+	}
+}
+
+func (c *checker) checkStructStatement(ss *ast.StructStatement) Type {
+	c.pushScope()
+	for _, field := range ss.Fields {
+		if field.Default != nil {
+			c.infer(field.Default)
+		}
+	}
+	c.popScope()
+
+	constructor := &Function{Return: &Named{Name: ss.Name.Value}}
+	c.declare(ss.Name.Value, constructor, false)
+	return constructor
+}
+
+func (c *checker) checkClassStatement(cs *ast.ClassStatement) Type {
+	constructor := &Function{Return: &Named{Name: cs.Name.Value}}
+	c.declare(cs.Name.Value, constructor, false)
+
+	self := map[string]Type{"self": &Named{Name: cs.Name.Value}, "super": Any}
+	for _, method := range cs.Methods {
+		c.checkFunction(method, self)
+	}
+	return constructor
+}
+
+func (c *checker) checkSelectStatement(ss *ast.SelectStatement) Type {
+	var result Type
+	for _, sc := range ss.Cases {
+		c.infer(sc.Operation)
+
+		c.pushScope()
+		if sc.Name != nil {
+			c.declare(sc.Name.Value, Any, false)
+		}
+		result = join(result, c.checkBlock(sc.Body))
+		c.popScope()
+	}
+	if ss.Default != nil {
+		result = join(result, c.checkBlock(ss.Default))
+	}
+	return result
+}
+
+func (c *checker) checkFunction(fl *ast.FunctionLiteral, implicit map[string]Type) *Function {
+	fnType := &Function{Params: []Type{}, Return: Any}
+
+	c.pushScope()
+	defer c.popScope()
+
+	for name, typ := range implicit {
+		c.declare(name, typ, false)
+	}
+	for _, param := range fl.Parameters {
+		typ := c.resolve(param.Type)
+		c.declare(param.Value, typ, param.Type != nil)
+		fnType.Params = append(fnType.Params, typ)
+	}
+
+	outer := c.fn
+	c.fn = &function{generator: fl.IsGenerator}
+	defer func() { c.fn = outer }()
+
+	if fl.ReturnType != nil {
+		c.fn.returnType = c.resolve(fl.ReturnType)
+		fnType.Return = c.fn.returnType
+	}
+
+	if fl.Body == nil {
+		return fnType
+	}
+	if fl.IsGenerator {
+		c.checkBlock(fl.Body)
+		fnType.Return = Any
+		return fnType
+	}
+
+	// the value of the last statement is returned implicitly
+	if result := c.checkBlock(fl.Body); result != nil {
+		tok := fl.Body.Token
+		if len(fl.Body.Statements) > 0 {
+			tok = statementToken(fl.Body.Statements[len(fl.Body.Statements)-1])
+		}
+		c.checkReturn(tok, result)
+	}
+
+	if fl.ReturnType == nil && c.fn.returns != nil {
+		fnType.Return = c.fn.returns
+	}
+	return fnType
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	default:
+		return token.Token{}
+	}
+}
+
+// infer returns the type of exp.
+func (c *checker) infer(exp ast.Expression) Type {
+	if typ := c.value(exp); typ != nil {
+		return typ
+	}
+	return Any
+}
+
+// expect returns the type of exp, which is used as a value of type expected.
+// The elements of an array literal are checked against the element type one by
+// one, since the type inferred for elements of different types is any, so its
+// type has the first element type that doesn't fit, or the one expected if
+// they all do.
+func (c *checker) expect(exp ast.Expression, expected Type) Type {
+	al, ok := exp.(*ast.ArrayLiteral)
+	array, isArray := expected.(*Array)
+	if !ok || !isArray {
+		return c.infer(exp)
+	}
+
+	var mismatch Type
+	for _, elem := range al.Elements {
+		var typ Type
+		if spread, ok := elem.(*ast.SpreadElement); ok {
+			typ = c.inferSpreadElement(spread)
+		} else {
+			typ = c.expect(elem, array.Element)
+		}
+		if mismatch == nil && !assignable(typ, array.Element) {
+			mismatch = typ
+		}
+	}
+	if mismatch != nil {
+		return &Array{Element: mismatch}
+	}
+	return array
+}
+
+// value returns the type of exp, or nil if evaluating it always returns from
+// the enclosing function, like an if expression with a return in each branch.
+func (c *checker) value(exp ast.Expression) Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+	case *ast.Identifier:
+		if b := c.scope.lookup(exp.Value); b != nil {
+			return b.typ
+		}
+		return Any
+	case *ast.PrefixExpression:
+		return c.inferPrefixExpression(exp)
+	case *ast.InfixExpression:
+		return c.inferInfixExpression(exp)
+	case *ast.IfExpression:
+		return c.inferIfExpression(exp)
+	case *ast.FunctionLiteral:
+		return c.inferFunctionLiteral(exp)
+	case *ast.CallExpression:
+		return c.inferCallExpression(exp)
+	case *ast.ArrayLiteral:
+		return c.inferArrayLiteral(exp)
+	case *ast.HashLiteral:
+		return c.inferHashLiteral(exp)
+	case *ast.ArrayComprehension:
+		return c.inferArrayComprehension(exp)
+	case *ast.HashComprehension:
+		return c.inferHashComprehension(exp)
+	case *ast.IndexExpression:
+		return c.inferIndexExpression(exp)
+	case *ast.MemberExpression:
+		return c.inferMemberExpression(exp)
+	case *ast.AssignExpression:
+		return c.inferAssignExpression(exp)
+	case *ast.YieldExpression:
+		return c.inferYieldExpression(exp)
+	case *ast.SpawnExpression:
+		c.infer(exp.Call)
+		return Any
+	case *ast.RangeExpression:
+		return c.inferRangeExpression(exp)
+	default:
+		return Any
+	}
+}
+
+func (c *checker) inferFunctionLiteral(fl *ast.FunctionLiteral) Type {
+	if fl.Name == nil {
+		return c.checkFunction(fl, nil)
+	}
+
+	// declared up front so the body can call itself
+	c.declare(fl.Name.Value, &Function{Return: Any}, false)
+	fnType := c.checkFunction(fl, nil)
+	c.declare(fl.Name.Value, fnType, false)
+	return fnType
+}
+
+func (c *checker) inferYieldExpression(ye *ast.YieldExpression) Type {
+	var typ Type = Null
+	if ye.Value != nil {
+		typ = c.infer(ye.Value)
+	}
+
+	if c.fn == nil || !c.fn.generator || c.fn.returnType == nil {
+		return Null
+	}
+	if !assignable(typ, c.fn.returnType) {
+		c.errorf(ye.Token, "cannot use %s as %s in yield", typ, c.fn.returnType)
+	}
+	return Null
+}
+
+func (c *checker) inferPrefixExpression(pe *ast.PrefixExpression) Type {
+	right := c.infer(pe.Right)
+
+	switch pe.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if right != Int && right != Any {
+			c.errorf(pe.Token, "unknown operator: -%s", right)
+		}
+		return Int
+	default:
+		return Any
+	}
+}
+
+func isComparison(operator string) bool {
+	switch operator {
+	case "==", "!=", "<", ">":
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *checker) inferInfixExpression(ie *ast.InfixExpression) Type {
+	left := c.infer(ie.Left)
+	right := c.infer(ie.Right)
+	op := ie.Operator
+
+	if op == "??" {
+		if left == Null {
+			return right
+		}
+		return join(left, right)
+	}
+	if op == "in" {
+		if _, ok := elementOf(right); !ok {
+			c.errorf(ie.Token, "unknown infix operation: %s in %s", left, right)
+		}
+		return Bool
+	}
+
+	switch {
+	case left == Any || right == Any:
+		if isComparison(op) {
+			return Bool
+		}
+		return Any
+	case left == Int && right == Int:
+		if isComparison(op) {
+			return Bool
+		}
+		return Int
+	case left == String && right == String:
+		switch op {
+		case "+":
+			return String
+		case "==", "!=":
+			return Bool
+		}
+		c.errorf(ie.Token, "unknown infix operation: %s %s %s", left, op, right)
+		return Any
+	case op == "==" || op == "!=":
+		return Bool
+	case left.String() != right.String():
+		c.errorf(ie.Token, "type mismatch: %s %s %s", left, op, right)
+		return Any
+	default:
+		c.errorf(ie.Token, "unknown infix operation: %s %s %s", left, op, right)
+		return Any
+	}
+}
+
+func (c *checker) inferRangeExpression(re *ast.RangeExpression) Type {
+	bounds := []ast.Expression{re.Start, re.End}
+	if re.Step != nil {
+		bounds = append(bounds, re.Step)
+	}
+	for _, bound := range bounds {
+		if typ := c.infer(bound); typ != Int && typ != Any {
+			c.errorf(re.Token, "range bound must be int, got %s", typ)
+		}
+	}
+	return Range
+}
+
+func (c *checker) inferIfExpression(ie *ast.IfExpression) Type {
+	c.infer(ie.Condition)
+
+	consequence := c.checkBlock(ie.Consequence)
+	var alternative Type = Null
+	if ie.Alternative != nil {
+		alternative = c.checkBlock(ie.Alternative)
+	}
+
+	return join(consequence, alternative)
+}
+
+func (c *checker) inferCallExpression(ce *ast.CallExpression) Type {
+	// the number of arguments isn't known with a spread, so they can't be
+	// checked against the parameters
+	if hasSpread(ce.Arguments) {
+		callee := c.infer(ce.Function)
+		for _, arg := range ce.Arguments {
+			if spread, ok := arg.(*ast.SpreadElement); ok {
+				c.inferSpreadElement(spread)
+			} else {
+				c.infer(arg)
+			}
+		}
+		if fn, ok := callee.(*Function); ok {
+			return fn.Return
+		}
+		return Any
+	}
+
+	if ident, ok := ce.Function.(*ast.Identifier); ok && c.scope.lookup(ident.Value) == nil {
+		if check, ok := builtins[ident.Value]; ok {
+			typ, msg := check(c.inferAll(ce.Arguments))
+			if msg != "" {
+				c.errorf(ce.Token, "%s", msg)
+			}
+			return typ
+		}
+	}
+
+	callee := c.infer(ce.Function)
+	fn, ok := callee.(*Function)
+	args := []Type{}
+	for idx, arg := range ce.Arguments {
+		if ok && idx < len(fn.Params) {
+			args = append(args, c.expect(arg, fn.Params[idx]))
+		} else {
+			args = append(args, c.infer(arg))
+		}
+	}
+
+	if ce.Optional && callee == Null {
+		return Null
+	}
+	if !ok {
+		if callee != Any {
+			c.errorf(ce.Token, "not a function: %s", callee)
+		}
+		return Any
+	}
+
+	if fn.Params == nil {
+		return fn.Return
+	}
+	if len(args) != len(fn.Params) {
+		c.errorf(ce.Token, "%s", wrongArgCount(len(fn.Params), len(args)))
+		return fn.Return
+	}
+	for idx, arg := range args {
+		if !assignable(arg, fn.Params[idx]) {
+			c.errorf(
+				ce.Token,
+				"cannot use %s as %s in argument %d to %s",
+				arg,
+				fn.Params[idx],
+				idx+1,
+				ce.Function.String(),
+			)
+		}
+	}
+	return fn.Return
+}
+
+func (c *checker) inferAll(exps []ast.Expression) []Type {
+	types := []Type{}
+	for _, exp := range exps {
+		types = append(types, c.infer(exp))
+	}
+	return types
+}
+
+func (c *checker) inferArrayLiteral(al *ast.ArrayLiteral) Type {
+	var element Type
+	for _, elem := range al.Elements {
+		if spread, ok := elem.(*ast.SpreadElement); ok {
+			element = join(element, c.inferSpreadElement(spread))
+			continue
+		}
+		element = join(element, c.infer(elem))
+	}
+	if element == nil {
+		element = Any
+	}
+	return &Array{Element: element}
+}
+
+// elementOf returns the type of the elements of an iterable, reporting false if
+// typ isn't iterable.
+func elementOf(typ Type) (Type, bool) {
+	switch typ := typ.(type) {
+	case *Array:
+		return typ.Element, true
+	case *Hash:
+		return typ.Key, true
+	case Basic:
+		if typ == Range {
+			return Int, true
+		}
+		return typ, typ == String || typ == Any
+	default:
+		return Any, false
+	}
+}
+
+// inferSpreadElement returns the type of the elements of a spread iterable.
+func (c *checker) inferSpreadElement(spread *ast.SpreadElement) Type {
+	typ := c.infer(spread.Value)
+	element, ok := elementOf(typ)
+	if !ok {
+		c.errorf(spread.Token, "spread of non-iterable: %s", typ)
+	}
+	return element
+}
+
+func (c *checker) inferArrayComprehension(ac *ast.ArrayComprehension) Type {
+	c.pushScope()
+	defer c.popScope()
+
+	c.checkComprehensionClauses(ac.Clauses)
+	return &Array{Element: c.infer(ac.Element)}
+}
+
+func (c *checker) inferHashComprehension(hc *ast.HashComprehension) Type {
+	c.pushScope()
+	defer c.popScope()
+
+	c.checkComprehensionClauses(hc.Clauses)
+	key := c.infer(hc.Key)
+	if !isHashable(key) {
+		c.errorf(hc.Token, "unable to hash key: %s", key)
+	}
+	return &Hash{Key: key, Value: c.infer(hc.Value)}
+}
+
+func (c *checker) checkComprehensionClauses(clauses []*ast.ComprehensionClause) {
+	for _, clause := range clauses {
+		typ := c.infer(clause.Iterable)
+		element, ok := elementOf(typ)
+		if !ok {
+			c.errorf(clause.Token, "not iterable: %s", typ)
+		}
+
+		if ident, ok := clause.Pattern.(*ast.Identifier); ok {
+			c.declare(ident.Value, element, false)
+		} else {
+			c.declarePattern(clause.Pattern)
+		}
+
+		if clause.Condition != nil {
+			c.infer(clause.Condition)
+		}
+	}
+}
+
+func hasSpread(exps []ast.Expression) bool {
+	for _, exp := range exps {
+		if _, ok := exp.(*ast.SpreadElement); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isHashable(typ Type) bool {
+	switch typ.(type) {
+	case *Array, *Hash, *Function:
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *checker) inferHashLiteral(hl *ast.HashLiteral) Type {
+	var key, value Type
+	for _, pair := range hl.Pairs {
+		if spread, ok := pair.Key.(*ast.SpreadElement); ok {
+			switch typ := c.infer(spread.Value).(type) {
+			case *Hash:
+				key, value = join(key, typ.Key), join(value, typ.Value)
+			default:
+				if typ != Any {
+					c.errorf(spread.Token, "spread of non-hash: %s", typ)
+				}
+				key, value = join(key, Any), join(value, Any)
+			}
+			continue
+		}
+
+		keyType := c.infer(pair.Key)
+		if !isHashable(keyType) {
+			c.errorf(hl.Token, "unable to hash key: %s", keyType)
+		}
+		key = join(key, keyType)
+		value = join(value, c.infer(pair.Value))
+	}
+	if key == nil {
+		return &Hash{Key: Any, Value: Any}
+	}
+	return &Hash{Key: key, Value: value}
+}
+
+func (c *checker) inferIndexExpression(ie *ast.IndexExpression) Type {
+	left := c.infer(ie.Left)
+	index := c.infer(ie.Index)
+	if ie.Optional && left == Null {
+		return Null
+	}
+
+	switch left := left.(type) {
+	case *Array:
+		if index != Int && index != Any {
+			c.errorf(ie.Token, "index operator not supported: %s[%s]", left, index)
+		}
+		return left.Element
+	case *Hash:
+		if !isHashable(index) {
+			c.errorf(ie.Token, "unable to hash key: %s", index)
+		}
+		return left.Value
+	case Basic:
+		if left == Range && (index == Int || index == Any) {
+			return Int
+		}
+		if left != Any {
+			c.errorf(ie.Token, "index operator not supported: %s[%s]", left, index)
+		}
+	}
+	return Any
+}
+
+func (c *checker) inferMemberExpression(me *ast.MemberExpression) Type {
+	obj := c.infer(me.Object)
+	if me.Optional && obj == Null {
+		return Null
+	}
+	switch obj {
+	case Int, Bool, Null:
+		c.errorf(me.Token, "member not found: %s.%s", obj, me.Property.Value)
+	}
+	return Any
+}
+
+func (c *checker) inferAssignExpression(ae *ast.AssignExpression) Type {
+	if target, ok := ae.Target.(*ast.MemberExpression); ok {
+		c.infer(target.Object)
+	}
+	return c.infer(ae.Value)
+}
@@ -0,0 +1,133 @@
+package typecheck
+
+import (
+	"testing"
+
+	"github.com/jamestrew/go-interpreter/monkey/parser"
+)
+
+func checkInput(t *testing.T, input string) []*Error {
+	program, p := parser.ParseInput(input)
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return Check(program)
+}
+
+func TestValidPrograms(t *testing.T) {
+	tests := []string{
+		"let x = 5; x + 1",
+		"let x: int = 5; x + 1",
+		`let s: string = "a"; s + "b"`,
+		"let f = fn(x) { x + 1 }; f(\"a\")",
+		"let add = fn(a: int, b: int) -> int { a + b }; add(1, 2) * 3",
+		"let xs: [int] = [1, 2, 3]; xs[0] + 1",
+		`let h: {string: int} = {"a": 1}; h["a"] + 1`,
+		"let empty: [string] = []",
+		"let xs: [any] = [1, \"a\"]; let ys: [int] = [1, ...xs]",
+		"let f: fn(int) -> int = fn(x: int) -> int { x * 2 }",
+		"let g = fn(x) { if (x) { return 1 } 2 }; g(true) + 1",
+		"len(\"abc\") + len([1]) + len({})",
+		"struct Point { x, y }; let p: Point = Point(1, 2)",
+		"class A { init(x: int) { self.x = x } }; let a: A = A(1)",
+		"let fact = fn(n: int) -> int { if (n < 2) { return 1 } n * fact(n - 1) }",
+		"let [a, b] = [1, 2]; a + b",
+		"first([1, 2]) + last([3])",
+		"fn* count(n: int) -> int { yield n; count(n + 1) }; collect(take(count(1), 2))",
+		"fn* g() { yield 1; return \"done\" }",
+		"let ch = channel(1); let t = spawn fn() { send(ch, 1) }; select { case let v = recv(ch) { v } default { 0 } }",
+		`let h = {"a": 1}; (h["b"] ?? 0) + 1`,
+		"let f = fn() { }; f()?.x ?? 2",
+		"let xs: [int] = [...[1, 2], 3]; let add = fn(a: int, b: int) { a + b }; add(...xs)",
+		`let h: {string: int} = {...{"a": 1}, "b": 2}`,
+		"let xs: [int] = [x * 2 for x in [1, 2] if x > 1]",
+		`let h: {string: int} = {c: 1 for c in "ab"}`,
+		"let ys: [string] = [y for [x, y] in [[1, 2]]]",
+		"let r: range = 0..<10 step 2; let xs: [int] = [x for x in r]; len(r) + r[1]",
+		"let ok: bool = 2 in 1..5; let n: int = len(1..10)",
+		"fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5) + 1",
+		`let xs = [1, 2]; arrayPush(xs, "a"); xs[2] + "b"`,
+		`let xs = [1, 2]; xs.push("a"); xs[2] + "b"`,
+		`let h = {"a": 1}; h.b = "x"; h["b"] + "c"`,
+		"let p: Point = Point(1, 2); struct Point { x, y }",
+		"enum Color { Red, Green }; let c: Color = Color.Red",
+	}
+
+	for _, input := range tests {
+		for _, err := range checkInput(t, input) {
+			t.Errorf("unexpected error for %q: %s", input, err)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`"a" - 1`, []string{"1:5: type mismatch: string - int"}},
+		{`"a" - "b"`, []string{"1:5: unknown infix operation: string - string"}},
+		{"true + false", []string{"1:6: unknown infix operation: bool + bool"}},
+		{`-"a"`, []string{"1:1: unknown operator: -string"}},
+		{"len(5)", []string{"1:4: argument to `len` not supported, got int"}},
+		{`len("a", "b")`, []string{"1:4: wrong number of arguments. got=2, want=1"}},
+		{`let x: int = "a";`, []string{"1:5: cannot use string as int in let x"}},
+		{`let xs: [int] = ["a"]`, []string{"1:5: cannot use [string] as [int] in let xs"}},
+		{`let p: [int] = [1, "a"]`, []string{"1:5: cannot use [string] as [int] in let p"}},
+		{`let p: [[int]] = [[1], [2, true]]`, []string{"1:5: cannot use [[bool]] as [[int]] in let p"}},
+		{`let p: [int] = [1, ...["a"]]`, []string{"1:5: cannot use [string] as [int] in let p"}},
+		{`fn f(xs: [int]) { xs }; f([1, "a"])`, []string{"1:26: cannot use [string] as [int] in argument 1 to f"}},
+		{`fn f() -> [int] { return [1, "a"] }`, []string{"1:19: cannot use [string] as [int] in return"}},
+		{
+			"let f = fn(a: string, b: [int]) -> bool { true };\nf(1, [1]);\nf(\"a\", [\"b\"])",
+			[]string{
+				"2:2: cannot use int as string in argument 1 to f",
+				"3:2: cannot use [string] as [int] in argument 2 to f",
+			},
+		},
+		{"let f = fn(a: int) { a }; f()", []string{"1:28: wrong number of arguments. got=0, want=1"}},
+		{"let f = fn() -> int { \"a\" }", []string{"1:23: cannot use string as int in return"}},
+		{"let f = fn() -> int {\n  if (true) { return \"a\" }\n  1\n}", []string{"2:15: cannot use string as int in return"}},
+		{"let f = fn() { \"s\" }; f() - 1", []string{"1:27: type mismatch: string - int"}},
+		{"let x = 5; x()", []string{"1:13: not a function: int"}},
+		{"5[0]", []string{"1:2: index operator not supported: int[int]"}},
+		{`[1][""]`, []string{"1:4: index operator not supported: [int][string]"}},
+		{"{[1]: 2}", []string{"1:1: unable to hash key: [int]"}},
+		{"true.foo", []string{"1:5: member not found: bool.foo"}},
+		{"fn* g() -> int { yield \"a\" }", []string{"1:18: cannot use string as int in yield"}},
+		{"fn add(a: int) { a }; add(\"a\")", []string{"1:26: cannot use string as int in argument 1 to add"}},
+		{`select { case recv(c) { "a" - 1 } }`, []string{"1:29: type mismatch: string - int"}},
+		{"[...5]", []string{"1:2: spread of non-iterable: int"}},
+		{"{...[1]}", []string{"1:2: spread of non-hash: [int]"}},
+		{`let xs: [int] = [..."ab"]`, []string{"1:5: cannot use [string] as [int] in let xs"}},
+		{"[x for x in 5]", []string{"1:4: not iterable: int"}},
+		{`[x - 1 for x in "ab"]`, []string{"1:4: type mismatch: string - int"}},
+		{"let xs: [int] = [x for x in [true]]", []string{"1:5: cannot use [bool] as [int] in let xs"}},
+		{`1.."a"`, []string{"1:2: range bound must be int, got string"}},
+		{"0..10 step true", []string{"1:2: range bound must be int, got bool"}},
+		{"let s: string = (1..5)[0]", []string{"1:5: cannot use int as string in let s"}},
+		{"1 in 2", []string{"1:3: unknown infix operation: int in int"}},
+		{"take([1])", []string{"1:5: wrong number of arguments. got=1, want=2"}},
+		{"struct P { x }; let p: P = 5", []string{"1:21: cannot use int as P in let p"}},
+		{
+			"let g = fn(n: int) -> int { n }\nlet h = fn(s: string) { g(s) }",
+			[]string{"2:26: cannot use string as int in argument 1 to g"},
+		},
+		{"let x: Foo = 1", []string{"1:8: unknown type: Foo"}},
+		{"fn f(xs: [Foo]) -> Bar { xs }", []string{"1:11: unknown type: Foo", "1:20: unknown type: Bar"}},
+		{`let xs = [1]; xs + "a"`, []string{"1:18: type mismatch: [any] + string"}},
+	}
+
+	for _, tt := range tests {
+		errors := checkInput(t, tt.input)
+		if len(errors) != len(tt.expected) {
+			t.Errorf("expected %d errors for %q. got=%v", len(tt.expected), tt.input, errors)
+			continue
+		}
+		for idx, err := range errors {
+			if err.Error() != tt.expected[idx] {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected[idx], err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package typecheck
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Type is the static type of a Monkey expression. Anything the checker can't
+// reason about is Any, which is compatible with every other type.
+type Type interface {
+	String() string
+}
+
+type Basic string
+
+const (
+	Int    Basic = "int"
+	String Basic = "string"
+	Bool   Basic = "bool"
+	Null   Basic = "null"
+	Range  Basic = "range"
+	Any    Basic = "any"
+)
+
+func (b Basic) String() string { return string(b) }
+
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+// Function is the type of a callable. Params is nil when the number and types
+// of arguments aren't known, e.g. for struct constructors.
+type Function struct {
+	Params []Type
+	Return Type
+}
+
+func (f *Function) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, param := range f.Params {
+		params = append(params, param.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") -> ")
+	out.WriteString(f.Return.String())
+
+	return out.String()
+}
+
+// Named is the type of instances of user defined structs, classes and enums.
+type Named struct {
+	Name string
+}
+
+func (n *Named) String() string { return n.Name }
+
+// assignable reports whether a value of type from can be used where a value of
+// type to is expected.
+func assignable(from, to Type) bool {
+	if from == Any || to == Any {
+		return true
+	}
+
+	switch to := to.(type) {
+	case Basic:
+		return from == to
+	case *Array:
+		from, ok := from.(*Array)
+		return ok && assignable(from.Element, to.Element)
+	case *Hash:
+		from, ok := from.(*Hash)
+		return ok && assignable(from.Key, to.Key) && assignable(from.Value, to.Value)
+	case *Function:
+		from, ok := from.(*Function)
+		if !ok {
+			return false
+		}
+		if from.Params != nil && to.Params != nil {
+			if len(from.Params) != len(to.Params) {
+				return false
+			}
+			for idx := range to.Params {
+				if !assignable(to.Params[idx], from.Params[idx]) {
+					return false
+				}
+			}
+		}
+		return assignable(from.Return, to.Return)
+	case *Named:
+		from, ok := from.(*Named)
+		return ok && from.Name == to.Name
+	default:
+		return false
+	}
+}
+
+// join returns the type describing values of both a and b.
+func join(a, b Type) Type {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.String() == b.String() {
+		return a
+	}
+	return Any
+}
@@ -0,0 +1,190 @@
+package vm
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/evaluator"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// callValue calls the function under the numArgs arguments on top of the
+// stack. Closures get a frame, which a tail call reuses, while anything else is
+// called right away, its result replacing the function and its arguments.
+func (vm *VM) callValue(numArgs int, tail bool) *object.Error {
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *Closure:
+		return vm.callClosure(callee, numArgs, tail)
+	case *object.BoundMethod:
+		cl, ok := callee.Method.(*Closure)
+		if !ok {
+			break
+		}
+		vm.insertSelf(callee, numArgs)
+		return vm.callClosure(cl, numArgs+2, tail)
+	case *object.Class:
+		return vm.instantiate(callee, numArgs)
+	}
+
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	result := evaluator.Call(vm.caller(), vm.stack[vm.sp-1-numArgs], args...)
+	vm.sp -= numArgs + 1
+	return vm.pushResult(result)
+}
+
+// insertSelf puts the receiver of a bound method and its super ahead of the
+// numArgs arguments on top of the stack.
+func (vm *VM) insertSelf(bm *object.BoundMethod, numArgs int) {
+	var super object.Object = Null
+	if bm.Class.Super != nil {
+		super = &object.Super{Receiver: bm.Receiver, Class: bm.Class.Super}
+	}
+
+	vm.grow(2)
+	copy(vm.stack[vm.sp-numArgs+2:vm.sp+2], vm.stack[vm.sp-numArgs:vm.sp])
+	vm.stack[vm.sp-numArgs] = bm.Receiver
+	vm.stack[vm.sp-numArgs+1] = super
+	vm.sp += 2
+}
+
+func (vm *VM) callClosure(cl *Closure, numArgs int, tail bool) *object.Error {
+	hidden := 0
+	if cl.Fn.IsMethod {
+		hidden = 2
+	}
+	if numArgs != cl.Fn.NumParameters+hidden {
+		return wrongArgCountError(cl.Fn.NumParameters, numArgs-hidden)
+	}
+	if !tail || cl.Fn.IsGenerator {
+		if err := vm.checkDepth(vm.depth); err != nil {
+			return err
+		}
+	}
+
+	if cl.Fn.IsGenerator {
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp -= numArgs + 1
+		vm.push(vm.generator(cl, args))
+		return nil
+	}
+
+	if tail {
+		vm.replaceFrame(cl, numArgs)
+		return nil
+	}
+	vm.pushFrame(cl, numArgs)
+	return nil
+}
+
+func (vm *VM) checkDepth(depth int) *object.Error {
+	if vm.m.maxDepth > 0 && depth >= vm.m.maxDepth {
+		return newError("maximum recursion depth exceeded")
+	}
+	return nil
+}
+
+// pushFrame runs cl in a new frame, whose locals start with the numArgs
+// arguments on top of the stack.
+func (vm *VM) pushFrame(cl *Closure, numArgs int) *Frame {
+	basePointer := vm.sp - numArgs
+	vm.grow(cl.Fn.NumLocals - numArgs)
+	for i := vm.sp; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = basePointer + cl.Fn.NumLocals
+
+	frame := NewFrame(cl, basePointer)
+	frame.callerDepth = vm.depth
+	vm.frames = append(vm.frames, frame)
+	vm.depth++
+	return &vm.frames[len(vm.frames)-1]
+}
+
+// replaceFrame runs cl in place of the current frame, which has nothing left to
+// do but return what cl does.
+func (vm *VM) replaceFrame(cl *Closure, numArgs int) {
+	frame := &vm.frames[len(vm.frames)-1]
+	basePointer := frame.basePointer
+	copy(vm.stack[basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = basePointer + numArgs
+
+	vm.grow(cl.Fn.NumLocals - numArgs)
+	for i := vm.sp; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = basePointer + cl.Fn.NumLocals
+
+	frame.cl = cl
+	frame.ip = -1
+}
+
+func (vm *VM) popFrame() {
+	frame := vm.frames[len(vm.frames)-1]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	vm.sp = frame.basePointer - 1
+	vm.depth = frame.callerDepth
+}
+
+// instantiate makes an instance of class, calling its init with the numArgs
+// arguments on top of the stack. init nests twice, like in the evaluator: once
+// for the constructor, and once for init itself.
+func (vm *VM) instantiate(class *object.Class, numArgs int) *object.Error {
+	inst := &object.Instance{Class: class, Fields: map[string]object.Object{}}
+
+	init, owner := class.FindMethod("init")
+	if init == nil {
+		if numArgs != 0 {
+			return wrongArgCountError(0, numArgs)
+		}
+		vm.sp--
+		vm.push(inst)
+		return nil
+	}
+
+	if err := vm.checkDepth(vm.depth); err != nil {
+		return err
+	}
+	bound := &object.BoundMethod{Receiver: inst, Class: owner, Name: "init", Method: init}
+	cl, ok := init.(*Closure)
+	if !ok || cl.Fn.IsGenerator {
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp -= numArgs + 1
+		if result := vm.m.call(vm.depth+1, bound, args...); result.Type() == object.ERROR_OBJ {
+			return result.(*object.Error)
+		}
+		vm.push(inst)
+		return nil
+	}
+
+	if numArgs != cl.Fn.NumParameters {
+		return wrongArgCountError(cl.Fn.NumParameters, numArgs)
+	}
+	if err := vm.checkDepth(vm.depth + 1); err != nil {
+		return err
+	}
+	vm.stack[vm.sp-1-numArgs] = bound
+	vm.insertSelf(bound, numArgs)
+
+	callerDepth := vm.depth
+	frame := vm.pushFrame(cl, numArgs+2)
+	frame.ctor = inst
+	frame.callerDepth = callerDepth
+	vm.depth = callerDepth + 2
+	return nil
+}
+
+// generator returns an iterator over what cl yields when called with args. Its
+// body runs in a vm of its own, at the depth of the call.
+func (vm *VM) generator(cl *Closure, args []object.Object) *object.Iterator {
+	m, depth := vm.m, vm.depth
+	return evaluator.Generator(func(yield func(value object.Object) object.Object) object.Object {
+		body := m.newVM(depth)
+		body.yield = yield
+		body.push(cl)
+		for _, arg := range args {
+			body.push(arg)
+		}
+		body.pushFrame(cl, len(args))
+		return body.run()
+	})
+}
@@ -0,0 +1,46 @@
+package vm
+
+import (
+	"sync"
+
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// Closure is a compiled function along with the variables it captured. Other
+// engines call it through Call, which runs it in a vm of its own.
+type Closure struct {
+	Fn   *object.CompiledFunction
+	Free []*cell
+
+	m *machine
+}
+
+func (c *Closure) Type() object.ObjectType { return object.FUNCTION_OBJ }
+func (c *Closure) Inspect() string         { return c.Fn.Inspect() }
+
+func (c *Closure) Call(args ...object.Object) object.Object {
+	return c.m.call(0, c, args...)
+}
+
+// cell holds a local variable that a closure captured, which lives on after the
+// frame that defined it. Spawned tasks can share it, so it's locked. A nil
+// value means the variable isn't set yet.
+type cell struct {
+	mu    sync.Mutex
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return "cell" }
+
+func (c *cell) get() object.Object {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+func (c *cell) set(value object.Object) {
+	c.mu.Lock()
+	c.value = value
+	c.mu.Unlock()
+}
@@ -0,0 +1,62 @@
+package vm
+
+import (
+	"reflect"
+
+	"github.com/jamestrew/go-interpreter/monkey/evaluator"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// spawn starts calling fn with args as a task, in a vm of its own.
+func (vm *VM) spawn(fn object.Object, args []object.Object) *object.Task {
+	task := &object.Task{Done: make(chan struct{})}
+	m, depth := vm.m, vm.depth
+	go func() {
+		defer close(task.Done)
+		task.Result = m.call(depth, fn, args...)
+	}()
+	return task
+}
+
+// selectCase is the channel operation of a case of a select statement, on the
+// stack until the select is performed.
+type selectCase struct {
+	reflect.SelectCase
+}
+
+func (sc *selectCase) Type() object.ObjectType { return "SELECT_CASE" }
+func (sc *selectCase) Inspect() string         { return "select case" }
+
+func (vm *VM) selectCase(send bool) *object.Error {
+	args := vm.pop().(*object.Array).Snapshot()
+
+	name := "recv"
+	if send {
+		name = "send"
+	}
+	sc, err := evaluator.SelectCase(name, args)
+	if err != nil {
+		return err
+	}
+	vm.push(&selectCase{sc})
+	return nil
+}
+
+func (vm *VM) executeSelect(numCases int, hasDefault bool) *object.Error {
+	cases := []reflect.SelectCase{}
+	for _, sc := range vm.stack[vm.sp-numCases : vm.sp] {
+		cases = append(cases, sc.(*selectCase).SelectCase)
+	}
+	vm.sp -= numCases
+	if hasDefault {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+
+	chosen, received, err := evaluator.Select(cases)
+	if err != nil {
+		return err
+	}
+	vm.push(received)
+	vm.push(newInteger(int64(chosen)))
+	return nil
+}
@@ -0,0 +1,99 @@
+package vm
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/evaluator"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// defineStruct pushes a new definition of the struct prototype describes, with
+// the closures computing its defaults, which are on the stack in the order of
+// their fields.
+func (vm *VM) defineStruct(prototype *object.StructType) {
+	def := &object.StructType{
+		Name:     prototype.Name,
+		Fields:   prototype.Fields,
+		Defaults: prototype.Defaults,
+		Compiled: map[string]object.Object{},
+	}
+
+	idx := vm.sp - len(prototype.Defaults)
+	for _, field := range prototype.Fields {
+		if _, ok := prototype.Defaults[field]; ok {
+			def.Compiled[field] = vm.stack[idx]
+			idx++
+		}
+	}
+	vm.sp -= len(prototype.Defaults)
+
+	vm.push(def)
+}
+
+// copyEnum returns a new enum with the variants of prototype, so each run of
+// its definition makes a distinct enum, like in the evaluator.
+func copyEnum(prototype *object.Enum) *object.Enum {
+	enum := &object.Enum{Name: prototype.Name, Variants: map[string]*object.EnumVariant{}}
+	for name, v := range prototype.Variants {
+		variant := &object.EnumVariant{Enum: enum, Name: v.Name, Fields: v.Fields}
+		if v.Unit != nil {
+			variant.Unit = &object.EnumValue{Variant: variant}
+		}
+		enum.Variants[name] = variant
+	}
+	return enum
+}
+
+// matchConstructor destructures value by constructor, pushing the values of
+// its numArgs fields so the first is on top of the stack.
+func (vm *VM) matchConstructor(constructor, value object.Object, numArgs, constIndex int) *object.Error {
+	switch constructor := constructor.(type) {
+	case *object.EnumVariant:
+		if numArgs != len(constructor.Fields) {
+			return evaluator.PayloadArityError(constructor, numArgs)
+		}
+		enumValue, ok := value.(*object.EnumValue)
+		if !ok || enumValue.Variant != constructor {
+			return vm.patternMismatchError(constIndex, value)
+		}
+		vm.pushReversed(enumValue.Payload)
+	case *object.StructType:
+		if numArgs != len(constructor.Fields) {
+			return wrongArgCountError(len(constructor.Fields), numArgs)
+		}
+		structValue, ok := value.(*object.Struct)
+		if !ok || structValue.Def != constructor {
+			return vm.patternMismatchError(constIndex, value)
+		}
+		values := []object.Object{}
+		for _, field := range constructor.Fields {
+			value, _ := structValue.Get(field)
+			values = append(values, value)
+		}
+		vm.pushReversed(values)
+	default:
+		return newError("not a constructor: %s", constructor.Type())
+	}
+	return nil
+}
+
+func (vm *VM) patternMismatchError(constIndex int, value object.Object) *object.Error {
+	pattern := vm.constantString(constIndex)
+	return newError("pattern mismatch: %s does not match %s", pattern, value.Inspect())
+}
+
+// quote quotes the node of q, replacing its calls to unquote with the numValues
+// values on top of the stack, in order.
+func (vm *VM) quote(q *object.Quote, numValues int) *object.Error {
+	values := make([]object.Object, numValues)
+	copy(values, vm.stack[vm.sp-numValues:vm.sp])
+	vm.sp -= numValues
+
+	next := 0
+	return vm.pushResult(evaluator.Quote(q.Node, func(ast.Node) object.Object {
+		if next >= len(values) {
+			return Null
+		}
+		next++
+		return values[next-1]
+	}))
+}
@@ -0,0 +1,55 @@
+package vm
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/ast"
+	"github.com/jamestrew/go-interpreter/monkey/compiler"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// Engine compiles and runs programs one after another, each seeing the globals
+// of those before it, like the lines of a REPL.
+type Engine struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     *Globals
+
+	compilerOpts []compiler.Option
+	vmOpts       []Option
+}
+
+func NewEngine(opts ...Option) *Engine {
+	c := compiler.New()
+	e := &Engine{
+		symbolTable: c.SymbolTable(),
+		constants:   []object.Object{},
+		globals:     NewGlobals(),
+		vmOpts:      opts,
+	}
+	if newConfig(opts).legacyBlockScope {
+		e.compilerOpts = append(e.compilerOpts, compiler.WithLegacyBlockScope())
+	}
+	return e
+}
+
+// Eval runs node, which is a program or one of its statements, returning its
+// value. A program that doesn't compile returns the error that stopped it.
+func (e *Engine) Eval(node ast.Node) object.Object {
+	var program *ast.Program
+	switch node := node.(type) {
+	case *ast.Program:
+		program = node
+	case ast.Statement:
+		program = &ast.Program{Statements: []ast.Statement{node}}
+	case ast.Expression:
+		program = &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: node}}}
+	}
+
+	c := compiler.NewWithState(e.symbolTable, e.constants, e.compilerOpts...)
+	if err := c.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	bytecode := c.Bytecode()
+	e.constants = bytecode.Constants
+
+	return NewWithGlobals(bytecode, e.globals, e.vmOpts...).Run()
+}
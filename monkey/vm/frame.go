@@ -0,0 +1,25 @@
+package vm
+
+import (
+	"github.com/jamestrew/go-interpreter/monkey/code"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+type Frame struct {
+	cl          *Closure
+	ip          int
+	basePointer int
+
+	// ctor is the instance an init frame returns in place of init's result
+	ctor *object.Instance
+	// callerDepth is the depth of the vm once the frame returns
+	callerDepth int
+}
+
+func NewFrame(cl *Closure, basePointer int) Frame {
+	return Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"sync"
+
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// Globals holds the values of the globals of a program, by the index the
+// compiler gave them. The programs compiled from the lines of a REPL share
+// them. Spawned tasks can set them concurrently, so they're locked.
+type Globals struct {
+	mu     sync.RWMutex
+	values []object.Object
+	names  []string
+	index  map[string]int
+}
+
+func NewGlobals() *Globals {
+	return &Globals{index: map[string]int{}}
+}
+
+// define makes room for the globals names lists, by index.
+func (g *Globals) define(names []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for idx := len(g.values); idx < len(names); idx++ {
+		g.values = append(g.values, nil)
+		g.names = append(g.names, names[idx])
+		g.index[names[idx]] = idx
+	}
+}
+
+// get returns the global at idx, or nil if it isn't set.
+func (g *Globals) get(idx int) object.Object {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.values[idx]
+}
+
+func (g *Globals) set(idx int, value object.Object) {
+	g.mu.Lock()
+	g.values[idx] = value
+	g.mu.Unlock()
+}
+
+// name returns the name of the global at idx.
+func (g *Globals) name(idx int) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.names[idx]
+}
+
+// lookup returns the global called name, or nil if it isn't set.
+func (g *Globals) lookup(name string) object.Object {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if idx, ok := g.index[name]; ok {
+		return g.values[idx]
+	}
+	return nil
+}
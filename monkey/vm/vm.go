@@ -0,0 +1,781 @@
+// Package vm runs the bytecode of the compiler.
+//
+// Values, builtins and methods are the evaluator's, so programs behave the same
+// on either engine.
+package vm
+
+import (
+	"fmt"
+
+	"github.com/jamestrew/go-interpreter/monkey/code"
+	"github.com/jamestrew/go-interpreter/monkey/compiler"
+	"github.com/jamestrew/go-interpreter/monkey/evaluator"
+	"github.com/jamestrew/go-interpreter/monkey/object"
+)
+
+// StackSize is how many values the stack of a vm starts with room for. It
+// grows as calls nest.
+const StackSize = 2048
+
+var (
+	True  = evaluator.TRUE
+	False = evaluator.FALSE
+	Null  = evaluator.NULL
+)
+
+// builtinNames are the names of the evaluator's builtins, by the index the
+// compiler gives them.
+var builtinNames = evaluator.BuiltinNames()
+
+// machine is what the vms running a program share: the vm running the program
+// itself, and those running its generators, tasks and callbacks.
+type machine struct {
+	constants []object.Object
+	globals   *Globals
+	maxDepth  int
+}
+
+type VM struct {
+	m *machine
+
+	stack []object.Object
+	sp    int // always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames []Frame
+
+	depth int                                     // function calls in progress
+	yield func(value object.Object) object.Object // set while running a generator
+
+	main *Closure
+}
+
+// Option configures a VM.
+type Option func(*config)
+
+type config struct {
+	legacyBlockScope bool
+	maxDepth         int
+}
+
+// WithLegacyBlockScope compiles blocks into the scope that encloses them, like
+// evaluator.WithLegacyBlockScope. Only an Engine compiles.
+func WithLegacyBlockScope() Option {
+	return func(c *config) {
+		c.legacyBlockScope = true
+	}
+}
+
+// WithMaxDepth limits how deeply function calls can nest, like
+// evaluator.WithMaxDepth.
+func WithMaxDepth(depth int) Option {
+	return func(c *config) {
+		c.maxDepth = depth
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{maxDepth: evaluator.DefaultMaxDepth}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func New(bytecode *compiler.Bytecode, opts ...Option) *VM {
+	return NewWithGlobals(bytecode, NewGlobals(), opts...)
+}
+
+// NewWithGlobals returns a vm running bytecode with the globals of earlier
+// programs, for running the lines of a REPL.
+func NewWithGlobals(bytecode *compiler.Bytecode, globals *Globals, opts ...Option) *VM {
+	globals.define(bytecode.Globals)
+	m := &machine{
+		constants: bytecode.Constants,
+		globals:   globals,
+		maxDepth:  newConfig(opts).maxDepth,
+	}
+
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		NumLocals:    len(bytecode.Locals),
+		LocalNames:   bytecode.Locals,
+	}
+	vm := m.newVM(0)
+	vm.main = &Closure{Fn: mainFn, m: m}
+	return vm
+}
+
+func (m *machine) newVM(depth int) *VM {
+	return &VM{
+		m:      m,
+		stack:  make([]object.Object, StackSize),
+		frames: make([]Frame, 0, 16),
+		depth:  depth,
+	}
+}
+
+// Run runs the program, returning its value, or the error that stopped it.
+func (vm *VM) Run() object.Object {
+	vm.push(vm.main)
+	// the program isn't a call, so it doesn't count towards the depth
+	frame := vm.pushFrame(vm.main, 0)
+	vm.depth = frame.callerDepth
+	return vm.run()
+}
+
+// call calls fn with args in a new vm at depth, returning its result.
+func (m *machine) call(depth int, fn object.Object, args ...object.Object) object.Object {
+	vm := m.newVM(depth)
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	if err := vm.callValue(len(args), false); err != nil {
+		return err
+	}
+	if len(vm.frames) == 0 {
+		return vm.pop()
+	}
+	return vm.run()
+}
+
+// run runs until the frame the vm started with returns, returning its value.
+func (vm *VM) run() object.Object {
+	for {
+		frame := &vm.frames[len(vm.frames)-1]
+		frame.ip++
+		ip := frame.ip
+		ins := frame.cl.Fn.Instructions
+		op := code.Opcode(ins[ip])
+
+		var err *object.Error
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(vm.m.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+
+		case code.OpTrue:
+			vm.push(True)
+
+		case code.OpFalse:
+			vm.push(False)
+
+		case code.OpNull:
+			vm.push(Null)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpIn:
+			err = vm.executeBinaryOperation(op)
+
+		case code.OpMinus:
+			operand := vm.pop()
+			if integer, ok := operand.(*object.Integer); ok {
+				vm.push(newInteger(-integer.Value))
+			} else {
+				err = vm.pushResult(evaluator.Prefix("-", operand))
+			}
+
+		case code.OpBang:
+			vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop())))
+
+		case code.OpJump:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			if !isTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpNull:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			if vm.stack[vm.sp-1] == Null {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpNotNull:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			if vm.stack[vm.sp-1] != Null {
+				frame.ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			value := vm.m.globals.get(globalIndex)
+			if value == nil {
+				value = vm.lookup(vm.m.globals.name(globalIndex), false)
+			}
+			err = vm.pushResult(value)
+
+		case code.OpSetGlobal:
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.m.globals.set(globalIndex, vm.stack[vm.sp-1])
+
+		case code.OpGetLocal:
+			localIndex := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			value := vm.stack[frame.basePointer+localIndex]
+			if c, ok := value.(*cell); ok {
+				value = c.get()
+			}
+			if value == nil {
+				value = vm.lookup(frame.cl.Fn.LocalNames[localIndex], true)
+			}
+			err = vm.pushResult(value)
+
+		case code.OpSetLocal:
+			localIndex := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			slot := &vm.stack[frame.basePointer+localIndex]
+			if c, ok := (*slot).(*cell); ok {
+				c.set(vm.stack[vm.sp-1])
+			} else {
+				*slot = vm.stack[vm.sp-1]
+			}
+
+		case code.OpClearLocal:
+			localIndex := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.stack[frame.basePointer+localIndex] = nil
+
+		case code.OpGetFree:
+			freeIndex := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			value := frame.cl.Free[freeIndex].get()
+			if value == nil {
+				value = vm.lookup(frame.cl.Fn.FreeNames[freeIndex], true)
+			}
+			err = vm.pushResult(value)
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			builtin, _ := evaluator.LookupBuiltin(vm.caller(), builtinNames[builtinIndex])
+			vm.push(builtin)
+
+		case code.OpCaptureLocal:
+			localIndex := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			slot := &vm.stack[frame.basePointer+localIndex]
+			c, ok := (*slot).(*cell)
+			if !ok {
+				c = &cell{value: *slot}
+				*slot = c
+			}
+			vm.push(c)
+
+		case code.OpCaptureFree:
+			freeIndex := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.push(frame.cl.Free[freeIndex])
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			vm.pushClosure(int(constIndex), numFree)
+
+		case code.OpCall, code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			err = vm.callValue(numArgs, op == code.OpTailCall)
+
+		case code.OpApply, code.OpTailApply:
+			args := vm.pop().(*object.Array).Snapshot()
+			for _, arg := range args {
+				vm.push(arg)
+			}
+			err = vm.callValue(len(args), op == code.OpTailApply)
+
+		case code.OpReturnValue, code.OpReturn:
+			var returnValue object.Object
+			if op == code.OpReturnValue {
+				returnValue = vm.pop()
+			}
+			if frame.ctor != nil {
+				returnValue = frame.ctor
+			}
+			vm.popFrame()
+			if len(vm.frames) == 0 {
+				return returnValue
+			}
+			if returnValue == nil {
+				returnValue = Null
+			}
+			vm.push(returnValue)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			err = vm.buildHash(numElements)
+
+		case code.OpSpread:
+			err = vm.pushResult(evaluator.Spread(vm.pop()))
+
+		case code.OpConcat:
+			numArrays := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := []object.Object{}
+			for _, arr := range vm.stack[vm.sp-numArrays : vm.sp] {
+				elements = append(elements, arr.(*object.Array).Snapshot()...)
+			}
+			vm.sp -= numArrays
+			vm.push(&object.Array{Elements: elements})
+
+		case code.OpSpreadHash:
+			if hash := vm.stack[vm.sp-1]; hash.Type() != object.HASH_OBJ {
+				err = newError("spread of non-hash: %s", hash.Type())
+			}
+
+		case code.OpMerge:
+			numHashes := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			pairs := map[object.HashKey]object.HashPair{}
+			for _, hash := range vm.stack[vm.sp-numHashes : vm.sp] {
+				for hashKey, pair := range hash.(*object.Hash).Snapshot() {
+					pairs[hashKey] = pair
+				}
+			}
+			vm.sp -= numHashes
+			vm.push(&object.Hash{Pairs: pairs})
+
+		case code.OpIndex:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.index(left, index, int(constIndex)))
+
+		case code.OpMember:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			obj := vm.pop()
+			name := vm.constantString(int(constIndex))
+			err = vm.pushResult(evaluator.GetMember(vm.caller(), obj, name))
+
+		case code.OpSetMember:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			value := vm.pop()
+			obj := vm.pop()
+			name := vm.constantString(int(constIndex))
+			err = vm.pushResult(evaluator.SetMember(obj, name, value))
+
+		case code.OpRange:
+			flags := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			var step object.Object
+			if flags&code.RangeStep != 0 {
+				step = vm.pop()
+			}
+			end := vm.pop()
+			start := vm.pop()
+			err = vm.pushResult(evaluator.NewRange(start, end, step, flags&code.RangeExclusive != 0))
+
+		case code.OpIter:
+			it, iterErr := evaluator.Iterate(vm.pop())
+			if iterErr != nil {
+				err = iterErr
+			} else {
+				vm.push(it)
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint32(ins[ip+1:]))
+			frame.ip += 4
+			value, ok := vm.stack[vm.sp-1].(*object.Iterator).Next()
+			if !ok {
+				vm.pop()
+				frame.ip = pos - 1
+			} else {
+				err = vm.pushResult(value)
+			}
+
+		case code.OpCollect:
+			numIterators := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			element := vm.pop()
+			arr := vm.stack[vm.sp-1-numIterators].(*object.Array)
+			arr.Elements = append(arr.Elements, element)
+
+		case code.OpCollectPair:
+			numIterators := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			value := vm.pop()
+			key := vm.pop()
+			hash := vm.stack[vm.sp-1-numIterators].(*object.Hash)
+			if hashKey, ok := object.HashKeyOf(key); ok {
+				hash.Pairs[hashKey] = object.HashPair{Key: key, Value: value}
+			} else {
+				err = hashKeyError(key)
+			}
+
+		case code.OpDestructure:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			constIndex := code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+			value := vm.pop()
+			arr, ok := value.(*object.Array)
+			var elements []object.Object
+			if ok {
+				elements = arr.Snapshot()
+			}
+			if !ok || len(elements) != numElements {
+				err = vm.patternMismatchError(int(constIndex), value)
+			} else {
+				vm.pushReversed(elements)
+			}
+
+		case code.OpMatchConstructor:
+			numArgs := int(code.ReadUint16(ins[ip+1:]))
+			constIndex := code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+			constructor := vm.pop()
+			err = vm.matchConstructor(constructor, vm.pop(), numArgs, int(constIndex))
+
+		case code.OpMatchValue:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			expected := vm.pop()
+			value := vm.pop()
+			if evaluator.Infix("==", expected, value) != True {
+				err = vm.patternMismatchError(int(constIndex), value)
+			}
+
+		case code.OpClass:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			hasSuper := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+			class := &object.Class{Name: vm.constantString(int(constIndex)), Methods: map[string]object.Object{}}
+			if hasSuper == 1 {
+				super := vm.pop()
+				superClass, ok := super.(*object.Class)
+				if !ok {
+					err = newError("superclass must be a CLASS, got %s", super.Type())
+					break
+				}
+				class.Super = superClass
+			}
+			vm.push(class)
+
+		case code.OpMethod:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			method := vm.pop()
+			vm.stack[vm.sp-1].(*object.Class).Methods[vm.constantString(int(constIndex))] = method
+
+		case code.OpStruct:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.defineStruct(vm.m.constants[constIndex].(*object.StructType))
+
+		case code.OpEnum:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(copyEnum(vm.m.constants[constIndex].(*object.Enum)))
+
+		case code.OpYield:
+			value := vm.pop()
+			if vm.yield == nil {
+				err = newError("yield outside of a generator")
+			} else {
+				err = vm.pushResult(vm.yield(value))
+			}
+
+		case code.OpSpawn:
+			args := vm.pop().(*object.Array).Snapshot()
+			fn := vm.pop()
+			vm.push(vm.spawn(fn, args))
+
+		case code.OpSelectCase:
+			send := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			err = vm.selectCase(send == 1)
+
+		case code.OpSelect:
+			numCases := int(code.ReadUint16(ins[ip+1:]))
+			hasDefault := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+			err = vm.executeSelect(numCases, hasDefault == 1)
+
+		case code.OpJumpUnlessCase:
+			caseIndex := int64(code.ReadUint16(ins[ip+1:]))
+			pos := int(code.ReadUint32(ins[ip+3:]))
+			frame.ip += 6
+			if vm.stack[vm.sp-1].(*object.Integer).Value == caseIndex {
+				vm.pop()
+			} else {
+				frame.ip = pos - 1
+			}
+
+		case code.OpQuote:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numValues := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			err = vm.quote(vm.m.constants[constIndex].(*object.Quote), numValues)
+
+		default:
+			def, _ := code.Lookup(byte(op))
+			err = newError("unknown opcode: %s", def.Name)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (vm *VM) push(o object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.grow(1)
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+// pushResult pushes the result of an operation, unless it's an error, which it
+// returns instead.
+func (vm *VM) pushResult(o object.Object) *object.Error {
+	if err, ok := o.(*object.Error); ok {
+		return err
+	}
+	vm.push(o)
+	return nil
+}
+
+// pushReversed pushes elements so the first is on top of the stack.
+func (vm *VM) pushReversed(elements []object.Object) {
+	for idx := len(elements) - 1; idx >= 0; idx-- {
+		vm.push(elements[idx])
+	}
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// grow makes room for n more values above the top of the stack.
+func (vm *VM) grow(n int) {
+	if vm.sp+n <= len(vm.stack) {
+		return
+	}
+	size := len(vm.stack) * 2
+	for size < vm.sp+n {
+		size *= 2
+	}
+	stack := make([]object.Object, size)
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+}
+
+func (vm *VM) constantString(idx int) string {
+	return vm.m.constants[idx].(*object.String).Value
+}
+
+// lookup returns the value of a variable that isn't set where it was resolved
+// to, by name: a local of a scope that hasn't reached its definition yet falls
+// back on a global, then a builtin, like in the evaluator.
+func (vm *VM) lookup(name string, local bool) object.Object {
+	if local {
+		if value := vm.m.globals.lookup(name); value != nil {
+			return value
+		}
+	}
+	if builtin, ok := evaluator.LookupBuiltin(vm.caller(), name); ok {
+		return builtin
+	}
+	return identifierNotFoundError(name)
+}
+
+// caller returns the Caller for the methods vm looks up.
+func (vm *VM) caller() evaluator.Caller {
+	return &caller{m: vm.m, depth: vm.depth}
+}
+
+// caller makes the callbacks of methods in a new vm, at the depth of the vm
+// that looked them up.
+type caller struct {
+	m     *machine
+	depth int
+}
+
+func (c *caller) Callback(fn object.Object, args ...object.Object) object.Object {
+	return c.m.call(c.depth, fn, args...)
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) {
+	fn := vm.m.constants[constIndex].(*object.CompiledFunction)
+
+	free := make([]*cell, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i].(*cell)
+	}
+	vm.sp -= numFree
+
+	vm.push(&Closure{Fn: fn, Free: free, m: vm.m})
+}
+
+func (vm *VM) index(left, index object.Object, constIndex int) object.Object {
+	if arr, ok := left.(*object.Array); ok {
+		if idx, ok := index.(*object.Integer); ok && idx.Value >= 0 {
+			if elem, ok := arr.Get(idx.Value); ok {
+				return elem
+			}
+		}
+	}
+	return evaluator.Index(left, index, source(vm.constantString(constIndex)))
+}
+
+// source is the source of an expression, for errors about it.
+type source string
+
+func (s source) String() string { return string(s) }
+
+func (vm *VM) buildHash(numElements int) *object.Error {
+	pairs := make(map[object.HashKey]object.HashPair, numElements/2)
+	for i := vm.sp - numElements; i < vm.sp; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := object.HashKeyOf(key)
+		if !ok {
+			return hashKeyError(key)
+		}
+		pairs[hashKey] = object.HashPair{Key: key, Value: value}
+	}
+	vm.sp -= numElements
+
+	vm.push(&object.Hash{Pairs: pairs})
+	return nil
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) *object.Error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			return vm.executeIntegerOperation(op, l.Value, r.Value)
+		}
+	}
+	return vm.pushResult(evaluator.Infix(operators[op], left, right))
+}
+
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+	code.OpIn:          "in",
+}
+
+func (vm *VM) executeIntegerOperation(op code.Opcode, left, right int64) *object.Error {
+	switch op {
+	case code.OpAdd:
+		vm.push(newInteger(left + right))
+	case code.OpSub:
+		vm.push(newInteger(left - right))
+	case code.OpMul:
+		vm.push(newInteger(left * right))
+	case code.OpDiv:
+		if right == 0 {
+			return newError("division by zero")
+		}
+		vm.push(newInteger(left / right))
+	case code.OpEqual:
+		vm.push(nativeBoolToBooleanObject(left == right))
+	case code.OpNotEqual:
+		vm.push(nativeBoolToBooleanObject(left != right))
+	case code.OpGreaterThan:
+		vm.push(nativeBoolToBooleanObject(left > right))
+	case code.OpLessThan:
+		vm.push(nativeBoolToBooleanObject(left < right))
+	default:
+		return vm.pushResult(evaluator.Infix(operators[op], newInteger(left), newInteger(right)))
+	}
+	return nil
+}
+
+// smallIntegers are the integers small enough to share, so arithmetic on them
+// doesn't allocate.
+var smallIntegers [1280]*object.Integer
+
+const smallIntegerMin = -256
+
+func init() {
+	for idx := range smallIntegers {
+		smallIntegers[idx] = &object.Integer{Value: int64(idx + smallIntegerMin)}
+	}
+}
+
+func newInteger(value int64) *object.Integer {
+	if idx := value - smallIntegerMin; idx >= 0 && idx < int64(len(smallIntegers)) {
+		return smallIntegers[idx]
+	}
+	return &object.Integer{Value: value}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value != 0
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func identifierNotFoundError(name string) *object.Error {
+	return newError("identifier not found: %s", name)
+}
+
+func wrongArgCountError(want, got int) *object.Error {
+	return newError("wrong number of arguments. got=%d, want=%d", got, want)
+}
+
+func hashKeyError(key object.Object) *object.Error {
+	return newError("unable to hash key: %s", key.Type())
+}